@@ -0,0 +1,271 @@
+package langfuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// OverflowPolicy controls what happens to ended spans when the export queue
+// is full
+type OverflowPolicy int
+
+const (
+	// OverflowDrop drops spans while the queue is full
+	OverflowDrop OverflowPolicy = iota
+	// OverflowBlock blocks the code ending a span until the queue has room
+	OverflowBlock
+	// OverflowDropExceptErrors drops spans while the queue is full, except
+	// observations at ERROR level or with an error status. Ending such a span
+	// blocks until the queue has room. Error spans are only dropped if the
+	// client shuts down while they wait.
+	OverflowDropExceptErrors
+)
+
+// BatchConfig tunes how ended spans are queued and exported in batches. Zero
+// values use the OpenTelemetry defaults.
+type BatchConfig struct {
+	MaxQueueSize       int            // Optional, defaults to 2048 spans
+	MaxExportBatchSize int            // Optional, defaults to 512 spans
+	BatchTimeout       time.Duration  // Optional, defaults to 5 seconds between exports
+	ExportTimeout      time.Duration  // Optional, defaults to 30 seconds per export
+	Overflow           OverflowPolicy // Optional, defaults to OverflowDrop
+
+	// OnDrop is called with every span dropped because the queue is full. It
+	// runs in the code ending the span and must not block.
+	OnDrop func(span trace.ReadOnlySpan) // Optional
+}
+
+// Batch processor defaults of OpenTelemetry
+const (
+	defaultMaxQueueSize       = 2048
+	defaultMaxExportBatchSize = 512
+)
+
+// validate checks the batch configuration
+func (c *BatchConfig) validate() error {
+	if c.MaxQueueSize < 0 || c.MaxExportBatchSize < 0 || c.BatchTimeout < 0 || c.ExportTimeout < 0 {
+		return fmt.Errorf("batch sizes and timeouts must not be negative")
+	}
+	if c.Overflow < OverflowDrop || c.Overflow > OverflowDropExceptErrors {
+		return fmt.Errorf("invalid overflow policy %d", c.Overflow)
+	}
+	queueSize, batchSize := c.MaxQueueSize, c.MaxExportBatchSize
+	if queueSize == 0 {
+		queueSize = defaultMaxQueueSize
+	}
+	if batchSize == 0 {
+		batchSize = defaultMaxExportBatchSize
+	}
+	if batchSize > queueSize {
+		return fmt.Errorf("max export batch size %d exceeds max queue size %d", batchSize, queueSize)
+	}
+	return nil
+}
+
+// newBatchProcessor creates the span processor exporting to exporter
+func newBatchProcessor(exporter trace.SpanExporter, config *BatchConfig) trace.SpanProcessor {
+	if config == nil {
+		return trace.NewBatchSpanProcessor(exporter)
+	}
+
+	var options []trace.BatchSpanProcessorOption
+	if config.MaxExportBatchSize > 0 {
+		options = append(options, trace.WithMaxExportBatchSize(config.MaxExportBatchSize))
+	}
+	if config.BatchTimeout > 0 {
+		options = append(options, trace.WithBatchTimeout(config.BatchTimeout))
+	}
+	if config.ExportTimeout > 0 {
+		options = append(options, trace.WithExportTimeout(config.ExportTimeout))
+	}
+
+	// The OpenTelemetry processor drops spans silently, so drops are only
+	// observable with a queue of our own in front of a blocking processor
+	if config.Overflow == OverflowDropExceptErrors || (config.Overflow == OverflowDrop && config.OnDrop != nil) {
+		queueSize := config.MaxQueueSize
+		if queueSize == 0 {
+			queueSize = defaultMaxQueueSize
+		}
+		batchSize := config.MaxExportBatchSize
+		if batchSize == 0 {
+			batchSize = defaultMaxExportBatchSize
+		}
+		options = append(options, trace.WithMaxQueueSize(batchSize), trace.WithBlocking())
+		return newOverflowProcessor(trace.NewBatchSpanProcessor(exporter, options...), queueSize, config)
+	}
+
+	if config.MaxQueueSize > 0 {
+		options = append(options, trace.WithMaxQueueSize(config.MaxQueueSize))
+	}
+	if config.Overflow == OverflowBlock {
+		options = append(options, trace.WithBlocking())
+	}
+	return trace.NewBatchSpanProcessor(exporter, options...)
+}
+
+// queuedSpan is an ended span or a flush request in the overflow queue
+type queuedSpan struct {
+	span    trace.ReadOnlySpan
+	flushed chan struct{}
+}
+
+// overflowProcessor queues ended spans for the next processor, applying the
+// overflow policy and reporting dropped spans when the queue is full
+type overflowProcessor struct {
+	next   trace.SpanProcessor
+	policy OverflowPolicy
+	onDrop func(trace.ReadOnlySpan)
+
+	queue chan queuedSpan
+	done  chan struct{}
+
+	// stop is closed on shutdown to release the senders waiting for room in
+	// the queue, which must all return before the queue is closed
+	stop    chan struct{}
+	senders sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newOverflowProcessor(next trace.SpanProcessor, queueSize int, config *BatchConfig) *overflowProcessor {
+	p := &overflowProcessor{
+		next:   next,
+		policy: config.Overflow,
+		onDrop: config.OnDrop,
+		queue:  make(chan queuedSpan, queueSize),
+		done:   make(chan struct{}),
+		stop:   make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// run hands queued spans to the next processor until the queue is closed
+func (p *overflowProcessor) run() {
+	defer close(p.done)
+	for q := range p.queue {
+		if q.flushed != nil {
+			close(q.flushed)
+			continue
+		}
+		p.next.OnEnd(q.span)
+	}
+}
+
+func (p *overflowProcessor) OnStart(parent context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *overflowProcessor) OnEnd(s trace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return
+	}
+	select {
+	case p.queue <- queuedSpan{span: s}:
+		p.mu.RUnlock()
+		return
+	default:
+	}
+	if p.policy != OverflowDropExceptErrors || !isErrorSpan(s) {
+		p.mu.RUnlock()
+		p.drop(s)
+		return
+	}
+
+	// Wait for room without holding the lock, so that shutdown can release
+	// the wait
+	p.senders.Add(1)
+	p.mu.RUnlock()
+	defer p.senders.Done()
+	select {
+	case p.queue <- queuedSpan{span: s}:
+	case <-p.stop:
+		p.drop(s)
+	}
+}
+
+// drop reports a span dropped because the queue is full
+func (p *overflowProcessor) drop(s trace.ReadOnlySpan) {
+	if p.onDrop != nil {
+		p.onDrop(s)
+	}
+}
+
+// ForceFlush hands all queued spans to the next processor and flushes it
+func (p *overflowProcessor) ForceFlush(ctx context.Context) error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return nil
+	}
+	p.senders.Add(1)
+	p.mu.RUnlock()
+
+	flushed := make(chan struct{})
+	select {
+	case p.queue <- queuedSpan{flushed: flushed}:
+		p.senders.Done()
+	case <-p.stop:
+		p.senders.Done()
+		return nil
+	case <-ctx.Done():
+		p.senders.Done()
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.next.ForceFlush(ctx)
+}
+
+// Shutdown hands all queued spans to the next processor and shuts it down.
+// The next processor is shut down even if the queue is not drained in time.
+func (p *overflowProcessor) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.stop)
+	p.mu.Unlock()
+
+	p.senders.Wait()
+	close(p.queue)
+
+	var err error
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return errors.Join(err, p.next.Shutdown(ctx))
+}
+
+// isErrorSpan reports whether a span is an observation at ERROR level or,
+// without a level, has an error status. The level decides when it is set, as
+// WARNING observations carry an error status too.
+func isErrorSpan(s trace.ReadOnlySpan) bool {
+	for _, attr := range s.Attributes() {
+		if attr.Key == "langfuse.observation.level" {
+			return attr.Value.AsString() == string(LogLevelError)
+		}
+	}
+	return s.Status().Code == codes.Error
+}
@@ -0,0 +1,320 @@
+package langfuse
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// gatedProcessor records the names of ended spans. OnEnd blocks until the
+// gate is opened, so spans back up in the overflow queue.
+type gatedProcessor struct {
+	entered  chan struct{}
+	gate     chan struct{}
+	shutdown atomic.Bool
+
+	mu    sync.Mutex
+	ended []string
+}
+
+func newGatedProcessor() *gatedProcessor {
+	return &gatedProcessor{entered: make(chan struct{}, 16), gate: make(chan struct{})}
+}
+
+func (p *gatedProcessor) OnStart(context.Context, trace.ReadWriteSpan) {}
+
+func (p *gatedProcessor) OnEnd(s trace.ReadOnlySpan) {
+	p.entered <- struct{}{}
+	<-p.gate
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ended = append(p.ended, s.Name())
+}
+
+func (p *gatedProcessor) ForceFlush(context.Context) error { return nil }
+func (p *gatedProcessor) Shutdown(context.Context) error {
+	p.shutdown.Store(true)
+	return nil
+}
+
+func (p *gatedProcessor) names() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return strings.Join(p.ended, ",")
+}
+
+// endedSpan returns a sampled, ended span
+func endedSpan(name string, status codes.Code, attrs ...attribute.KeyValue) trace.ReadOnlySpan {
+	return tracetest.SpanStub{
+		Name: name,
+		SpanContext: oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+			TraceID:    oteltrace.TraceID{1},
+			SpanID:     oteltrace.SpanID{2},
+			TraceFlags: oteltrace.FlagsSampled,
+		}),
+		Status:     trace.Status{Code: status},
+		Attributes: attrs,
+	}.Snapshot()
+}
+
+// fillQueue ends a span that blocks in the next processor and then enough
+// spans to fill a queue of size n
+func fillQueue(p *overflowProcessor, next *gatedProcessor, n int) {
+	p.OnEnd(endedSpan("busy", codes.Unset))
+	<-next.entered
+	for i := 0; i < n; i++ {
+		p.OnEnd(endedSpan("queued", codes.Unset))
+	}
+}
+
+func TestOverflowDrop(t *testing.T) {
+	next := newGatedProcessor()
+	var dropped []string
+	p := newOverflowProcessor(next, 2, &BatchConfig{
+		Overflow: OverflowDrop,
+		OnDrop:   func(s trace.ReadOnlySpan) { dropped = append(dropped, s.Name()) },
+	})
+
+	fillQueue(p, next, 2)
+	p.OnEnd(endedSpan("overflow", codes.Unset))
+	p.OnEnd(endedSpan("failed", codes.Error))
+
+	if got := strings.Join(dropped, ","); got != "overflow,failed" {
+		t.Errorf("dropped %s, want overflow,failed", got)
+	}
+
+	close(next.gate)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := next.names(); got != "busy,queued,queued" {
+		t.Errorf("exported %s", got)
+	}
+}
+
+func TestOverflowDropExceptErrors(t *testing.T) {
+	next := newGatedProcessor()
+	var mu sync.Mutex
+	var dropped []string
+	p := newOverflowProcessor(next, 2, &BatchConfig{
+		Overflow: OverflowDropExceptErrors,
+		OnDrop: func(s trace.ReadOnlySpan) {
+			mu.Lock()
+			defer mu.Unlock()
+			dropped = append(dropped, s.Name())
+		},
+	})
+
+	fillQueue(p, next, 2)
+	p.OnEnd(endedSpan("overflow", codes.Unset))
+
+	// An error span waits for room instead of being dropped
+	ended := make(chan struct{})
+	go func() {
+		p.OnEnd(endedSpan("failed", codes.Unset, attribute.String("langfuse.observation.level", string(LogLevelError))))
+		close(ended)
+	}()
+	select {
+	case <-ended:
+		t.Fatal("error span did not wait for room in a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(next.gate)
+	<-ended
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := next.names(); got != "busy,queued,queued,failed" {
+		t.Errorf("exported %s", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(dropped, ","); got != "overflow" {
+		t.Errorf("dropped %s, want overflow", got)
+	}
+}
+
+func TestOverflowShutdownReleasesErrorSpan(t *testing.T) {
+	next := newGatedProcessor()
+	defer close(next.gate)
+	dropped := make(chan string, 1)
+	p := newOverflowProcessor(next, 1, &BatchConfig{
+		Overflow: OverflowDropExceptErrors,
+		OnDrop:   func(s trace.ReadOnlySpan) { dropped <- s.Name() },
+	})
+	fillQueue(p, next, 1)
+
+	ended := make(chan struct{})
+	go func() {
+		p.OnEnd(endedSpan("failed", codes.Error))
+		close(ended)
+	}()
+	select {
+	case <-ended:
+		t.Fatal("error span dropped before shutdown")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// The waiting span must not keep Shutdown from honouring its context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want the deadline error", err)
+	}
+	<-ended
+	if got := <-dropped; got != "failed" {
+		t.Errorf("dropped %s, want failed", got)
+	}
+}
+
+func TestOverflowShutdownTimeout(t *testing.T) {
+	next := newGatedProcessor()
+	defer close(next.gate)
+	p := newOverflowProcessor(next, 2, &BatchConfig{Overflow: OverflowDropExceptErrors})
+	fillQueue(p, next, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want the deadline error", err)
+	}
+	if !next.shutdown.Load() {
+		t.Error("next processor not shut down")
+	}
+}
+
+func TestOverflowProcessorFlushAndShutdown(t *testing.T) {
+	next := newGatedProcessor()
+	close(next.gate)
+	p := newOverflowProcessor(next, 4, &BatchConfig{Overflow: OverflowDropExceptErrors})
+
+	p.OnEnd(endedSpan("a", codes.Unset))
+	p.OnEnd(endedSpan("b", codes.Unset))
+	if err := p.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := next.names(); got != "a,b" {
+		t.Errorf("flushed %s, want a,b", got)
+	}
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	p.OnEnd(endedSpan("late", codes.Unset))
+	if err := p.ForceFlush(context.Background()); err != nil {
+		t.Errorf("ForceFlush after Shutdown: %v", err)
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Errorf("second Shutdown: %v", err)
+	}
+	if got := next.names(); got != "a,b" {
+		t.Errorf("exported %s after shutdown", got)
+	}
+}
+
+func TestIsErrorSpan(t *testing.T) {
+	level := func(l LogLevel) attribute.KeyValue {
+		return attribute.String("langfuse.observation.level", string(l))
+	}
+	tests := []struct {
+		name   string
+		status codes.Code
+		attrs  []attribute.KeyValue
+		want   bool
+	}{
+		{"ok", codes.Ok, nil, false},
+		{"unset", codes.Unset, nil, false},
+		{"error status", codes.Error, nil, true},
+		{"error level", codes.Unset, []attribute.KeyValue{level(LogLevelError)}, true},
+		{"error level and status", codes.Error, []attribute.KeyValue{level(LogLevelError)}, true},
+		{"warning with error status", codes.Error, []attribute.KeyValue{level(LogLevelWarning)}, false},
+		{"default level with error status", codes.Error, []attribute.KeyValue{level(LogLevelDefault)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isErrorSpan(endedSpan(tt.name, tt.status, tt.attrs...)); got != tt.want {
+				t.Errorf("isErrorSpan = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  BatchConfig
+		wantErr string
+	}{
+		{name: "defaults", config: BatchConfig{}},
+		{name: "tuned", config: BatchConfig{MaxQueueSize: 100, MaxExportBatchSize: 100, BatchTimeout: time.Second, Overflow: OverflowBlock}},
+		{name: "negative size", config: BatchConfig{MaxQueueSize: -1}, wantErr: "must not be negative"},
+		{name: "negative timeout", config: BatchConfig{ExportTimeout: -time.Second}, wantErr: "must not be negative"},
+		{name: "unknown policy", config: BatchConfig{Overflow: 9}, wantErr: "invalid overflow policy 9"},
+		{name: "batch above queue", config: BatchConfig{MaxQueueSize: 10, MaxExportBatchSize: 20}, wantErr: "exceeds max queue size"},
+		{name: "batch above default queue", config: BatchConfig{MaxExportBatchSize: 4096}, wantErr: "exceeds max queue size 2048"},
+		{name: "queue below default batch", config: BatchConfig{MaxQueueSize: 100}, wantErr: "max export batch size 512"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewBatchProcessor(t *testing.T) {
+	onDrop := func(trace.ReadOnlySpan) {}
+	tests := []struct {
+		name     string
+		config   *BatchConfig
+		overflow bool
+	}{
+		{"default", nil, false},
+		{"drop", &BatchConfig{Overflow: OverflowDrop}, false},
+		{"drop with OnDrop", &BatchConfig{Overflow: OverflowDrop, OnDrop: onDrop}, true},
+		{"block", &BatchConfig{Overflow: OverflowBlock, OnDrop: onDrop}, false},
+		{"drop except errors", &BatchConfig{Overflow: OverflowDropExceptErrors}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newBatchProcessor(tracetest.NewInMemoryExporter(), tt.config)
+			defer p.Shutdown(context.Background())
+			if _, ok := p.(*overflowProcessor); ok != tt.overflow {
+				t.Errorf("overflow queue = %v, want %v", ok, tt.overflow)
+			}
+		})
+	}
+}
+
+func TestClientBatchConfig(t *testing.T) {
+	_, err := NewClient(Config{
+		PublicKey: "pk-lf-test",
+		SecretKey: "sk-lf-test",
+		Batch:     &BatchConfig{MaxQueueSize: -1},
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid batch configuration") {
+		t.Errorf("got error %v for an invalid batch configuration", err)
+	}
+}
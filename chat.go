@@ -0,0 +1,613 @@
+package langfuse
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Chat message roles recognized by the Langfuse chat view
+const (
+	ChatRoleSystem    = "system"
+	ChatRoleDeveloper = "developer"
+	ChatRoleUser      = "user"
+	ChatRoleAssistant = "assistant"
+	ChatRoleTool      = "tool"
+)
+
+// ContentPartType represents the type of a multimodal message content part
+type ContentPartType string
+
+const (
+	ContentPartTypeText  ContentPartType = "text"
+	ContentPartTypeImage ContentPartType = "image_url"
+	ContentPartTypeAudio ContentPartType = "input_audio"
+	ContentPartTypeFile  ContentPartType = "file"
+)
+
+// ChatInput represents the input of a chat generation: the conversation and
+// the tools offered to the model
+type ChatInput struct {
+	Messages []ChatMessage    `json:"messages"`
+	Tools    []ToolDefinition `json:"tools,omitempty"`
+}
+
+// ChatMessage represents a single chat message. Content holds plain text;
+// Parts holds multimodal content and takes precedence when set.
+type ChatMessage struct {
+	Role       string
+	Content    string
+	Parts      []ContentPart
+	Name       string
+	ToolCalls  []ToolCall
+	ToolCallID string
+}
+
+// ContentPart represents one part of a multimodal message
+type ContentPart struct {
+	Type       ContentPartType `json:"type"`
+	Text       string          `json:"text,omitempty"`
+	ImageURL   *ImageURL       `json:"image_url,omitempty"`
+	InputAudio *InputAudio     `json:"input_audio,omitempty"`
+	File       *FileContent    `json:"file,omitempty"`
+}
+
+// ImageURL references an image by URL or base64 data URI
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// InputAudio holds audio content as a base64 data URI
+type InputAudio struct {
+	Data   string `json:"data"`
+	Format string `json:"format,omitempty"`
+}
+
+// FileContent holds a file such as a PDF, either by ID or as a base64 data URI
+type FileContent struct {
+	FileID   string `json:"file_id,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+}
+
+// ToolDefinition describes a tool offered to the model
+type ToolDefinition struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+// FunctionDefinition describes a callable function and its JSON schema
+type FunctionDefinition struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+}
+
+// ToolCall represents a tool invocation requested by the model
+type ToolCall struct {
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall holds the function name and its JSON-encoded arguments
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ToolResult represents the result of a tool call sent back to the model
+type ToolResult struct {
+	ToolCallID string
+	Name       string
+	Content    string
+}
+
+// NewFunctionTool creates a function tool definition
+func NewFunctionTool(name, description string, parameters interface{}) ToolDefinition {
+	return ToolDefinition{
+		Type: "function",
+		Function: FunctionDefinition{
+			Name:        name,
+			Description: description,
+			Parameters:  parameters,
+		},
+	}
+}
+
+// NewToolCall creates a function tool call, encoding arguments as JSON unless
+// they already are a string
+func NewToolCall(id, name string, arguments interface{}) ToolCall {
+	args, ok := arguments.(string)
+	if !ok {
+		argsJSON, _ := json.Marshal(arguments)
+		args = string(argsJSON)
+	}
+	return ToolCall{
+		ID:       id,
+		Type:     "function",
+		Function: FunctionCall{Name: name, Arguments: args},
+	}
+}
+
+// TextPart creates a text content part
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: ContentPartTypeText, Text: text}
+}
+
+// ImagePart creates an image content part from a URL or base64 data URI
+func ImagePart(url string) ContentPart {
+	return ContentPart{Type: ContentPartTypeImage, ImageURL: &ImageURL{URL: url}}
+}
+
+// ImagePartFromMedia creates an image content part that is uploaded as media
+func ImagePartFromMedia(m *Media) ContentPart {
+	return ImagePart(m.DataURI())
+}
+
+// AudioPartFromMedia creates an audio content part that is uploaded as media
+func AudioPartFromMedia(m *Media) ContentPart {
+	format := strings.TrimPrefix(m.contentType, "audio/")
+	return ContentPart{Type: ContentPartTypeAudio, InputAudio: &InputAudio{Data: m.DataURI(), Format: format}}
+}
+
+// FilePartFromMedia creates a file content part that is uploaded as media
+func FilePartFromMedia(m *Media, filename string) ContentPart {
+	return ContentPart{Type: ContentPartTypeFile, File: &FileContent{Filename: filename, FileData: m.DataURI()}}
+}
+
+// DataURI returns the media content encoded as a base64 data URI
+func (m *Media) DataURI() string {
+	return "data:" + m.contentType + ";base64," + base64.StdEncoding.EncodeToString(m.content)
+}
+
+// Message returns the tool result as a tool chat message
+func (r ToolResult) Message() ChatMessage {
+	return ChatMessage{Role: ChatRoleTool, Content: r.Content, Name: r.Name, ToolCallID: r.ToolCallID}
+}
+
+// MarshalJSON serializes the tool result as a tool chat message
+func (r ToolResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Message())
+}
+
+// chatMessageJSON is the wire format of ChatMessage
+type chatMessageJSON struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content,omitempty"`
+	Name       string          `json:"name,omitempty"`
+	ToolCalls  []ToolCall      `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+}
+
+// MarshalJSON serializes the message in the OpenAI chat format understood by
+// Langfuse. A message that only carries tool calls has null content.
+func (m ChatMessage) MarshalJSON() ([]byte, error) {
+	var content interface{} = m.Content
+	switch {
+	case len(m.Parts) > 0:
+		content = m.Parts
+	case m.Content == "" && len(m.ToolCalls) > 0:
+		content = nil
+	}
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(chatMessageJSON{
+		Role:       m.Role,
+		Content:    contentJSON,
+		Name:       m.Name,
+		ToolCalls:  m.ToolCalls,
+		ToolCallID: m.ToolCallID,
+	})
+}
+
+// UnmarshalJSON parses a message in the OpenAI chat format
+func (m *ChatMessage) UnmarshalJSON(data []byte) error {
+	var raw chatMessageJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*m = ChatMessage{
+		Role:       raw.Role,
+		Name:       raw.Name,
+		ToolCalls:  raw.ToolCalls,
+		ToolCallID: raw.ToolCallID,
+	}
+
+	if len(raw.Content) == 0 || string(raw.Content) == "null" {
+		return nil
+	}
+	if raw.Content[0] == '"' {
+		return json.Unmarshal(raw.Content, &m.Content)
+	}
+	return json.Unmarshal(raw.Content, &m.Parts)
+}
+
+// ChatInputFromOpenAI converts an OpenAI chat completions request body into
+// a ChatInput
+func ChatInputFromOpenAI(request []byte) (ChatInput, error) {
+	var req struct {
+		Messages []ChatMessage    `json:"messages"`
+		Tools    []ToolDefinition `json:"tools"`
+	}
+	if err := json.Unmarshal(request, &req); err != nil {
+		return ChatInput{}, fmt.Errorf("invalid OpenAI request: %w", err)
+	}
+	return ChatInput{Messages: req.Messages, Tools: req.Tools}, nil
+}
+
+// ChatMessageFromOpenAI converts an OpenAI chat completions response body into
+// the assistant message of its first choice
+func ChatMessageFromOpenAI(response []byte) (ChatMessage, error) {
+	var resp struct {
+		Choices []struct {
+			Message ChatMessage `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(response, &resp); err != nil {
+		return ChatMessage{}, fmt.Errorf("invalid OpenAI response: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return ChatMessage{}, fmt.Errorf("OpenAI response has no choices")
+	}
+	return resp.Choices[0].Message, nil
+}
+
+// anthropicContentBlock is a content block of the Anthropic Messages API
+type anthropicContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+	Source    *struct {
+		Type      string `json:"type"`
+		MediaType string `json:"media_type"`
+		Data      string `json:"data"`
+		URL       string `json:"url"`
+	} `json:"source"`
+}
+
+// anthropicContent decodes Anthropic content given either as a string or as
+// a list of content blocks
+func anthropicContent(raw json.RawMessage) ([]anthropicContentBlock, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		return []anthropicContentBlock{{Type: "text", Text: text}}, nil
+	}
+	var blocks []anthropicContentBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// anthropicMessages converts Anthropic content blocks into chat messages.
+// Tool results become separate tool messages as in the OpenAI format.
+func anthropicMessages(role string, blocks []anthropicContentBlock) ([]ChatMessage, error) {
+	msg := ChatMessage{Role: role}
+	var toolMessages []ChatMessage
+
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			msg.Parts = append(msg.Parts, TextPart(block.Text))
+		case "image", "document":
+			if block.Source == nil {
+				continue
+			}
+			url := block.Source.URL
+			if block.Source.Type == "base64" {
+				url = "data:" + block.Source.MediaType + ";base64," + block.Source.Data
+			}
+			if block.Type == "image" {
+				msg.Parts = append(msg.Parts, ImagePart(url))
+			} else {
+				msg.Parts = append(msg.Parts, ContentPart{Type: ContentPartTypeFile, File: &FileContent{FileData: url}})
+			}
+		case "tool_use":
+			args := string(block.Input)
+			if args == "" {
+				args = "{}"
+			}
+			msg.ToolCalls = append(msg.ToolCalls, ToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: FunctionCall{Name: block.Name, Arguments: args},
+			})
+		case "tool_result":
+			resultBlocks, err := anthropicContent(block.Content)
+			if err != nil {
+				return nil, err
+			}
+			var texts []string
+			for _, b := range resultBlocks {
+				if b.Type == "text" {
+					texts = append(texts, b.Text)
+				}
+			}
+			toolMessages = append(toolMessages, ChatMessage{
+				Role:       ChatRoleTool,
+				Content:    strings.Join(texts, "\n"),
+				ToolCallID: block.ToolUseID,
+			})
+		}
+	}
+
+	// Collapse text-only content to a plain string for readability
+	if len(msg.Parts) == 1 && msg.Parts[0].Type == ContentPartTypeText {
+		msg.Content = msg.Parts[0].Text
+		msg.Parts = nil
+	}
+
+	messages := toolMessages
+	if len(msg.Parts) > 0 || msg.Content != "" || len(msg.ToolCalls) > 0 {
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// ChatInputFromAnthropic converts an Anthropic Messages API request body into
+// a ChatInput
+func ChatInputFromAnthropic(request []byte) (ChatInput, error) {
+	var req struct {
+		System   json.RawMessage `json:"system"`
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+		Tools []struct {
+			Name        string      `json:"name"`
+			Description string      `json:"description"`
+			InputSchema interface{} `json:"input_schema"`
+		} `json:"tools"`
+	}
+	if err := json.Unmarshal(request, &req); err != nil {
+		return ChatInput{}, fmt.Errorf("invalid Anthropic request: %w", err)
+	}
+
+	var input ChatInput
+
+	systemBlocks, err := anthropicContent(req.System)
+	if err != nil {
+		return ChatInput{}, fmt.Errorf("invalid Anthropic system prompt: %w", err)
+	}
+	if len(systemBlocks) > 0 {
+		system, err := anthropicMessages(ChatRoleSystem, systemBlocks)
+		if err != nil {
+			return ChatInput{}, err
+		}
+		input.Messages = append(input.Messages, system...)
+	}
+
+	for _, m := range req.Messages {
+		blocks, err := anthropicContent(m.Content)
+		if err != nil {
+			return ChatInput{}, fmt.Errorf("invalid Anthropic message content: %w", err)
+		}
+		messages, err := anthropicMessages(m.Role, blocks)
+		if err != nil {
+			return ChatInput{}, err
+		}
+		input.Messages = append(input.Messages, messages...)
+	}
+
+	for _, tool := range req.Tools {
+		// Server tools such as web search carry no schema and are kept by name
+		input.Tools = append(input.Tools, NewFunctionTool(tool.Name, tool.Description, tool.InputSchema))
+	}
+
+	return input, nil
+}
+
+// ChatMessageFromAnthropic converts an Anthropic Messages API response body
+// into an assistant message
+func ChatMessageFromAnthropic(response []byte) (ChatMessage, error) {
+	var resp struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(response, &resp); err != nil {
+		return ChatMessage{}, fmt.Errorf("invalid Anthropic response: %w", err)
+	}
+
+	blocks, err := anthropicContent(resp.Content)
+	if err != nil {
+		return ChatMessage{}, fmt.Errorf("invalid Anthropic response content: %w", err)
+	}
+
+	role := resp.Role
+	if role == "" {
+		role = ChatRoleAssistant
+	}
+	messages, err := anthropicMessages(role, blocks)
+	if err != nil {
+		return ChatMessage{}, err
+	}
+	if len(messages) == 0 {
+		return ChatMessage{Role: role}, nil
+	}
+	return messages[len(messages)-1], nil
+}
+
+// geminiPart is a content part of the Gemini generateContent API
+type geminiPart struct {
+	Text       string `json:"text"`
+	Thought    bool   `json:"thought"`
+	InlineData *struct {
+		MimeType string `json:"mimeType"`
+		Data     string `json:"data"`
+	} `json:"inlineData"`
+	FileData *struct {
+		MimeType string `json:"mimeType"`
+		FileURI  string `json:"fileUri"`
+	} `json:"fileData"`
+	FunctionCall *struct {
+		ID   string          `json:"id"`
+		Name string          `json:"name"`
+		Args json.RawMessage `json:"args"`
+	} `json:"functionCall"`
+	FunctionResponse *struct {
+		ID       string          `json:"id"`
+		Name     string          `json:"name"`
+		Response json.RawMessage `json:"response"`
+	} `json:"functionResponse"`
+}
+
+// geminiContent is a turn of a Gemini conversation
+type geminiContent struct {
+	Role  string       `json:"role"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiMessages converts Gemini content into chat messages. Gemini has no
+// tool call IDs unless set explicitly, so calls and results are matched by
+// function name. Thought summaries are left out.
+func geminiMessages(content geminiContent) []ChatMessage {
+	role := content.Role
+	switch role {
+	case "model":
+		role = ChatRoleAssistant
+	case "":
+		role = ChatRoleUser
+	}
+
+	msg := ChatMessage{Role: role}
+	var toolMessages []ChatMessage
+
+	for _, part := range content.Parts {
+		switch {
+		case part.Thought:
+			continue
+		case part.Text != "":
+			// Streamed text arrives in many parts that belong together
+			if n := len(msg.Parts); n > 0 && msg.Parts[n-1].Type == ContentPartTypeText {
+				msg.Parts[n-1].Text += part.Text
+			} else {
+				msg.Parts = append(msg.Parts, TextPart(part.Text))
+			}
+		case part.InlineData != nil:
+			url := "data:" + part.InlineData.MimeType + ";base64," + part.InlineData.Data
+			msg.Parts = append(msg.Parts, geminiFilePart(part.InlineData.MimeType, url))
+		case part.FileData != nil:
+			msg.Parts = append(msg.Parts, geminiFilePart(part.FileData.MimeType, part.FileData.FileURI))
+		case part.FunctionCall != nil:
+			id := part.FunctionCall.ID
+			if id == "" {
+				id = part.FunctionCall.Name
+			}
+			args := string(part.FunctionCall.Args)
+			if args == "" {
+				args = "{}"
+			}
+			msg.ToolCalls = append(msg.ToolCalls, NewToolCall(id, part.FunctionCall.Name, args))
+		case part.FunctionResponse != nil:
+			id := part.FunctionResponse.ID
+			if id == "" {
+				id = part.FunctionResponse.Name
+			}
+			toolMessages = append(toolMessages, ChatMessage{
+				Role:       ChatRoleTool,
+				Name:       part.FunctionResponse.Name,
+				Content:    string(part.FunctionResponse.Response),
+				ToolCallID: id,
+			})
+		}
+	}
+
+	// Collapse text-only content to a plain string for readability
+	if len(msg.Parts) == 1 && msg.Parts[0].Type == ContentPartTypeText {
+		msg.Content = msg.Parts[0].Text
+		msg.Parts = nil
+	}
+
+	messages := toolMessages
+	if len(msg.Parts) > 0 || msg.Content != "" || len(msg.ToolCalls) > 0 {
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// geminiFilePart converts inline or referenced data into an image or file part
+func geminiFilePart(mimeType, url string) ContentPart {
+	if strings.HasPrefix(mimeType, "image/") {
+		return ImagePart(url)
+	}
+	return ContentPart{Type: ContentPartTypeFile, File: &FileContent{FileData: url}}
+}
+
+// ChatInputFromGemini converts a Gemini or Vertex AI generateContent request
+// body into a ChatInput
+func ChatInputFromGemini(request []byte) (ChatInput, error) {
+	var req struct {
+		SystemInstruction *geminiContent  `json:"systemInstruction"`
+		Contents          []geminiContent `json:"contents"`
+		Tools             []struct {
+			FunctionDeclarations []struct {
+				Name        string      `json:"name"`
+				Description string      `json:"description"`
+				Parameters  interface{} `json:"parameters"`
+			} `json:"functionDeclarations"`
+		} `json:"tools"`
+	}
+	if err := json.Unmarshal(request, &req); err != nil {
+		return ChatInput{}, fmt.Errorf("invalid Gemini request: %w", err)
+	}
+
+	var input ChatInput
+	if req.SystemInstruction != nil {
+		system := *req.SystemInstruction
+		system.Role = ChatRoleSystem
+		input.Messages = append(input.Messages, geminiMessages(system)...)
+	}
+	for _, content := range req.Contents {
+		input.Messages = append(input.Messages, geminiMessages(content)...)
+	}
+	for _, tool := range req.Tools {
+		for _, fn := range tool.FunctionDeclarations {
+			input.Tools = append(input.Tools, NewFunctionTool(fn.Name, fn.Description, fn.Parameters))
+		}
+	}
+
+	return input, nil
+}
+
+// ChatMessageFromGemini converts a Gemini or Vertex AI generateContent
+// response body into the assistant message of its first candidate
+func ChatMessageFromGemini(response []byte) (ChatMessage, error) {
+	var resp struct {
+		Candidates []struct {
+			Content geminiContent `json:"content"`
+		} `json:"candidates"`
+	}
+	if err := json.Unmarshal(response, &resp); err != nil {
+		return ChatMessage{}, fmt.Errorf("invalid Gemini response: %w", err)
+	}
+	if len(resp.Candidates) == 0 {
+		return ChatMessage{}, fmt.Errorf("gemini response has no candidates")
+	}
+
+	content := resp.Candidates[0].Content
+	if content.Role == "" {
+		content.Role = "model"
+	}
+	messages := geminiMessages(content)
+	if len(messages) == 0 {
+		return ChatMessage{Role: ChatRoleAssistant}, nil
+	}
+	return messages[len(messages)-1], nil
+}
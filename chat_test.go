@@ -0,0 +1,175 @@
+package langfuse
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestChatMessageJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		message ChatMessage
+		want    string
+	}{
+		{
+			name:    "text",
+			message: ChatMessage{Role: ChatRoleUser, Content: "Hello"},
+			want:    `{"role":"user","content":"Hello"}`,
+		},
+		{
+			name:    "empty text",
+			message: ChatMessage{Role: ChatRoleUser},
+			want:    `{"role":"user","content":""}`,
+		},
+		{
+			name:    "parts",
+			message: ChatMessage{Role: ChatRoleUser, Parts: []ContentPart{TextPart("What is this?"), ImagePart("https://example.com/cat.png")}},
+			want:    `{"role":"user","content":[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}}]}`,
+		},
+		{
+			name: "tool calls only",
+			message: ChatMessage{
+				Role:      ChatRoleAssistant,
+				ToolCalls: []ToolCall{NewToolCall("call_1", "get_weather", map[string]string{"city": "Paris"})},
+			},
+			want: `{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}`,
+		},
+		{
+			name: "tool calls with text",
+			message: ChatMessage{
+				Role:      ChatRoleAssistant,
+				Content:   "Checking",
+				ToolCalls: []ToolCall{NewToolCall("call_1", "get_weather", `{"city":"Paris"}`)},
+			},
+			want: `{"role":"assistant","content":"Checking","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}`,
+		},
+		{
+			name:    "tool result",
+			message: ToolResult{ToolCallID: "call_1", Name: "get_weather", Content: "sunny"}.Message(),
+			want:    `{"role":"tool","content":"sunny","name":"get_weather","tool_call_id":"call_1"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("marshal:\n got %s\nwant %s", data, tt.want)
+			}
+
+			var decoded ChatMessage
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, tt.message) {
+				t.Errorf("round trip:\n got %+v\nwant %+v", decoded, tt.message)
+			}
+		})
+	}
+}
+
+func TestMediaParts(t *testing.T) {
+	image := NewMediaFromBytes([]byte("png"), "image/png")
+	audio := NewMediaFromBytes([]byte("wav"), "audio/wav")
+	pdf := NewMediaFromBytes([]byte("pdf"), "application/pdf")
+
+	tests := []struct {
+		name string
+		part ContentPart
+		want string
+	}{
+		{name: "image", part: ImagePartFromMedia(image), want: `{"type":"image_url","image_url":{"url":"data:image/png;base64,cG5n"}}`},
+		{name: "audio", part: AudioPartFromMedia(audio), want: `{"type":"input_audio","input_audio":{"data":"data:audio/wav;base64,d2F2","format":"wav"}}`},
+		{name: "file", part: FilePartFromMedia(pdf, "report.pdf"), want: `{"type":"file","file":{"filename":"report.pdf","file_data":"data:application/pdf;base64,cGRm"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.part)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("got %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatFromOpenAI(t *testing.T) {
+	input, err := ChatInputFromOpenAI([]byte(`{
+		"model": "gpt-4o",
+		"messages": [
+			{"role": "system", "content": "Be brief"},
+			{"role": "user", "content": [{"type": "text", "text": "Weather?"}]}
+		],
+		"tools": [{"type": "function", "function": {"name": "get_weather"}}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ChatInput{
+		Messages: []ChatMessage{
+			{Role: ChatRoleSystem, Content: "Be brief"},
+			{Role: ChatRoleUser, Parts: []ContentPart{TextPart("Weather?")}},
+		},
+		Tools: []ToolDefinition{NewFunctionTool("get_weather", "", nil)},
+	}
+	if !reflect.DeepEqual(input, want) {
+		t.Errorf("input:\n got %+v\nwant %+v", input, want)
+	}
+
+	message, err := ChatMessageFromOpenAI([]byte(`{"choices": [{"message": {"role": "assistant", "content": null,
+		"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{}"}}]}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Content != "" || len(message.ToolCalls) != 1 || message.ToolCalls[0].Function.Name != "get_weather" {
+		t.Errorf("message = %+v", message)
+	}
+
+	if _, err := ChatMessageFromOpenAI([]byte(`{"choices": []}`)); err == nil {
+		t.Error("expected an error for a response without choices")
+	}
+}
+
+func TestChatFromAnthropic(t *testing.T) {
+	input, err := ChatInputFromAnthropic([]byte(`{
+		"system": "Be brief",
+		"messages": [
+			{"role": "user", "content": "Weather in Paris?"},
+			{"role": "assistant", "content": [{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": [{"type": "text", "text": "sunny"}]},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "cG5n"}}
+			]}
+		],
+		"tools": [{"name": "get_weather", "description": "Weather", "input_schema": {"type": "object"}}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ChatMessage{
+		{Role: ChatRoleSystem, Content: "Be brief"},
+		{Role: ChatRoleUser, Content: "Weather in Paris?"},
+		{Role: ChatRoleAssistant, ToolCalls: []ToolCall{NewToolCall("toolu_1", "get_weather", `{"city": "Paris"}`)}},
+		{Role: ChatRoleTool, Content: "sunny", ToolCallID: "toolu_1"},
+		{Role: ChatRoleUser, Parts: []ContentPart{ImagePart("data:image/png;base64,cG5n")}},
+	}
+	if !reflect.DeepEqual(input.Messages, want) {
+		t.Errorf("messages:\n got %+v\nwant %+v", input.Messages, want)
+	}
+	if len(input.Tools) != 1 || input.Tools[0].Function.Name != "get_weather" {
+		t.Errorf("tools = %+v", input.Tools)
+	}
+
+	message, err := ChatMessageFromAnthropic([]byte(`{"role": "assistant", "content": [{"type": "text", "text": "Sunny"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Role != ChatRoleAssistant || message.Content != "Sunny" {
+		t.Errorf("message = %+v", message)
+	}
+}
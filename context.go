@@ -0,0 +1,141 @@
+package langfuse
+
+import (
+	"context"
+	"time"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// traceContextKey is the context key under which the current trace is stored
+type traceContextKey struct{}
+
+// contextWithTrace returns a copy of ctx that carries the trace
+func contextWithTrace(ctx context.Context, t *Trace) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, t)
+}
+
+// TraceFromContext returns the trace carried by ctx, or nil if there is none.
+// Contexts returned by Trace.Context, Span.Context and Generation.Context
+// carry their trace.
+func TraceFromContext(ctx context.Context) *Trace {
+	t, _ := ctx.Value(traceContextKey{}).(*Trace)
+	return t
+}
+
+// spanContextKey is the context key under which a span is stored in its own
+// context
+type spanContextKey struct{}
+
+// SpanFromContext returns the span that is the current observation in ctx, or
+// nil if the current observation is not a span. Contexts returned by
+// Span.Context carry their span.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanContextKey{}).(*Span)
+	if s == nil || s.span != oteltrace.SpanFromContext(ctx) {
+		return nil
+	}
+	return s
+}
+
+// ContextWithSpan returns a copy of ctx that carries the span's trace with
+// the span as the current observation. Use it instead of Span.Context when
+// the returned context must keep the values of ctx.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	ctx = contextWithTrace(ctx, s.trace)
+	ctx = oteltrace.ContextWithSpan(ctx, s.span)
+	return context.WithValue(ctx, spanContextKey{}, s)
+}
+
+// Context returns a context carrying the trace and its root span. Pass it to
+// other goroutines to create observations under the trace with
+// Client.StartSpan, Client.StartGeneration and Client.StartEvent.
+func (t *Trace) Context() context.Context {
+	return t.ctx
+}
+
+// Context returns a context carrying the trace with the span as the current
+// observation
+func (s *Span) Context() context.Context {
+	return s.ctx
+}
+
+// Context returns a context carrying the trace with the generation as the
+// current observation
+func (g *Generation) Context() context.Context {
+	return g.ctx
+}
+
+// StartSpan creates a span under the current observation in ctx. If ctx does
+// not carry a trace, a new trace with the same name is created and ended
+// together with the span.
+func (c *Client) StartSpan(ctx context.Context, name string, opts ...SpanOption) *Span {
+	return c.startSpan(ctx, name, ObservationTypeSpan, opts)
+}
+
+// StartTool creates a tool observation under the current observation in ctx.
+// Like StartSpan, it creates a trace if ctx does not carry one.
+func (c *Client) StartTool(ctx context.Context, name string, opts ...SpanOption) *Span {
+	return c.startSpan(ctx, name, ObservationTypeTool, opts)
+}
+
+// startSpan creates a span-like observation of the given type under the
+// current observation in ctx
+func (c *Client) startSpan(ctx context.Context, name string, obsType ObservationType, opts []SpanOption) *Span {
+	t, parent, implicit := c.traceForContext(ctx, name, newStartConfig(opts).startTime)
+	s := t.startSpan(parent, name, obsType, opts)
+	s.implicitTrace = implicit
+	return s
+}
+
+// StartGeneration creates a generation under the current observation in ctx.
+// If ctx does not carry a trace, a new trace with the same name is created
+// and ended together with the generation.
+func (c *Client) StartGeneration(ctx context.Context, name string, opts ...GenerationOption) *Generation {
+	return c.startGeneration(ctx, name, ObservationTypeGeneration, opts)
+}
+
+// StartEmbedding creates an embedding observation under the current
+// observation in ctx. Like StartGeneration, it creates a trace if ctx does not
+// carry one.
+func (c *Client) StartEmbedding(ctx context.Context, name string, opts ...GenerationOption) *Generation {
+	return c.startGeneration(ctx, name, ObservationTypeEmbedding, opts)
+}
+
+// startGeneration creates a generation-like observation of the given type
+// under the current observation in ctx
+func (c *Client) startGeneration(ctx context.Context, name string, obsType ObservationType, opts []GenerationOption) *Generation {
+	t, parent, implicit := c.traceForContext(ctx, name, newStartConfig(opts).startTime)
+	g := t.startGeneration(parent, name, obsType, opts)
+	g.implicitTrace = implicit
+	return g
+}
+
+// StartEvent records an event under the current observation in ctx. If ctx
+// does not carry a trace, a new trace with the same name is created for it.
+func (c *Client) StartEvent(ctx context.Context, name string, opts ...EventOption) *Event {
+	cfg := newStartConfig(opts)
+	t, parent, implicit := c.traceForContext(ctx, name, cfg.startTime)
+	e := t.startEvent(parent, name, opts)
+	if implicit {
+		// A backfilled event keeps its trace at the event time
+		t.span.End(oteltrace.WithTimestamp(cfg.startTimeOrNow()))
+	}
+	return e
+}
+
+// traceForContext returns the trace carried by ctx and the parent context for
+// a new observation, creating a trace if there is none. A created trace starts
+// at startTime unless it is zero. The boolean reports whether a trace was
+// created.
+func (c *Client) traceForContext(ctx context.Context, name string, startTime time.Time) (*Trace, context.Context, bool) {
+	if t := TraceFromContext(ctx); t != nil && t.client == c {
+		return t, ctx, false
+	}
+	var opts []TraceOption
+	if !startTime.IsZero() {
+		opts = append(opts, WithStartTime(startTime))
+	}
+	t := c.CreateTrace(ctx, name, opts...)
+	return t, t.ctx, true
+}
@@ -0,0 +1,167 @@
+package langfuse
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStartObservationsFromContext(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+
+	trace := client.CreateTrace(context.Background(), "request")
+	span := client.StartSpan(trace.Context(), "step")
+	generation := client.StartGeneration(span.Context(), "llm")
+	client.StartEvent(generation.Context(), "token")
+	generation.End()
+	span.End()
+	trace.End()
+
+	root := findSpan(t, exporter, "request")
+	tests := []struct {
+		name   string
+		parent string
+	}{
+		{name: "step", parent: "request"},
+		{name: "llm", parent: "step"},
+		{name: "token", parent: "llm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findSpan(t, exporter, tt.name)
+			parent := findSpan(t, exporter, tt.parent)
+			if got.SpanContext.TraceID() != root.SpanContext.TraceID() {
+				t.Errorf("trace ID = %s, want %s", got.SpanContext.TraceID(), root.SpanContext.TraceID())
+			}
+			if got.Parent.SpanID() != parent.SpanContext.SpanID() {
+				t.Errorf("parent = %s, want %s", got.Parent.SpanID(), parent.SpanContext.SpanID())
+			}
+		})
+	}
+}
+
+func TestStartSpanWithoutTrace(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+
+	span := client.StartSpan(context.Background(), "standalone")
+	if TraceFromContext(span.Context()) == nil {
+		t.Fatal("span context carries no trace")
+	}
+	span.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want the span and its implicit trace", len(spans))
+	}
+	for _, s := range spans {
+		if s.Name != "standalone" {
+			t.Errorf("span named %q, want both named after the observation", s.Name)
+		}
+	}
+}
+
+func TestBackfillWithoutTrace(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	span := client.StartSpan(context.Background(), "span", WithStartTime(start))
+	if err := span.EndAt(start.Add(-time.Second)); err == nil {
+		t.Error("span accepted an end time before its start")
+	}
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Fatalf("%d spans ended despite the error", len(spans))
+	}
+	if err := span.EndAt(start.Add(time.Second)); err != nil {
+		t.Fatalf("EndAt: %v", err)
+	}
+
+	generation := client.StartGeneration(context.Background(), "generation", WithStartTime(start))
+	if err := generation.EndAt(start.Add(time.Second)); err != nil {
+		t.Fatalf("EndAt: %v", err)
+	}
+	client.StartEvent(context.Background(), "event", WithStartTime(start))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 6 {
+		t.Fatalf("got %d spans, want each observation and its implicit trace", len(spans))
+	}
+	for _, s := range spans {
+		if !s.StartTime.Equal(start) {
+			t.Errorf("%s starts at %s, want %s", s.Name, s.StartTime, start)
+		}
+		if s.EndTime.After(start.Add(time.Second)) {
+			t.Errorf("%s ends at %s, want it backfilled", s.Name, s.EndTime)
+		}
+	}
+}
+
+func TestSpanFromContext(t *testing.T) {
+	client, _ := newTestClient(t, Config{})
+	trace := client.CreateTrace(context.Background(), "request")
+	defer trace.End()
+	span := trace.CreateSpan("step")
+	defer span.End()
+
+	if got := SpanFromContext(span.Context()); got != span {
+		t.Errorf("SpanFromContext(span.Context()) = %p, want %p", got, span)
+	}
+	if got := SpanFromContext(trace.Context()); got != nil {
+		t.Errorf("SpanFromContext(trace.Context()) = %p, want nil", got)
+	}
+
+	generation := span.CreateGeneration("llm")
+	defer generation.End()
+	if got := SpanFromContext(generation.Context()); got != nil {
+		t.Errorf("a generation context returned span %p", got)
+	}
+
+	type key struct{}
+	ctx := ContextWithSpan(context.WithValue(context.Background(), key{}, "value"), span)
+	if SpanFromContext(ctx) != span || TraceFromContext(ctx) != trace || ctx.Value(key{}) != "value" {
+		t.Error("ContextWithSpan lost the span, the trace or the values of the parent context")
+	}
+}
+
+func TestPropagateTraceAttributes(t *testing.T) {
+	tests := []struct {
+		name      string
+		propagate bool
+	}{
+		{name: "enabled", propagate: true},
+		{name: "disabled", propagate: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, exporter := newTestClient(t, Config{
+				Release:                  "v1.2.3",
+				Environment:              "staging",
+				PropagateTraceAttributes: tt.propagate,
+			})
+			trace := client.CreateTrace(context.Background(), "request",
+				WithTraceUserID("user-1"),
+				WithTraceTags([]string{"beta"}),
+			)
+			trace.Update(WithTraceSessionID("session-1"))
+			trace.CreateSpan("step").End()
+			trace.End()
+
+			want := map[string]string{
+				"langfuse.user.id":     "user-1",
+				"langfuse.session.id":  "session-1",
+				"langfuse.trace.tags":  `["beta"]`,
+				"langfuse.release":     "v1.2.3",
+				"langfuse.environment": "staging",
+			}
+			step := findSpan(t, exporter, "step")
+			for key, value := range want {
+				got := stringAttr(step, key)
+				if tt.propagate && got != value {
+					t.Errorf("%s = %q, want %q", key, got, value)
+				}
+				if !tt.propagate && got != "" {
+					t.Errorf("%s = %q, want it not propagated", key, got)
+				}
+			}
+		})
+	}
+}
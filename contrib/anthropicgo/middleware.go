@@ -0,0 +1,59 @@
+// Package anthropicgo instruments the official
+// github.com/anthropics/anthropic-sdk-go client with Langfuse through its
+// request middleware.
+//
+//	client := anthropic.NewClient(anthropicgo.WithLangfuse(lf))
+//
+// Messages API calls are recorded as generations under the observation
+// carried by the request context, including streamed responses, tool use and
+// prompt caching usage. Each retry attempt is recorded as its own generation.
+//
+// The SDK also emits its own OpenTelemetry spans to the global tracer
+// provider. Since langfuse.NewClient registers its provider globally, those
+// spans appear in the same trace next to the generation.
+//
+// Request parameters are decoded into the SDK's typed params and recorded as
+// model parameters. Costs are recorded for the models given to WithPrices.
+package anthropicgo
+
+import (
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/qinrichard/langfuse"
+)
+
+// config holds the middleware settings
+type config struct {
+	prices langfuse.PriceTable
+}
+
+// Option configures the middleware
+type Option func(*config)
+
+// WithPrices records the cost of calls to the models in prices
+func WithPrices(prices langfuse.PriceTable) Option {
+	return func(c *config) {
+		c.prices = prices
+	}
+}
+
+// Middleware returns anthropic-sdk-go middleware that records calls with client
+func Middleware(client *langfuse.Client, opts ...Option) option.Middleware {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	rtOpts := []langfuse.RoundTripperOption{
+		langfuse.WithProviders(langfuse.ProviderAnthropic),
+		langfuse.WithParams(requestParams),
+	}
+	if len(cfg.prices) > 0 {
+		rtOpts = append(rtOpts, langfuse.WithCost(cfg.prices.Cost))
+	}
+	return langfuse.NewRoundTripper(client, nil, rtOpts...).Middleware
+}
+
+// WithLangfuse returns a request option that installs Middleware
+func WithLangfuse(client *langfuse.Client, opts ...Option) option.RequestOption {
+	return option.WithMiddleware(Middleware(client, opts...))
+}
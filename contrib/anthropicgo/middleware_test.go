@@ -0,0 +1,107 @@
+package anthropicgo
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/qinrichard/langfuse"
+	"github.com/qinrichard/langfuse/langfusetest"
+)
+
+// streamEvents is a Messages API stream answering with text after a cache read
+var streamEvents = []string{
+	`event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-5-20250929","content":[],"usage":{"input_tokens":10,"output_tokens":1,"cache_read_input_tokens":100}}}`,
+	`event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+	`event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+	`event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+	`event: content_block_stop
+data: {"type":"content_block_stop","index":0}`,
+	`event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":5}}`,
+	`event: message_stop
+data: {"type":"message_stop"}`,
+}
+
+func TestMiddlewareStream(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/messages", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, strings.Join(streamEvents, "\n\n")+"\n\n")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	lf, recorder := langfusetest.NewClient(t, langfuse.Config{})
+	client := anthropic.NewClient(
+		option.WithAPIKey("sk-ant-test"),
+		option.WithBaseURL(server.URL),
+		option.WithMaxRetries(0),
+		WithLangfuse(lf, WithPrices(langfuse.PriceTable{"claude-sonnet-4-5": {Input: 3, CacheRead: 0.3, Output: 15}})),
+	)
+
+	trace := lf.CreateTrace(context.Background(), "test")
+	stream := client.Messages.NewStreaming(trace.Context(), anthropic.MessageNewParams{
+		Model:     anthropic.ModelClaudeSonnet4_5,
+		MaxTokens: 1024,
+		Messages:  []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("hi"))},
+		TopK:      anthropic.Int(40),
+		Thinking:  anthropic.ThinkingConfigParamOfEnabled(2048),
+	})
+	var text strings.Builder
+	for stream.Next() {
+		if delta, ok := stream.Current().AsAny().(anthropic.ContentBlockDeltaEvent); ok {
+			text.WriteString(delta.Delta.Text)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+	if text.String() != "Hello" {
+		t.Errorf("caller got %q", text.String())
+	}
+
+	trace.End()
+	if err := lf.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	attrs := langfusetest.Attrs(recorder.Find(t, "Anthropic-message"))
+	want := map[string]string{
+		"langfuse.observation.model.name":           "claude-sonnet-4-5-20250929",
+		"langfuse.observation.model.parameters":     `{"max_tokens":1024,"thinking":{"budget_tokens":2048,"type":"enabled"},"top_k":40}`,
+		"langfuse.observation.input":                `{"messages":[{"role":"user","content":"hi"}]}`,
+		"langfuse.observation.output":               `{"role":"assistant","content":"Hello"}`,
+		"langfuse.observation.usage_details":        `{"cache_read_input_tokens":100,"input":10,"output":5,"total":115}`,
+		"langfuse.observation.metadata.stop_reason": "end_turn",
+	}
+	for key, value := range want {
+		if attrs[key] != value {
+			t.Errorf("%s = %s, want %s", key, attrs[key], value)
+		}
+	}
+	if attrs["langfuse.observation.completion_start_time"] == "" {
+		t.Error("completion start time not recorded")
+	}
+
+	// 10 input tokens at $3, 100 cache reads at $0.30 and 5 output tokens at $15 per million
+	var cost langfuse.Cost
+	if err := json.Unmarshal([]byte(attrs["langfuse.observation.cost_details"]), &cost); err != nil {
+		t.Fatalf("cost details: %v", err)
+	}
+	if math.Abs(cost.Input-60e-6) > 1e-12 || math.Abs(cost.Output-75e-6) > 1e-12 || math.Abs(cost.Total-135e-6) > 1e-12 {
+		t.Errorf("cost = %+v", cost)
+	}
+}
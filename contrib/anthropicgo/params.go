@@ -0,0 +1,73 @@
+package anthropicgo
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/packages/param"
+	"github.com/qinrichard/langfuse"
+)
+
+// requestParams decodes Messages API requests into the SDK's typed parameters
+// and maps them to Langfuse generation parameters
+func requestParams(req *http.Request, body []byte) (langfuse.GenerationParams, bool) {
+	if !strings.HasSuffix(strings.TrimSuffix(req.URL.Path, "/"), "/v1/messages") {
+		return langfuse.GenerationParams{}, false
+	}
+	var params anthropic.MessageNewParams
+	if err := params.UnmarshalJSON(body); err != nil {
+		return langfuse.GenerationParams{}, false
+	}
+	return messageParams(params), true
+}
+
+// messageParams maps the parameters of a Messages API request. The output
+// effort is recorded as reasoning_effort and the output format as
+// response_format.
+func messageParams(p anthropic.MessageNewParams) langfuse.GenerationParams {
+	params := langfuse.GenerationParams{
+		Temperature:     optFloat(p.Temperature),
+		TopP:            optFloat(p.TopP),
+		TopK:            optInt(p.TopK),
+		Stop:            p.StopSequences,
+		ReasoningEffort: string(p.OutputConfig.Effort),
+	}
+	if p.MaxTokens > 0 {
+		maxTokens := int(p.MaxTokens)
+		params.MaxTokens = &maxTokens
+	}
+	if !param.IsOmitted(p.OutputConfig.Format) {
+		params.ResponseFormat = p.OutputConfig.Format
+	}
+	if !param.IsOmitted(p.ToolChoice) {
+		params.ToolChoice = p.ToolChoice
+	}
+
+	other := map[string]interface{}{}
+	if !param.IsOmitted(p.Thinking) {
+		other["thinking"] = p.Thinking
+	}
+	if p.ServiceTier != "" {
+		other["service_tier"] = p.ServiceTier
+	}
+	if len(other) > 0 {
+		params.Other = other
+	}
+	return params
+}
+
+func optFloat(o param.Opt[float64]) *float64 {
+	if !o.Valid() {
+		return nil
+	}
+	return &o.Value
+}
+
+func optInt(o param.Opt[int64]) *int {
+	if !o.Valid() {
+		return nil
+	}
+	v := int(o.Value)
+	return &v
+}
@@ -0,0 +1,585 @@
+// Package eino records github.com/cloudwego/eino runs in Langfuse through a
+// callbacks.Handler.
+//
+//	callbacks.AppendGlobalHandlers(eino.NewHandler(client))
+//
+// or, for a single run,
+//
+//	runnable.Invoke(ctx, input, compose.WithCallbacks(eino.NewHandler(client)))
+//
+// Graphs, chains and workflows become chain spans, chat models generations,
+// embedders embedding observations, tools tool spans, retrievers retriever
+// spans and all other nodes plain spans. Observations are nested through the
+// context Eino threads between callbacks, under the current span or trace of
+// the context passed to the run. Runs started without a trace in their
+// context get a trace of their own.
+package eino
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/qinrichard/langfuse"
+)
+
+// Handler is a callbacks.Handler that records Eino components as Langfuse
+// observations. It is safe for concurrent runs.
+type Handler struct {
+	client *langfuse.Client
+}
+
+var _ callbacks.Handler = (*Handler)(nil)
+
+// NewHandler creates a handler that records observations with client
+func NewHandler(client *langfuse.Client) *Handler {
+	return &Handler{client: client}
+}
+
+// runContextKey is the context key under which the run started by OnStart is
+// stored for the matching OnEnd or OnError
+type runContextKey struct{}
+
+// parent creates observations; both *langfuse.Trace and *langfuse.Span
+// implement it
+type parent interface {
+	CreateSpan(name string, opts ...langfuse.SpanOption) *langfuse.Span
+	CreateGeneration(name string, opts ...langfuse.GenerationOption) *langfuse.Generation
+	CreateEmbedding(name string, opts ...langfuse.GenerationOption) *langfuse.Generation
+	CreateChain(name string, opts ...langfuse.SpanOption) *langfuse.Span
+	CreateTool(name string, opts ...langfuse.SpanOption) *langfuse.Span
+	CreateRetriever(name string, opts ...langfuse.SpanOption) *langfuse.Span
+}
+
+// run is the observation of one component invocation. Exactly one of span
+// and generation is set.
+type run struct {
+	info       callbacks.RunInfo
+	span       *langfuse.Span
+	generation *langfuse.Generation
+
+	// trace is set if the run created its own trace, which ends with it
+	trace *langfuse.Trace
+
+	mu    sync.Mutex
+	ended bool
+}
+
+// OnStart starts an observation for the component
+func (h *Handler) OnStart(ctx context.Context, info *callbacks.RunInfo, input callbacks.CallbackInput) context.Context {
+	return h.start(ctx, info, input)
+}
+
+// OnStartWithStreamInput starts an observation for a component that consumes
+// a stream. The input is recorded once the stream has been read to the end.
+func (h *Handler) OnStartWithStreamInput(ctx context.Context, info *callbacks.RunInfo, input *schema.StreamReader[callbacks.CallbackInput]) context.Context {
+	ctx = h.start(ctx, info, nil)
+	r := runFromContext(ctx, info)
+	go func() {
+		defer input.Close()
+		var chunks []interface{}
+		for {
+			chunk, err := input.Recv()
+			if err != nil {
+				break
+			}
+			chunks = append(chunks, chunk)
+		}
+		if r != nil {
+			r.setInput(chunks)
+		}
+	}()
+	return ctx
+}
+
+// OnEnd records the component output and ends its observation
+func (h *Handler) OnEnd(ctx context.Context, info *callbacks.RunInfo, output callbacks.CallbackOutput) context.Context {
+	if r := runFromContext(ctx, info); r != nil {
+		r.end(output, nil, time.Time{})
+	}
+	return ctx
+}
+
+// OnEndWithStreamOutput records a streamed output once the stream has been
+// read to the end and then ends the observation. The stream is consumed in
+// the background.
+func (h *Handler) OnEndWithStreamOutput(ctx context.Context, info *callbacks.RunInfo, output *schema.StreamReader[callbacks.CallbackOutput]) context.Context {
+	r := runFromContext(ctx, info)
+	if r == nil {
+		output.Close()
+		return ctx
+	}
+	go r.consume(output)
+	return ctx
+}
+
+// OnError records the error and ends the observation
+func (h *Handler) OnError(ctx context.Context, info *callbacks.RunInfo, err error) context.Context {
+	if r := runFromContext(ctx, info); r != nil {
+		r.end(nil, err, time.Time{})
+	}
+	return ctx
+}
+
+// start creates the observation for a component and returns a context
+// carrying it
+func (h *Handler) start(ctx context.Context, info *callbacks.RunInfo, input callbacks.CallbackInput) context.Context {
+	if info == nil {
+		return ctx
+	}
+	name := runName(info)
+	r := &run{info: *info}
+
+	var p parent
+	if span := langfuse.SpanFromContext(ctx); span != nil {
+		p = span
+	} else if trace := langfuse.TraceFromContext(ctx); trace != nil {
+		p = trace
+	} else {
+		r.trace = h.client.CreateTrace(ctx, name, langfuse.WithTraceInput(input))
+		p = r.trace
+	}
+
+	switch info.Component {
+	case components.ComponentOfChatModel:
+		r.generation = p.CreateGeneration(name, chatModelInput(input)...)
+	case components.ComponentOfEmbedding:
+		r.generation = p.CreateEmbedding(name, embeddingInput(input)...)
+	case components.ComponentOfTool:
+		r.span = p.CreateTool(name, toolInput(ctx, info, input)...)
+	case components.ComponentOfRetriever:
+		r.span = p.CreateRetriever(name, retrieverInput(input)...)
+	case compose.ComponentOfGraph, compose.ComponentOfChain, compose.ComponentOfWorkflow:
+		r.span = p.CreateChain(name, spanInput(input)...)
+	case components.ComponentOfPrompt:
+		r.span = p.CreateSpan(name, promptInput(input)...)
+	default:
+		r.span = p.CreateSpan(name, spanInput(input)...)
+	}
+
+	ctx = context.WithValue(ctx, runContextKey{}, r)
+	if r.span != nil {
+		ctx = langfuse.ContextWithSpan(ctx, r.span)
+	}
+	return ctx
+}
+
+// runFromContext returns the run started for info, or nil if ctx carries the
+// run of another component
+func runFromContext(ctx context.Context, info *callbacks.RunInfo) *run {
+	r, _ := ctx.Value(runContextKey{}).(*run)
+	if r == nil || info == nil || r.info != *info {
+		return nil
+	}
+	return r
+}
+
+// runName names the observation of a component. Eino leaves the name empty
+// unless it is set on the node, so the implementation type and component
+// kind are used instead, e.g. "OpenAIChatModel".
+func runName(info *callbacks.RunInfo) string {
+	if info.Name != "" {
+		return info.Name
+	}
+	if name := info.Type + string(info.Component); name != "" {
+		return name
+	}
+	return "eino"
+}
+
+// setInput records an input that became available after the observation
+// started
+func (r *run) setInput(chunks []interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ended || len(chunks) == 0 {
+		return
+	}
+	var input interface{} = chunks
+	if len(chunks) == 1 {
+		input = chunks[0]
+	}
+	if r.span != nil {
+		r.span.Update(langfuse.WithSpanInput(input))
+	} else {
+		r.generation.Update(langfuse.WithGenerationInput(input))
+	}
+}
+
+// consume reads a streamed output to the end and ends the observation with
+// the concatenated output. Chat model chunks are merged into one message.
+func (r *run) consume(output *schema.StreamReader[callbacks.CallbackOutput]) {
+	defer output.Close()
+
+	var (
+		chunks   []callbacks.CallbackOutput
+		messages []*schema.Message
+		usage    *model.TokenUsage
+		config   *model.Config
+		firstAt  time.Time
+		err      error
+	)
+	for {
+		chunk, recvErr := output.Recv()
+		if errors.Is(recvErr, io.EOF) {
+			break
+		}
+		if recvErr != nil {
+			err = recvErr
+			break
+		}
+		if firstAt.IsZero() {
+			firstAt = time.Now()
+		}
+		if r.info.Component != components.ComponentOfChatModel {
+			chunks = append(chunks, chunk)
+			continue
+		}
+		if out := model.ConvCallbackOutput(chunk); out != nil {
+			if out.Message != nil {
+				messages = append(messages, out.Message)
+			}
+			if out.TokenUsage != nil {
+				usage = out.TokenUsage
+			}
+			if out.Config != nil {
+				config = out.Config
+			}
+		}
+	}
+
+	var result callbacks.CallbackOutput
+	switch {
+	case r.info.Component == components.ComponentOfChatModel:
+		out := &model.CallbackOutput{TokenUsage: usage, Config: config}
+		if len(messages) > 0 {
+			if message, concatErr := schema.ConcatMessages(messages); concatErr == nil {
+				out.Message = message
+			}
+		}
+		result = out
+	case r.info.Component == components.ComponentOfTool:
+		var response string
+		for _, chunk := range chunks {
+			if out := tool.ConvCallbackOutput(chunk); out != nil {
+				response += out.Response
+			}
+		}
+		result = response
+	case len(chunks) == 1:
+		result = chunks[0]
+	case len(chunks) > 1:
+		result = concatChunks(chunks)
+	}
+	r.end(result, err, firstAt)
+}
+
+// concatChunks merges streamed message chunks into one message. Other
+// chunks are recorded as a list.
+func concatChunks(chunks []callbacks.CallbackOutput) callbacks.CallbackOutput {
+	messages := make([]*schema.Message, 0, len(chunks))
+	for _, chunk := range chunks {
+		message, ok := chunk.(*schema.Message)
+		if !ok {
+			return chunks
+		}
+		messages = append(messages, message)
+	}
+	if message, err := schema.ConcatMessages(messages); err == nil {
+		return message
+	}
+	return chunks
+}
+
+// end records the output or error of the run and ends its observation
+// exactly once. firstAt is the time the first streamed chunk arrived.
+func (r *run) end(output callbacks.CallbackOutput, err error, firstAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ended {
+		return
+	}
+	r.ended = true
+
+	if r.generation != nil {
+		var opts []langfuse.GenerationOption
+		if output != nil {
+			if r.info.Component == components.ComponentOfEmbedding {
+				opts = embeddingOutput(output)
+			} else {
+				opts = chatModelOutput(output)
+			}
+		}
+		if !firstAt.IsZero() {
+			opts = append(opts, langfuse.WithGenerationStartTime(firstAt))
+		}
+		if err != nil {
+			opts = append(opts,
+				langfuse.WithGenerationLevel(langfuse.LogLevelError),
+				langfuse.WithGenerationStatusMessage(err.Error()),
+			)
+		}
+		r.generation.Update(opts...)
+		r.generation.End()
+	} else {
+		var opts []langfuse.SpanOption
+		if output != nil {
+			switch r.info.Component {
+			case components.ComponentOfTool:
+				opts = toolOutput(output)
+			case components.ComponentOfRetriever:
+				opts = retrieverOutput(output)
+			case components.ComponentOfPrompt:
+				opts = promptOutput(output)
+			default:
+				opts = []langfuse.SpanOption{langfuse.WithSpanOutput(output)}
+			}
+		}
+		if err != nil {
+			opts = append(opts,
+				langfuse.WithSpanLevel(langfuse.LogLevelError),
+				langfuse.WithSpanStatusMessage(err.Error()),
+			)
+		}
+		r.span.Update(opts...)
+		r.span.End()
+	}
+
+	if r.trace != nil {
+		if output != nil {
+			r.trace.Update(langfuse.WithTraceOutput(output))
+		}
+		r.trace.End()
+	}
+}
+
+// chatModelInput maps a chat model callback input onto generation options
+func chatModelInput(input callbacks.CallbackInput) []langfuse.GenerationOption {
+	in := model.ConvCallbackInput(input)
+	if in == nil {
+		return nil
+	}
+
+	chat := langfuse.ChatInput{Messages: chatMessages(in.Messages)}
+	for _, info := range in.Tools {
+		chat.Tools = append(chat.Tools, toolDefinition(info))
+	}
+	opts := []langfuse.GenerationOption{langfuse.WithGenerationInput(chat)}
+
+	var params langfuse.GenerationParams
+	if in.ToolChoice != nil {
+		params.ToolChoice = string(*in.ToolChoice)
+	}
+	if c := in.Config; c != nil {
+		opts = append(opts, langfuse.WithGenerationModel(c.Model))
+		if c.MaxTokens != 0 {
+			params.MaxTokens = &c.MaxTokens
+		}
+		if c.Temperature != 0 {
+			params.Temperature = float64Ptr(c.Temperature)
+		}
+		if c.TopP != 0 {
+			params.TopP = float64Ptr(c.TopP)
+		}
+		params.Stop = c.Stop
+	}
+	return append(opts, langfuse.WithGenerationParams(params))
+}
+
+// chatModelOutput maps a chat model callback output onto generation options
+func chatModelOutput(output callbacks.CallbackOutput) []langfuse.GenerationOption {
+	out := model.ConvCallbackOutput(output)
+	if out == nil {
+		return nil
+	}
+
+	var opts []langfuse.GenerationOption
+	if out.Config != nil && out.Config.Model != "" {
+		opts = append(opts, langfuse.WithGenerationModel(out.Config.Model))
+	}
+	if out.Message != nil {
+		opts = append(opts, langfuse.WithGenerationOutput(chatMessage(out.Message)))
+		if meta := out.Message.ResponseMeta; meta != nil && meta.FinishReason != "" {
+			opts = append(opts, langfuse.WithGenerationMetadata(map[string]interface{}{
+				"finish_reason": meta.FinishReason,
+			}))
+		}
+	}
+
+	usage := out.TokenUsage
+	if usage == nil && out.Message != nil && out.Message.ResponseMeta != nil && out.Message.ResponseMeta.Usage != nil {
+		u := out.Message.ResponseMeta.Usage
+		usage = &model.TokenUsage{
+			PromptTokens:            u.PromptTokens,
+			PromptTokenDetails:      model.PromptTokenDetails{CachedTokens: u.PromptTokenDetails.CachedTokens},
+			CompletionTokens:        u.CompletionTokens,
+			TotalTokens:             u.TotalTokens,
+			CompletionTokensDetails: model.CompletionTokensDetails{ReasoningTokens: u.CompletionTokensDetails.ReasoningTokens},
+		}
+	}
+	if usage != nil {
+		details := langfuse.NewUsageDetails(usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens, map[string]int{
+			"input_cached_tokens":     usage.PromptTokenDetails.CachedTokens,
+			"output_reasoning_tokens": usage.CompletionTokensDetails.ReasoningTokens,
+		})
+		opts = append(opts, langfuse.WithGenerationUsageDetails(details))
+	}
+	return opts
+}
+
+// embeddingInput maps an embedder callback input onto generation options
+func embeddingInput(input callbacks.CallbackInput) []langfuse.GenerationOption {
+	in := embedding.ConvCallbackInput(input)
+	if in == nil {
+		return nil
+	}
+	opts := []langfuse.GenerationOption{langfuse.WithEmbeddingInputs(in.Texts)}
+	if in.Config != nil {
+		opts = append(opts, langfuse.WithGenerationModel(in.Config.Model))
+	}
+	return opts
+}
+
+// embeddingOutput maps an embedder callback output onto generation options.
+// The vectors themselves are not recorded, only their count and dimensions.
+func embeddingOutput(output callbacks.CallbackOutput) []langfuse.GenerationOption {
+	out := embedding.ConvCallbackOutput(output)
+	if out == nil {
+		return nil
+	}
+
+	result := map[string]int{"embeddings": len(out.Embeddings)}
+	if len(out.Embeddings) > 0 {
+		result["dimensions"] = len(out.Embeddings[0])
+	}
+	opts := []langfuse.GenerationOption{langfuse.WithGenerationOutput(result)}
+	if out.Config != nil && out.Config.Model != "" {
+		opts = append(opts, langfuse.WithGenerationModel(out.Config.Model))
+	}
+	if u := out.TokenUsage; u != nil {
+		opts = append(opts, langfuse.WithGenerationUsageDetails(map[string]int{
+			"input":  u.PromptTokens,
+			"output": u.CompletionTokens,
+			"total":  u.TotalTokens,
+		}))
+	}
+	return opts
+}
+
+// toolInput maps a tool callback input onto span options
+func toolInput(ctx context.Context, info *callbacks.RunInfo, input callbacks.CallbackInput) []langfuse.SpanOption {
+	var opts []langfuse.SpanOption
+	if info.Name != "" {
+		opts = append(opts, langfuse.WithToolName(info.Name))
+	}
+	if id := compose.GetToolCallID(ctx); id != "" {
+		opts = append(opts, langfuse.WithToolCallID(id))
+	}
+	if in := tool.ConvCallbackInput(input); in != nil {
+		opts = append(opts, langfuse.WithToolArguments(rawJSON(in.ArgumentsInJSON)))
+	}
+	return opts
+}
+
+// toolOutput maps a tool callback output onto span options
+func toolOutput(output callbacks.CallbackOutput) []langfuse.SpanOption {
+	out := tool.ConvCallbackOutput(output)
+	if out == nil {
+		return nil
+	}
+	if out.ToolOutput != nil {
+		return []langfuse.SpanOption{langfuse.WithToolResult(out.ToolOutput)}
+	}
+	return []langfuse.SpanOption{langfuse.WithToolResult(out.Response)}
+}
+
+// retrieverInput maps a retriever callback input onto span options
+func retrieverInput(input callbacks.CallbackInput) []langfuse.SpanOption {
+	in := retriever.ConvCallbackInput(input)
+	if in == nil {
+		return nil
+	}
+
+	opts := []langfuse.SpanOption{langfuse.WithRetrieverQuery(in.Query)}
+	metadata := map[string]interface{}{}
+	if in.TopK > 0 {
+		metadata["top_k"] = strconv.Itoa(in.TopK)
+	}
+	if in.Filter != "" {
+		metadata["filter"] = in.Filter
+	}
+	if in.ScoreThreshold != nil {
+		metadata["score_threshold"] = strconv.FormatFloat(*in.ScoreThreshold, 'g', -1, 64)
+	}
+	if len(metadata) > 0 {
+		opts = append(opts, langfuse.WithSpanMetadata(metadata))
+	}
+	return opts
+}
+
+// retrieverOutput maps a retriever callback output onto span options
+func retrieverOutput(output callbacks.CallbackOutput) []langfuse.SpanOption {
+	out := retriever.ConvCallbackOutput(output)
+	if out == nil {
+		return nil
+	}
+
+	documents := make([]langfuse.RetrievedDocument, 0, len(out.Docs))
+	for _, doc := range out.Docs {
+		if doc == nil {
+			continue
+		}
+		document := langfuse.RetrievedDocument{
+			ID:       doc.ID,
+			Content:  doc.Content,
+			Metadata: doc.MetaData,
+		}
+		if _, ok := doc.MetaData["_score"]; ok {
+			score := doc.Score()
+			document.Score = &score
+		}
+		documents = append(documents, document)
+	}
+	return []langfuse.SpanOption{langfuse.WithRetrievedDocuments(documents)}
+}
+
+// promptInput maps a chat template callback input onto span options
+func promptInput(input callbacks.CallbackInput) []langfuse.SpanOption {
+	if in := prompt.ConvCallbackInput(input); in != nil {
+		return []langfuse.SpanOption{langfuse.WithSpanInput(in.Variables)}
+	}
+	return nil
+}
+
+// promptOutput maps a chat template callback output onto span options
+func promptOutput(output callbacks.CallbackOutput) []langfuse.SpanOption {
+	if out := prompt.ConvCallbackOutput(output); out != nil {
+		return []langfuse.SpanOption{langfuse.WithSpanOutput(chatMessages(out.Result))}
+	}
+	return nil
+}
+
+// spanInput records an input as is
+func spanInput(input callbacks.CallbackInput) []langfuse.SpanOption {
+	if input == nil {
+		return nil
+	}
+	return []langfuse.SpanOption{langfuse.WithSpanInput(input)}
+}
+
+func float64Ptr(f float32) *float64 {
+	v := float64(f)
+	return &v
+}
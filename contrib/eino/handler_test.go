@@ -0,0 +1,209 @@
+package eino
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/callbacks"
+	"github.com/cloudwego/eino/components"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/retriever"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/qinrichard/langfuse"
+	"github.com/qinrichard/langfuse/langfusetest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// find returns the recorded span with the given name and observation type,
+// which is empty for trace roots
+func find(t *testing.T, recorder *langfusetest.Recorder, name, obsType string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, span := range recorder.Named(name) {
+		if langfusetest.Attrs(span)["langfuse.observation.type"] == obsType {
+			return span
+		}
+	}
+	t.Fatalf("%s %q not recorded", obsType, name)
+	return nil
+}
+
+// newTestHandler returns a handler and a function that flushes its client
+// and returns the recorded spans
+func newTestHandler(t *testing.T) (*Handler, func() *langfusetest.Recorder) {
+	client, recorder := langfusetest.NewClient(t, langfuse.Config{})
+	return NewHandler(client), func() *langfusetest.Recorder {
+		if err := client.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return recorder
+	}
+}
+
+// waitEnded waits until the run started for info in ctx has ended
+func waitEnded(t *testing.T, ctx context.Context, info *callbacks.RunInfo) {
+	t.Helper()
+	r := runFromContext(ctx, info)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		r.mu.Lock()
+		ended := r.ended
+		r.mu.Unlock()
+		if ended {
+			return
+		}
+	}
+	t.Fatal("run did not end")
+}
+
+func TestHandlerRun(t *testing.T) {
+	h, flush := newTestHandler(t)
+	graph := &callbacks.RunInfo{Name: "agent", Component: compose.ComponentOfGraph}
+	chatModel := &callbacks.RunInfo{Type: "OpenAI", Component: components.ComponentOfChatModel}
+	search := &callbacks.RunInfo{Name: "search", Component: components.ComponentOfRetriever}
+
+	threshold := 0.5
+	graphCtx := h.OnStart(context.Background(), graph, "question")
+	retrieverCtx := h.OnStart(graphCtx, search, &retriever.CallbackInput{Query: "weather", TopK: 5, ScoreThreshold: &threshold})
+	h.OnEnd(retrieverCtx, search, &retriever.CallbackOutput{Docs: []*schema.Document{{ID: "d1", Content: "sunny"}}})
+	modelCtx := h.OnStart(graphCtx, chatModel, &model.CallbackInput{
+		Messages: []*schema.Message{schema.UserMessage("weather?")},
+		Config:   &model.Config{Model: "gpt-4o", Temperature: 0.5},
+	})
+	h.OnEnd(modelCtx, chatModel, &model.CallbackOutput{
+		Message: schema.AssistantMessage("Sunny", nil),
+		TokenUsage: &model.TokenUsage{
+			PromptTokens:       100,
+			PromptTokenDetails: model.PromptTokenDetails{CachedTokens: 30},
+			CompletionTokens:   10,
+			TotalTokens:        110,
+		},
+	})
+	h.OnEnd(graphCtx, graph, "Sunny")
+	recorder := flush()
+
+	trace := find(t, recorder, "agent", "")
+	agent := find(t, recorder, "agent", "chain")
+	tests := []struct {
+		name    string
+		obsType string
+		parent  sdktrace.ReadOnlySpan
+		want    map[string]string
+	}{
+		{
+			name:    "agent",
+			obsType: "chain",
+			parent:  trace,
+			want: map[string]string{
+				"langfuse.observation.input":  `"question"`,
+				"langfuse.observation.output": `"Sunny"`,
+			},
+		},
+		{
+			name:    "search",
+			obsType: "retriever",
+			parent:  agent,
+			want: map[string]string{
+				"langfuse.observation.input":                    `"weather"`,
+				"langfuse.observation.output":                   `{"documents":[{"id":"d1","content":"sunny"}]}`,
+				"langfuse.observation.metadata.top_k":           "5",
+				"langfuse.observation.metadata.score_threshold": "0.5",
+			},
+		},
+		{
+			name:    "OpenAIChatModel",
+			obsType: "generation",
+			parent:  agent,
+			want: map[string]string{
+				"langfuse.observation.model.name":       "gpt-4o",
+				"langfuse.observation.model.parameters": `{"temperature":0.5}`,
+				"langfuse.observation.input":            `{"messages":[{"role":"user","content":"weather?"}]}`,
+				"langfuse.observation.output":           `{"role":"assistant","content":"Sunny"}`,
+				"langfuse.observation.usage_details":    `{"input":70,"input_cached_tokens":30,"output":10,"total":110}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span := find(t, recorder, tt.name, tt.obsType)
+			if span.Parent().SpanID() != tt.parent.SpanContext().SpanID() {
+				t.Errorf("parent is not %s", tt.parent.Name())
+			}
+			got := langfusetest.Attrs(span)
+			for key, value := range tt.want {
+				if got[key] != value {
+					t.Errorf("%s = %s, want %s", key, got[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerUsesContextTrace(t *testing.T) {
+	h, flush := newTestHandler(t)
+	trace := h.client.CreateTrace(context.Background(), "request")
+	info := &callbacks.RunInfo{Name: "node", Component: "Lambda"}
+
+	ctx := h.OnStart(trace.Context(), info, map[string]string{"k": "v"})
+	h.OnError(ctx, info, errors.New("node failed"))
+	trace.End()
+	recorder := flush()
+
+	node := find(t, recorder, "node", "span")
+	if node.Parent().SpanID() != find(t, recorder, "request", "").SpanContext().SpanID() {
+		t.Error("node is not a child of the context trace")
+	}
+	got := langfusetest.Attrs(node)
+	if got["langfuse.observation.level"] != string(langfuse.LogLevelError) || got["langfuse.observation.status_message"] != "node failed" {
+		t.Errorf("level %q, status message %q", got["langfuse.observation.level"], got["langfuse.observation.status_message"])
+	}
+}
+
+func TestHandlerStreamOutput(t *testing.T) {
+	h, flush := newTestHandler(t)
+	trace := h.client.CreateTrace(context.Background(), "request")
+	info := &callbacks.RunInfo{Name: "chat", Component: components.ComponentOfChatModel}
+
+	ctx := h.OnStart(trace.Context(), info, &model.CallbackInput{Messages: []*schema.Message{schema.UserMessage("hi")}})
+	reader, writer := schema.Pipe[callbacks.CallbackOutput](3)
+	h.OnEndWithStreamOutput(ctx, info, reader)
+	writer.Send(&model.CallbackOutput{Message: schema.AssistantMessage("Hel", nil)}, nil)
+	writer.Send(&model.CallbackOutput{Message: schema.AssistantMessage("lo", nil)}, nil)
+	writer.Send(&model.CallbackOutput{TokenUsage: &model.TokenUsage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}}, nil)
+	writer.Close()
+	waitEnded(t, ctx, info)
+	trace.End()
+
+	got := langfusetest.Attrs(find(t, flush(), "chat", "generation"))
+	want := map[string]string{
+		"langfuse.observation.output":        `{"role":"assistant","content":"Hello"}`,
+		"langfuse.observation.usage_details": `{"input":3,"output":2,"total":5}`,
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %s, want %s", key, got[key], value)
+		}
+	}
+	if got["langfuse.observation.completion_start_time"] == "" {
+		t.Error("completion start time not recorded")
+	}
+}
+
+func TestRunName(t *testing.T) {
+	tests := []struct {
+		info callbacks.RunInfo
+		want string
+	}{
+		{info: callbacks.RunInfo{Name: "planner", Type: "OpenAI", Component: components.ComponentOfChatModel}, want: "planner"},
+		{info: callbacks.RunInfo{Type: "OpenAI", Component: components.ComponentOfChatModel}, want: "OpenAIChatModel"},
+		{info: callbacks.RunInfo{}, want: "eino"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := runName(&tt.info); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package eino
+
+import (
+	"encoding/json"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/qinrichard/langfuse"
+)
+
+// chatMessages converts Eino messages into chat messages
+func chatMessages(messages []*schema.Message) []langfuse.ChatMessage {
+	result := make([]langfuse.ChatMessage, 0, len(messages))
+	for _, m := range messages {
+		if m != nil {
+			result = append(result, chatMessage(m))
+		}
+	}
+	return result
+}
+
+// chatMessage converts an Eino message into a chat message. Text-only
+// content is kept as a plain string; images are recorded as image parts.
+func chatMessage(m *schema.Message) langfuse.ChatMessage {
+	msg := langfuse.ChatMessage{
+		Role:       string(m.Role),
+		Content:    m.Content,
+		Name:       m.Name,
+		ToolCallID: m.ToolCallID,
+	}
+	if m.Role == schema.Tool && m.ToolName != "" {
+		msg.Name = m.ToolName
+	}
+
+	var parts []langfuse.ContentPart
+	for _, part := range m.MultiContent {
+		switch {
+		case part.Type == schema.ChatMessagePartTypeText:
+			parts = append(parts, langfuse.TextPart(part.Text))
+		case part.ImageURL != nil:
+			image := langfuse.ImagePart(part.ImageURL.URL)
+			image.ImageURL.Detail = string(part.ImageURL.Detail)
+			parts = append(parts, image)
+		}
+	}
+	for _, part := range m.UserInputMultiContent {
+		switch {
+		case part.Type == schema.ChatMessagePartTypeText:
+			parts = append(parts, langfuse.TextPart(part.Text))
+		case part.Image != nil:
+			image := langfuse.ImagePart(partURL(part.Image.MessagePartCommon))
+			image.ImageURL.Detail = string(part.Image.Detail)
+			parts = append(parts, image)
+		}
+	}
+	for _, part := range m.AssistantGenMultiContent {
+		switch {
+		case part.Type == schema.ChatMessagePartTypeText:
+			parts = append(parts, langfuse.TextPart(part.Text))
+		case part.Image != nil:
+			parts = append(parts, langfuse.ImagePart(partURL(part.Image.MessagePartCommon)))
+		}
+	}
+	if len(parts) > 0 {
+		if m.Content != "" {
+			parts = append([]langfuse.ContentPart{langfuse.TextPart(m.Content)}, parts...)
+		}
+		msg.Parts = parts
+	}
+
+	for _, tc := range m.ToolCalls {
+		msg.ToolCalls = append(msg.ToolCalls, langfuse.NewToolCall(tc.ID, tc.Function.Name, tc.Function.Arguments))
+	}
+	return msg
+}
+
+// partURL returns the URL of a multimodal part, building a data URI for
+// inline data
+func partURL(part schema.MessagePartCommon) string {
+	if part.URL != nil {
+		return *part.URL
+	}
+	if part.Base64Data != nil {
+		return "data:" + part.MIMEType + ";base64," + *part.Base64Data
+	}
+	return ""
+}
+
+// toolDefinition converts an Eino tool description into a tool definition
+func toolDefinition(info *schema.ToolInfo) langfuse.ToolDefinition {
+	if info == nil {
+		return langfuse.ToolDefinition{}
+	}
+	var parameters interface{}
+	if info.ParamsOneOf != nil {
+		if s, err := info.ParamsOneOf.ToJSONSchema(); err == nil {
+			parameters = s
+		}
+	}
+	return langfuse.NewFunctionTool(info.Name, info.Desc, parameters)
+}
+
+// rawJSON returns s as raw JSON if it is valid, so that tool arguments are
+// recorded as objects rather than strings
+func rawJSON(s string) interface{} {
+	if json.Valid([]byte(s)) {
+		return json.RawMessage(s)
+	}
+	return s
+}
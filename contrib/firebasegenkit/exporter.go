@@ -0,0 +1,53 @@
+package firebasegenkit
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// exporter maps Genkit spans before passing them to the wrapped exporter
+type exporter struct {
+	sdktrace.SpanExporter
+}
+
+// NewExporter wraps next with an exporter that translates Genkit spans into
+// Langfuse observations. Other spans are exported unchanged. It matches
+// langfuse.Config.WrapExporter.
+func NewExporter(next sdktrace.SpanExporter) sdktrace.SpanExporter {
+	return exporter{SpanExporter: next}
+}
+
+func (e exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	mapped := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, span := range spans {
+		attrs := mapSpan(span)
+		if attrs == nil {
+			mapped[i] = span
+			continue
+		}
+		mapped[i] = mappedSpan{ReadOnlySpan: span, attrs: attrs}
+	}
+	return e.SpanExporter.ExportSpans(ctx, mapped)
+}
+
+// mappedSpan is a Genkit span with Langfuse attributes
+type mappedSpan struct {
+	sdktrace.ReadOnlySpan
+	attrs []attribute.KeyValue
+}
+
+// Attributes returns the span attributes with the Langfuse attributes
+// applied. The raw Genkit input and output are dropped since they are
+// recorded as the observation's input and output.
+func (s mappedSpan) Attributes() []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for _, kv := range s.ReadOnlySpan.Attributes() {
+		if kv.Key != attrInput && kv.Key != attrOutput {
+			attrs = append(attrs, kv)
+		}
+	}
+	set := attribute.NewSet(append(attrs, s.attrs...)...)
+	return set.ToSlice()
+}
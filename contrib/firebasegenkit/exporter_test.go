@@ -0,0 +1,62 @@
+package firebasegenkit
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestExporter(t *testing.T) {
+	genkit := tracetest.SpanStub{
+		Name: "answer",
+		Attributes: []attribute.KeyValue{
+			attribute.String(attrName, "answer"),
+			attribute.String(attrType, "action"),
+			attribute.String(attrSubtype, "flow"),
+			attribute.String(attrInput, `"question"`),
+			attribute.String(attrOutput, `"answer"`),
+			attribute.String("genkit:path", "/{answer,t:flow}"),
+		},
+	}
+	other := tracetest.SpanStub{
+		Name:       "GET",
+		Attributes: []attribute.KeyValue{attribute.String("http.method", "GET")},
+	}
+
+	next := tracetest.NewInMemoryExporter()
+	spans := []sdktrace.ReadOnlySpan{genkit.Snapshot(), other.Snapshot()}
+	if err := NewExporter(next).ExportSpans(context.Background(), spans); err != nil {
+		t.Fatal(err)
+	}
+
+	exported := next.GetSpans()
+	if len(exported) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(exported))
+	}
+	got := make(map[string]string)
+	for _, kv := range exported[0].Attributes {
+		got[string(kv.Key)] = kv.Value.Emit()
+	}
+	want := map[string]string{
+		"langfuse.observation.type":   "chain",
+		"langfuse.observation.input":  `"question"`,
+		"langfuse.observation.output": `"answer"`,
+		"genkit:path":                 "/{answer,t:flow}",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %s, want %s", key, got[key], value)
+		}
+	}
+	for _, key := range []string{attrInput, attrOutput} {
+		if value, ok := got[key]; ok {
+			t.Errorf("%s = %s, want the raw payload dropped", key, value)
+		}
+	}
+	if len(exported[1].Attributes) != 1 {
+		t.Errorf("other span attributes = %v, want them unchanged", exported[1].Attributes)
+	}
+}
@@ -0,0 +1,262 @@
+// Package firebasegenkit records github.com/firebase/genkit/go flows and
+// actions in Langfuse.
+//
+// Genkit traces flows, flow steps, models, tools, retrievers and embedders
+// with OpenTelemetry through the global tracer provider, which
+// langfuse.NewClient installs. The exporter returned by NewExporter
+// translates these spans into Langfuse observations before they are exported:
+//
+//	client, err := langfuse.NewClient(langfuse.Config{
+//		PublicKey:    "pk-...",
+//		SecretKey:    "sk-...",
+//		WrapExporter: firebasegenkit.NewExporter,
+//	})
+//	g := genkit.Init(ctx, genkit.WithPlugins(&googlegenai.GoogleAI{}))
+//
+// Create the client before Genkit records its first span and do not replace
+// the global tracer provider afterwards. Flows become chain spans, models
+// generations, embedders embedding observations, tools tool spans,
+// retrievers retriever spans and evaluators evaluator spans. Flows run with a
+// context from Trace.Context or Span.Context are nested under that
+// observation. Streamed model responses are recorded as aggregated by Genkit.
+//
+// Genkit creates and ends these spans itself, so they cannot be recorded
+// through Trace.CreateSpan or CreateGeneration. The exporter rewrites their
+// attributes instead: a Genkit span without a parent stands in for the trace
+// that the Langfuse API would create implicitly, and model configs are
+// recorded as GenerationParams. Data URIs in Genkit payloads are recorded
+// inline rather than uploaded as media.
+package firebasegenkit
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/qinrichard/langfuse"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Span attributes set by Genkit
+const (
+	attrName    = "genkit:name"
+	attrType    = "genkit:type"
+	attrSubtype = "genkit:metadata:subtype"
+	attrState   = "genkit:state"
+	attrInput   = "genkit:input"
+	attrOutput  = "genkit:output"
+)
+
+// observationTypes maps Genkit action types onto Langfuse observation types.
+// Other actions, flow steps and utilities are recorded as spans.
+var observationTypes = map[string]langfuse.ObservationType{
+	"flow":             langfuse.ObservationTypeChain,
+	"model":            langfuse.ObservationTypeGeneration,
+	"background-model": langfuse.ObservationTypeGeneration,
+	"embedder":         langfuse.ObservationTypeEmbedding,
+	"tool":             langfuse.ObservationTypeTool,
+	"tool.v2":          langfuse.ObservationTypeTool,
+	"retriever":        langfuse.ObservationTypeRetriever,
+	"evaluator":        langfuse.ObservationTypeEvaluator,
+}
+
+// mapSpan returns the Langfuse attributes of a span created by Genkit, or nil
+// for spans without Genkit attributes
+func mapSpan(span sdktrace.ReadOnlySpan) []attribute.KeyValue {
+	attrs := make(map[attribute.Key]string)
+	for _, kv := range span.Attributes() {
+		if strings.HasPrefix(string(kv.Key), "genkit:") {
+			attrs[kv.Key] = kv.Value.Emit()
+		}
+	}
+	name, ok := attrs[attrName]
+	if !ok {
+		return nil
+	}
+
+	actionType := attrs[attrSubtype]
+	if actionType == "" {
+		actionType = attrs[attrType]
+	}
+	obsType, ok := observationTypes[actionType]
+	if !ok {
+		obsType = langfuse.ObservationTypeSpan
+	}
+
+	input, output := payload(attrs[attrInput]), payload(attrs[attrOutput])
+	result := []attribute.KeyValue{
+		attribute.String("langfuse.observation.type", string(obsType)),
+	}
+	switch obsType {
+	case langfuse.ObservationTypeGeneration:
+		result = append(result, modelAttributes(name, input, output)...)
+	case langfuse.ObservationTypeEmbedding:
+		result = append(result, attribute.String("langfuse.observation.model.name", modelName(name)))
+		result = append(result, payloadAttributes(input, output)...)
+	default:
+		result = append(result, payloadAttributes(input, output)...)
+	}
+
+	if attrs[attrState] == "error" {
+		result = append(result, attribute.String("langfuse.observation.level", string(langfuse.LogLevelError)))
+		if status := span.Status(); status.Code == codes.Error && status.Description != "" {
+			result = append(result, attribute.String("langfuse.observation.status_message", status.Description))
+		}
+	}
+
+	// A Genkit root span that is not nested under a Langfuse observation
+	// starts its own trace
+	if !span.Parent().IsValid() {
+		if input != "" {
+			result = append(result, attribute.String("langfuse.trace.input", input))
+		}
+		if output != "" {
+			result = append(result, attribute.String("langfuse.trace.output", output))
+		}
+	}
+
+	return result
+}
+
+// payload returns a serialized Genkit input or output, or "" if it is empty
+func payload(value string) string {
+	if value == "" || value == "null" {
+		return ""
+	}
+	return value
+}
+
+// payloadAttributes records an input and output as is
+func payloadAttributes(input, output string) []attribute.KeyValue {
+	var result []attribute.KeyValue
+	if input != "" {
+		result = append(result, attribute.String("langfuse.observation.input", input))
+	}
+	if output != "" {
+		result = append(result, attribute.String("langfuse.observation.output", output))
+	}
+	return result
+}
+
+// modelName strips the plugin prefix from a Genkit model name, e.g.
+// "googleai/gemini-2.5-flash" becomes "gemini-2.5-flash"
+func modelName(name string) string {
+	if i := strings.Index(name, "/"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// configRenames maps Genkit model config fields to GenerationParams names
+var configRenames = map[string]string{
+	"maxOutputTokens":  "max_tokens",
+	"topP":             "top_p",
+	"topK":             "top_k",
+	"stopSequences":    "stop",
+	"candidateCount":   "n",
+	"presencePenalty":  "presence_penalty",
+	"frequencyPenalty": "frequency_penalty",
+}
+
+// modelAttributes converts a Genkit model request and response into
+// generation attributes. Payloads that cannot be decoded are recorded as is.
+func modelAttributes(name, input, output string) []attribute.KeyValue {
+	result := []attribute.KeyValue{
+		attribute.String("langfuse.observation.model.name", modelName(name)),
+	}
+
+	var request ai.ModelRequest
+	if input != "" && json.Unmarshal([]byte(input), &request) == nil {
+		chat := langfuse.ChatInput{Messages: chatMessages(request.Messages)}
+		for _, tool := range request.Tools {
+			if tool != nil {
+				chat.Tools = append(chat.Tools, langfuse.NewFunctionTool(tool.Name, tool.Description, tool.InputSchema))
+			}
+		}
+		input = marshal(chat, input)
+
+		var config map[string]interface{}
+		if raw, err := json.Marshal(request.Config); err == nil && json.Unmarshal(raw, &config) == nil && len(config) > 0 {
+			result = append(result, attribute.String("langfuse.observation.model.parameters", marshal(generationParams(config), "")))
+		}
+	}
+
+	var response ai.ModelResponse
+	if output != "" && json.Unmarshal([]byte(output), &response) == nil {
+		if response.Message != nil {
+			if messages := chatMessages([]*ai.Message{response.Message}); len(messages) > 0 {
+				output = marshal(messages[len(messages)-1], output)
+			}
+		}
+		if u := response.Usage; u != nil {
+			result = append(result, attribute.String("langfuse.observation.usage_details", marshal(usageDetails(u), "")))
+		}
+		if response.FinishReason != "" {
+			result = append(result, attribute.String("langfuse.observation.metadata.finish_reason", string(response.FinishReason)))
+		}
+	}
+
+	return append(result, payloadAttributes(input, output)...)
+}
+
+// generationParams maps a Genkit model config onto the GenerationParams that
+// WithGenerationParams records. Fields without a typed counterpart are kept in
+// Other. A value that does not fit its typed field is kept in Other under its
+// Genkit name, or dropped when that name is the typed field's own.
+func generationParams(config map[string]interface{}) langfuse.GenerationParams {
+	var params langfuse.GenerationParams
+	typed := make(map[string]interface{})
+	for key, value := range config {
+		name := key
+		if renamed, ok := configRenames[key]; ok {
+			name = renamed
+		}
+		// Each field is decoded on its own first, so a value that does not
+		// fit its typed field cannot leave a zero value behind
+		var field langfuse.GenerationParams
+		raw, err := json.Marshal(map[string]interface{}{name: value})
+		if err == nil && json.Unmarshal(raw, &field) == nil {
+			if data, err := json.Marshal(field); err == nil && string(data) != "{}" {
+				typed[name] = value
+				continue
+			}
+			key = name
+		} else if key == name {
+			continue
+		}
+		if params.Other == nil {
+			params.Other = make(map[string]interface{})
+		}
+		params.Other[key] = value
+	}
+
+	if raw, err := json.Marshal(typed); err == nil {
+		_ = json.Unmarshal(raw, &params)
+	}
+	return params
+}
+
+// usageDetails converts Genkit usage into Langfuse usage details. The OpenAI
+// plugins count thoughts tokens in OutputTokens, the Gemini plugins report
+// them next to it, which shows in a total that covers both.
+func usageDetails(u *ai.GenerationUsage) map[string]int {
+	output := u.OutputTokens
+	if u.ThoughtsTokens > 0 && u.TotalTokens >= u.InputTokens+u.OutputTokens+u.ThoughtsTokens {
+		output += u.ThoughtsTokens
+	}
+	return langfuse.NewUsageDetails(u.InputTokens, output, u.TotalTokens, map[string]int{
+		"input_cached_tokens":     u.CachedContentTokens,
+		"output_reasoning_tokens": u.ThoughtsTokens,
+	})
+}
+
+// marshal serializes v, returning fallback if it cannot be serialized
+func marshal(v interface{}, fallback string) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fallback
+	}
+	return string(data)
+}
@@ -0,0 +1,184 @@
+package firebasegenkit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// parentContext is the span context of a parent span
+var parentContext = oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+	TraceID: oteltrace.TraceID{1},
+	SpanID:  oteltrace.SpanID{1},
+})
+
+func TestMapSpan(t *testing.T) {
+	tests := []struct {
+		name   string
+		span   tracetest.SpanStub
+		want   map[string]string
+		absent []string
+	}{
+		{
+			name: "model",
+			span: tracetest.SpanStub{
+				Parent: parentContext,
+				Attributes: []attribute.KeyValue{
+					attribute.String(attrName, "googleai/gemini-2.5-flash"),
+					attribute.String(attrType, "action"),
+					attribute.String(attrSubtype, "model"),
+					attribute.String(attrInput, `{"messages":[{"role":"user","content":[{"text":"hi"}]}],"config":{"temperature":0.5,"maxOutputTokens":100}}`),
+					attribute.String(attrOutput, `{"message":{"role":"model","content":[{"text":"hello"}]},"finishReason":"stop",
+						"usage":{"inputTokens":10,"outputTokens":5,"thoughtsTokens":20,"totalTokens":35}}`),
+				},
+			},
+			want: map[string]string{
+				"langfuse.observation.type":                   "generation",
+				"langfuse.observation.model.name":             "gemini-2.5-flash",
+				"langfuse.observation.model.parameters":       `{"temperature":0.5,"max_tokens":100}`,
+				"langfuse.observation.input":                  `{"messages":[{"role":"user","content":"hi"}]}`,
+				"langfuse.observation.output":                 `{"role":"assistant","content":"hello"}`,
+				"langfuse.observation.usage_details":          `{"input":10,"output":5,"output_reasoning_tokens":20,"total":35}`,
+				"langfuse.observation.metadata.finish_reason": "stop",
+			},
+			absent: []string{"langfuse.trace.input"},
+		},
+		{
+			name: "root flow",
+			span: tracetest.SpanStub{
+				Attributes: []attribute.KeyValue{
+					attribute.String(attrName, "answer"),
+					attribute.String(attrType, "action"),
+					attribute.String(attrSubtype, "flow"),
+					attribute.String(attrInput, `"question"`),
+					attribute.String(attrOutput, `"answer"`),
+				},
+			},
+			want: map[string]string{
+				"langfuse.observation.type":   "chain",
+				"langfuse.observation.input":  `"question"`,
+				"langfuse.observation.output": `"answer"`,
+				"langfuse.trace.input":        `"question"`,
+				"langfuse.trace.output":       `"answer"`,
+			},
+		},
+		{
+			name: "failed tool",
+			span: tracetest.SpanStub{
+				Parent: parentContext,
+				Status: sdktrace.Status{Code: codes.Error, Description: "lookup failed"},
+				Attributes: []attribute.KeyValue{
+					attribute.String(attrName, "lookup"),
+					attribute.String(attrType, "action"),
+					attribute.String(attrSubtype, "tool"),
+					attribute.String(attrState, "error"),
+					attribute.String(attrInput, `{"city":"Paris"}`),
+					attribute.String(attrOutput, "null"),
+				},
+			},
+			want: map[string]string{
+				"langfuse.observation.type":           "tool",
+				"langfuse.observation.input":          `{"city":"Paris"}`,
+				"langfuse.observation.level":          "ERROR",
+				"langfuse.observation.status_message": "lookup failed",
+			},
+			absent: []string{"langfuse.observation.output"},
+		},
+		{
+			name: "flow step",
+			span: tracetest.SpanStub{
+				Parent: parentContext,
+				Attributes: []attribute.KeyValue{
+					attribute.String(attrName, "fetch"),
+					attribute.String(attrType, "flowStep"),
+				},
+			},
+			want: map[string]string{"langfuse.observation.type": "span"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[string]string)
+			for _, kv := range mapSpan(tt.span.Snapshot()) {
+				got[string(kv.Key)] = kv.Value.Emit()
+			}
+			for key, value := range tt.want {
+				if got[key] != value {
+					t.Errorf("%s = %s, want %s", key, got[key], value)
+				}
+			}
+			for _, key := range tt.absent {
+				if value, ok := got[key]; ok {
+					t.Errorf("%s = %s, want it unset", key, value)
+				}
+			}
+		})
+	}
+}
+
+func TestMapSpanIgnoresOtherSpans(t *testing.T) {
+	span := tracetest.SpanStub{Attributes: []attribute.KeyValue{attribute.String("http.method", "GET")}}
+	if got := mapSpan(span.Snapshot()); got != nil {
+		t.Errorf("got %v, want nil", got)
+	}
+}
+
+func TestUsageDetails(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage ai.GenerationUsage
+		want  map[string]int
+	}{
+		{
+			name:  "thoughts next to output",
+			usage: ai.GenerationUsage{InputTokens: 10, OutputTokens: 5, ThoughtsTokens: 20, TotalTokens: 35},
+			want:  map[string]int{"input": 10, "output": 5, "output_reasoning_tokens": 20, "total": 35},
+		},
+		{
+			name:  "thoughts within output",
+			usage: ai.GenerationUsage{InputTokens: 10, OutputTokens: 25, ThoughtsTokens: 20, TotalTokens: 35},
+			want:  map[string]int{"input": 10, "output": 5, "output_reasoning_tokens": 20, "total": 35},
+		},
+		{
+			name:  "cached input",
+			usage: ai.GenerationUsage{InputTokens: 100, OutputTokens: 5, CachedContentTokens: 80, TotalTokens: 105},
+			want:  map[string]int{"input": 20, "input_cached_tokens": 80, "output": 5, "total": 105},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := usageDetails(&tt.usage); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerationParams(t *testing.T) {
+	params := generationParams(map[string]interface{}{
+		"temperature":   0.5,
+		"stopSequences": []interface{}{"END"},
+		"topK":          "bad",
+		"maxTokens":     "many",
+		"max_tokens":    "many",
+		"safety":        "strict",
+	})
+	data, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"maxTokens":"many","safety":"strict","stop":["END"],"temperature":0.5,"topK":"bad"}`
+	if string(data) != want {
+		t.Errorf("params = %s, want %s", data, want)
+	}
+	if params.Temperature == nil || len(params.Stop) != 1 {
+		t.Errorf("typed fields not set: %+v", params)
+	}
+}
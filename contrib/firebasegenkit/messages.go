@@ -0,0 +1,76 @@
+package firebasegenkit
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/qinrichard/langfuse"
+)
+
+// chatMessages converts Genkit messages into chat messages. Tool responses
+// become separate tool messages and reasoning parts are skipped.
+func chatMessages(messages []*ai.Message) []langfuse.ChatMessage {
+	var result []langfuse.ChatMessage
+	for _, m := range messages {
+		if m == nil {
+			continue
+		}
+		role := string(m.Role)
+		if m.Role == ai.RoleModel {
+			role = langfuse.ChatRoleAssistant
+		}
+		msg := langfuse.ChatMessage{Role: role}
+		var toolMessages []langfuse.ChatMessage
+
+		for _, part := range m.Content {
+			switch {
+			case part.IsText() || part.IsData():
+				msg.Parts = append(msg.Parts, langfuse.TextPart(part.Text))
+			case part.IsMedia():
+				if strings.HasPrefix(part.ContentType, "image/") || strings.HasPrefix(part.Text, "data:image/") {
+					msg.Parts = append(msg.Parts, langfuse.ImagePart(part.Text))
+				} else {
+					msg.Parts = append(msg.Parts, langfuse.ContentPart{
+						Type: langfuse.ContentPartTypeFile,
+						File: &langfuse.FileContent{FileData: part.Text},
+					})
+				}
+			case part.IsToolRequest():
+				tr := part.ToolRequest
+				msg.ToolCalls = append(msg.ToolCalls, langfuse.NewToolCall(toolCallID(tr.Ref, tr.Name), tr.Name, tr.Input))
+			case part.IsToolResponse():
+				tr := part.ToolResponse
+				content, _ := json.Marshal(tr.Output)
+				toolMessages = append(toolMessages, langfuse.ChatMessage{
+					Role:       langfuse.ChatRoleTool,
+					Name:       tr.Name,
+					Content:    string(content),
+					ToolCallID: toolCallID(tr.Ref, tr.Name),
+				})
+			}
+		}
+
+		// Collapse text-only content to a plain string for readability
+		if len(msg.Parts) == 1 && msg.Parts[0].Type == langfuse.ContentPartTypeText {
+			msg.Content = msg.Parts[0].Text
+			msg.Parts = nil
+		}
+
+		if len(msg.Parts) > 0 || msg.Content != "" || len(msg.ToolCalls) > 0 {
+			result = append(result, msg)
+		}
+		result = append(result, toolMessages...)
+	}
+	return result
+}
+
+// toolCallID returns the reference that pairs a tool request with its
+// response. Genkit leaves it empty for single calls, in which case the tool
+// name is used.
+func toolCallID(ref, name string) string {
+	if ref != "" {
+		return ref
+	}
+	return name
+}
@@ -0,0 +1,224 @@
+// Package goopenai instruments github.com/sashabaranov/go-openai clients with
+// Langfuse. Each chat completion and embedding call is recorded as a
+// generation under the observation carried by the call's context.
+package goopenai
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/qinrichard/langfuse"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Generation names used for recorded calls
+const (
+	chatCompletionName = "OpenAI-chat-completion"
+	embeddingName      = "OpenAI-embedding"
+)
+
+// Client wraps an openai.Client. CreateChatCompletion,
+// CreateChatCompletionStream and CreateEmbeddings are instrumented; all other
+// methods are passed through unchanged.
+type Client struct {
+	*openai.Client
+	langfuse *langfuse.Client
+}
+
+// NewClient wraps client with Langfuse instrumentation
+func NewClient(client *openai.Client, lf *langfuse.Client) *Client {
+	return &Client{Client: client, langfuse: lf}
+}
+
+// CreateChatCompletion creates a chat completion and records it as a generation
+func (c *Client) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	generation := c.langfuse.StartGeneration(ctx, chatCompletionName, requestOptions(request)...)
+
+	response, err := c.Client.CreateChatCompletion(ctx, request)
+	if err != nil {
+		endWithError(generation, err)
+		return response, err
+	}
+
+	generation.Update(responseOptions(response)...)
+	generation.End()
+	return response, nil
+}
+
+// CreateChatCompletionStream creates a streaming chat completion. The
+// generation is recorded once the stream has been read to the end or closed.
+func (c *Client) CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (*ChatCompletionStream, error) {
+	generation := c.langfuse.StartGeneration(ctx, chatCompletionName, requestOptions(request)...)
+
+	stream, err := c.Client.CreateChatCompletionStream(ctx, request)
+	if err != nil {
+		endWithError(generation, err)
+		return nil, err
+	}
+
+	return newChatCompletionStream(stream, generation), nil
+}
+
+// CreateEmbeddings creates embeddings and records them as an embedding
+// observation. The vectors themselves are not recorded, only their count and
+// dimensions.
+func (c *Client) CreateEmbeddings(ctx context.Context, conv openai.EmbeddingRequestConverter) (openai.EmbeddingResponse, error) {
+	request := conv.Convert()
+
+	opts := []langfuse.GenerationOption{
+		langfuse.WithGenerationModel(string(request.Model)),
+		langfuse.WithGenerationInput(request.Input),
+	}
+	if request.Dimensions > 0 {
+		opts = append(opts, langfuse.WithGenerationParams(langfuse.GenerationParams{
+			Other: map[string]interface{}{"dimensions": request.Dimensions},
+		}))
+	}
+	generation := c.langfuse.StartEmbedding(ctx, embeddingName, opts...)
+
+	response, err := c.Client.CreateEmbeddings(ctx, conv)
+	if err != nil {
+		endWithError(generation, err)
+		return response, err
+	}
+
+	output := map[string]int{"embeddings": len(response.Data)}
+	if len(response.Data) > 0 {
+		output["dimensions"] = len(response.Data[0].Embedding)
+	}
+	generation.Update(
+		langfuse.WithGenerationModel(string(response.Model)),
+		langfuse.WithGenerationOutput(output),
+		langfuse.WithGenerationUsageDetails(usageDetails(response.Usage)),
+	)
+	generation.End()
+	return response, nil
+}
+
+// requestOptions maps a chat completion request onto generation options
+func requestOptions(request openai.ChatCompletionRequest) []langfuse.GenerationOption {
+	opts := []langfuse.GenerationOption{
+		langfuse.WithGenerationModel(request.Model),
+		langfuse.WithGenerationParams(generationParams(request)),
+	}
+
+	// The request serializes to the OpenAI wire format the converter expects
+	if body, err := json.Marshal(request); err == nil {
+		if input, err := langfuse.ChatInputFromOpenAI(body); err == nil {
+			opts = append(opts, langfuse.WithGenerationInput(input))
+		}
+	}
+
+	return opts
+}
+
+// generationParams extracts the model parameters of a chat completion
+// request. Zero values are treated as unset, as go-openai omits them.
+func generationParams(request openai.ChatCompletionRequest) langfuse.GenerationParams {
+	var params langfuse.GenerationParams
+	if request.Temperature != 0 {
+		params.Temperature = float64Ptr(request.Temperature)
+	}
+	if request.TopP != 0 {
+		params.TopP = float64Ptr(request.TopP)
+	}
+	if request.FrequencyPenalty != 0 {
+		params.FrequencyPenalty = float64Ptr(request.FrequencyPenalty)
+	}
+	if request.PresencePenalty != 0 {
+		params.PresencePenalty = float64Ptr(request.PresencePenalty)
+	}
+	if request.MaxTokens != 0 {
+		params.MaxTokens = &request.MaxTokens
+	}
+	if request.MaxCompletionTokens != 0 {
+		params.MaxCompletionTokens = &request.MaxCompletionTokens
+	}
+	if request.N != 0 {
+		params.N = &request.N
+	}
+	if request.ResponseFormat != nil {
+		params.ResponseFormat = request.ResponseFormat
+	}
+	if parallel, ok := request.ParallelToolCalls.(bool); ok {
+		params.ParallelToolCalls = &parallel
+	}
+	params.Stop = request.Stop
+	params.Seed = request.Seed
+	params.ReasoningEffort = request.ReasoningEffort
+	params.ToolChoice = request.ToolChoice
+
+	other := map[string]interface{}{}
+	if len(request.LogitBias) > 0 {
+		other["logit_bias"] = request.LogitBias
+	}
+	if request.LogProbs {
+		other["logprobs"] = true
+	}
+	if request.TopLogProbs != 0 {
+		other["top_logprobs"] = request.TopLogProbs
+	}
+	if request.ServiceTier != "" {
+		other["service_tier"] = request.ServiceTier
+	}
+	if request.Verbosity != "" {
+		other["verbosity"] = request.Verbosity
+	}
+	if len(other) > 0 {
+		params.Other = other
+	}
+
+	return params
+}
+
+// responseOptions maps a chat completion response onto generation options
+func responseOptions(response openai.ChatCompletionResponse) []langfuse.GenerationOption {
+	opts := []langfuse.GenerationOption{
+		langfuse.WithGenerationModel(response.Model),
+		langfuse.WithGenerationUsageDetails(usageDetails(response.Usage)),
+	}
+
+	metadata := map[string]interface{}{}
+	if response.SystemFingerprint != "" {
+		metadata["system_fingerprint"] = response.SystemFingerprint
+	}
+	if len(response.Choices) > 0 {
+		metadata["finish_reason"] = string(response.Choices[0].FinishReason)
+		if body, err := json.Marshal(response); err == nil {
+			if message, err := langfuse.ChatMessageFromOpenAI(body); err == nil {
+				opts = append(opts, langfuse.WithGenerationOutput(message))
+			}
+		}
+	}
+	opts = append(opts, langfuse.WithGenerationMetadata(metadata))
+
+	return opts
+}
+
+// usageDetails converts go-openai usage into Langfuse usage details
+func usageDetails(usage openai.Usage) map[string]int {
+	breakdown := map[string]int{}
+	if d := usage.PromptTokensDetails; d != nil {
+		breakdown["input_cached_tokens"] = d.CachedTokens
+		breakdown["input_audio_tokens"] = d.AudioTokens
+	}
+	if d := usage.CompletionTokensDetails; d != nil {
+		breakdown["output_reasoning_tokens"] = d.ReasoningTokens
+		breakdown["output_audio_tokens"] = d.AudioTokens
+	}
+	return langfuse.NewUsageDetails(usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens, breakdown)
+}
+
+// endWithError records a failed call and ends the generation
+func endWithError(generation *langfuse.Generation, err error) {
+	generation.Update(
+		langfuse.WithGenerationLevel(langfuse.LogLevelError),
+		langfuse.WithGenerationStatusMessage(err.Error()),
+	)
+	generation.End()
+}
+
+func float64Ptr(f float32) *float64 {
+	v := float64(f)
+	return &v
+}
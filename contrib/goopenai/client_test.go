@@ -0,0 +1,235 @@
+package goopenai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/qinrichard/langfuse"
+	"github.com/qinrichard/langfuse/langfusetest"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// newFakeOpenAI starts a server that answers the OpenAI API with the given
+// handlers
+func newFakeOpenAI(t *testing.T, handlers map[string]http.HandlerFunc) *httptest.Server {
+	mux := http.NewServeMux()
+	for pattern, handler := range handlers {
+		mux.HandleFunc(pattern, handler)
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestClients returns an instrumented go-openai client talking to server
+// and a function that flushes the Langfuse client and returns the recorder
+func newTestClients(t *testing.T, server *httptest.Server) (*Client, *langfuse.Trace, func() *langfusetest.Recorder) {
+	lf, recorder := langfusetest.NewClient(t, langfuse.Config{})
+
+	config := openai.DefaultConfig("sk-test")
+	config.BaseURL = server.URL + "/v1"
+	trace := lf.CreateTrace(context.Background(), "test")
+
+	flush := func() *langfusetest.Recorder {
+		trace.End()
+		if err := lf.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return recorder
+	}
+	return NewClient(openai.NewClientWithConfig(config), lf), trace, flush
+}
+
+func TestCreateChatCompletion(t *testing.T) {
+	server := newFakeOpenAI(t, map[string]http.HandlerFunc{
+		"POST /v1/chat/completions": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"model":"gpt-4o-2024-08-06","system_fingerprint":"fp_1",
+				"choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],
+				"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15,"prompt_tokens_details":{"cached_tokens":4}}}`)
+		},
+	})
+	client, trace, flush := newTestClients(t, server)
+
+	_, err := client.CreateChatCompletion(trace.Context(), openai.ChatCompletionRequest{
+		Model:       "gpt-4o",
+		Temperature: 0.5,
+		Messages:    []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attrs := langfusetest.Attrs(flush().Find(t, chatCompletionName))
+	want := map[string]string{
+		"langfuse.observation.model.name":                  "gpt-4o-2024-08-06",
+		"langfuse.observation.model.parameters":            `{"temperature":0.5}`,
+		"langfuse.observation.input":                       `{"messages":[{"role":"user","content":"hi"}]}`,
+		"langfuse.observation.output":                      `{"role":"assistant","content":"hello"}`,
+		"langfuse.observation.usage_details":               `{"input":6,"input_cached_tokens":4,"output":5,"total":15}`,
+		"langfuse.observation.metadata.finish_reason":      "stop",
+		"langfuse.observation.metadata.system_fingerprint": "fp_1",
+	}
+	for key, value := range want {
+		if attrs[key] != value {
+			t.Errorf("%s = %s, want %s", key, attrs[key], value)
+		}
+	}
+}
+
+func TestCreateChatCompletionError(t *testing.T) {
+	server := newFakeOpenAI(t, map[string]http.HandlerFunc{
+		"POST /v1/chat/completions": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"error":{"message":"rate limited","type":"rate_limit"}}`)
+		},
+	})
+	client, trace, flush := newTestClients(t, server)
+
+	_, err := client.CreateChatCompletion(trace.Context(), openai.ChatCompletionRequest{Model: "gpt-4o"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	attrs := langfusetest.Attrs(flush().Find(t, chatCompletionName))
+	if attrs["langfuse.observation.level"] != string(langfuse.LogLevelError) || attrs["langfuse.observation.status_message"] != err.Error() {
+		t.Errorf("level %q, status message %q", attrs["langfuse.observation.level"], attrs["langfuse.observation.status_message"])
+	}
+}
+
+func TestCreateChatCompletionStream(t *testing.T) {
+	server := newFakeOpenAI(t, map[string]http.HandlerFunc{
+		"POST /v1/chat/completions": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: {\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hel\"}}]}\n\n"+
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\n"+
+				"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":2,\"total_tokens\":5}}\n\n"+
+				"data: [DONE]\n\n")
+		},
+	})
+	client, trace, flush := newTestClients(t, server)
+
+	stream, err := client.CreateChatCompletionStream(trace.Context(), openai.ChatCompletionRequest{Model: "gpt-4o", Stream: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := stream.Recv(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	stream.Close()
+
+	attrs := langfusetest.Attrs(flush().Find(t, chatCompletionName))
+	want := map[string]string{
+		"langfuse.observation.output":                 `{"role":"assistant","content":"Hello"}`,
+		"langfuse.observation.usage_details":          `{"input":3,"output":2,"total":5}`,
+		"langfuse.observation.metadata.finish_reason": "stop",
+	}
+	for key, value := range want {
+		if attrs[key] != value {
+			t.Errorf("%s = %s, want %s", key, attrs[key], value)
+		}
+	}
+	if attrs["langfuse.observation.completion_start_time"] == "" {
+		t.Error("completion start time not recorded")
+	}
+}
+
+func TestCreateEmbeddings(t *testing.T) {
+	server := newFakeOpenAI(t, map[string]http.HandlerFunc{
+		"POST /v1/embeddings": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"model":"text-embedding-3-small","data":[{"embedding":[0.1,0.2,0.3]}],"usage":{"prompt_tokens":2,"total_tokens":2}}`)
+		},
+	})
+	client, trace, flush := newTestClients(t, server)
+
+	_, err := client.CreateEmbeddings(trace.Context(), openai.EmbeddingRequest{
+		Model:      openai.SmallEmbedding3,
+		Input:      []string{"hi"},
+		Dimensions: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attrs := langfusetest.Attrs(flush().Find(t, embeddingName))
+	want := map[string]string{
+		"langfuse.observation.type":             "embedding",
+		"langfuse.observation.model.parameters": `{"dimensions":3}`,
+		"langfuse.observation.input":            `["hi"]`,
+		"langfuse.observation.output":           `{"dimensions":3,"embeddings":1}`,
+		"langfuse.observation.usage_details":    `{"input":2,"output":0,"total":2}`,
+	}
+	for key, value := range want {
+		if attrs[key] != value {
+			t.Errorf("%s = %s, want %s", key, attrs[key], value)
+		}
+	}
+}
+
+func TestUsageDetails(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage openai.Usage
+		want  map[string]int
+	}{
+		{
+			name:  "plain",
+			usage: openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+			want:  map[string]int{"input": 10, "output": 5, "total": 15},
+		},
+		{
+			name: "cached and reasoning",
+			usage: openai.Usage{
+				PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150,
+				PromptTokensDetails:     &openai.PromptTokensDetails{CachedTokens: 30},
+				CompletionTokensDetails: &openai.CompletionTokensDetails{ReasoningTokens: 20},
+			},
+			want: map[string]int{"input": 70, "output": 30, "total": 150, "input_cached_tokens": 30, "output_reasoning_tokens": 20},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := usageDetails(tt.usage); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerationParams(t *testing.T) {
+	seed := 7
+	params := generationParams(openai.ChatCompletionRequest{
+		Temperature:       0.5,
+		MaxTokens:         100,
+		Stop:              []string{"END"},
+		Seed:              &seed,
+		ParallelToolCalls: false,
+		LogitBias:         map[string]int{"1": 2},
+		ServiceTier:       openai.ServiceTierFlex,
+	})
+	want := langfuse.GenerationParams{
+		Temperature:       float64Ptr(0.5),
+		MaxTokens:         intPtr(100),
+		Stop:              []string{"END"},
+		Seed:              &seed,
+		ParallelToolCalls: boolPtr(false),
+		Other:             map[string]interface{}{"logit_bias": map[string]int{"1": 2}, "service_tier": openai.ServiceTierFlex},
+	}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("got %+v, want %+v", params, want)
+	}
+}
+
+func intPtr(i int) *int    { return &i }
+func boolPtr(b bool) *bool { return &b }
@@ -0,0 +1,165 @@
+package goopenai
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qinrichard/langfuse"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ChatCompletionStream wraps an openai.ChatCompletionStream and accumulates
+// the streamed chunks. The generation is ended with the complete message,
+// usage and time to first token when Recv returns io.EOF or an error, or when
+// the stream is closed.
+type ChatCompletionStream struct {
+	*openai.ChatCompletionStream
+	generation *langfuse.Generation
+
+	mu                sync.Mutex
+	model             string
+	role              string
+	content           strings.Builder
+	toolCalls         map[int]*langfuse.ToolCall
+	finishReason      string
+	systemFingerprint string
+	usage             *openai.Usage
+	firstAt           time.Time
+	once              sync.Once
+}
+
+func newChatCompletionStream(stream *openai.ChatCompletionStream, generation *langfuse.Generation) *ChatCompletionStream {
+	return &ChatCompletionStream{
+		ChatCompletionStream: stream,
+		generation:           generation,
+		toolCalls:            make(map[int]*langfuse.ToolCall),
+	}
+}
+
+// Recv receives the next chunk and records it
+func (s *ChatCompletionStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	response, err := s.ChatCompletionStream.Recv()
+	if errors.Is(err, io.EOF) {
+		s.finish(nil)
+		return response, err
+	}
+	if err != nil {
+		s.finish(err)
+		return response, err
+	}
+
+	s.record(response)
+	return response, nil
+}
+
+// Close closes the stream and ends the generation with what was received
+func (s *ChatCompletionStream) Close() error {
+	err := s.ChatCompletionStream.Close()
+	s.finish(nil)
+	return err
+}
+
+// record accumulates one chunk. Only the first choice is recorded.
+func (s *ChatCompletionStream) record(response openai.ChatCompletionStreamResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if response.Model != "" {
+		s.model = response.Model
+	}
+	if response.SystemFingerprint != "" {
+		s.systemFingerprint = response.SystemFingerprint
+	}
+	if response.Usage != nil {
+		s.usage = response.Usage
+	}
+
+	for _, choice := range response.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if choice.Delta.Role != "" {
+			s.role = choice.Delta.Role
+		}
+		if choice.FinishReason != "" {
+			s.finishReason = string(choice.FinishReason)
+		}
+		if choice.Delta.Content != "" || len(choice.Delta.ToolCalls) > 0 {
+			if s.firstAt.IsZero() {
+				s.firstAt = time.Now()
+			}
+		}
+		s.content.WriteString(choice.Delta.Content)
+
+		for i, tc := range choice.Delta.ToolCalls {
+			index := i
+			if tc.Index != nil {
+				index = *tc.Index
+			}
+			call, ok := s.toolCalls[index]
+			if !ok {
+				call = &langfuse.ToolCall{Type: "function"}
+				s.toolCalls[index] = call
+			}
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			call.Function.Name += tc.Function.Name
+			call.Function.Arguments += tc.Function.Arguments
+		}
+	}
+}
+
+// finish records the accumulated message and ends the generation exactly once
+func (s *ChatCompletionStream) finish(err error) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		role := s.role
+		if role == "" {
+			role = langfuse.ChatRoleAssistant
+		}
+		message := langfuse.ChatMessage{Role: role, Content: s.content.String()}
+		indexes := make([]int, 0, len(s.toolCalls))
+		for index := range s.toolCalls {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+		for _, index := range indexes {
+			message.ToolCalls = append(message.ToolCalls, *s.toolCalls[index])
+		}
+
+		opts := []langfuse.GenerationOption{langfuse.WithGenerationOutput(message)}
+		if s.model != "" {
+			opts = append(opts, langfuse.WithGenerationModel(s.model))
+		}
+		if s.usage != nil {
+			opts = append(opts, langfuse.WithGenerationUsageDetails(usageDetails(*s.usage)))
+		}
+		if !s.firstAt.IsZero() {
+			opts = append(opts, langfuse.WithGenerationStartTime(s.firstAt))
+		}
+		metadata := map[string]interface{}{}
+		if s.finishReason != "" {
+			metadata["finish_reason"] = s.finishReason
+		}
+		if s.systemFingerprint != "" {
+			metadata["system_fingerprint"] = s.systemFingerprint
+		}
+		opts = append(opts, langfuse.WithGenerationMetadata(metadata))
+		if err != nil {
+			opts = append(opts,
+				langfuse.WithGenerationLevel(langfuse.LogLevelError),
+				langfuse.WithGenerationStatusMessage(err.Error()),
+			)
+		}
+
+		s.generation.Update(opts...)
+		s.generation.End()
+	})
+}
@@ -0,0 +1,83 @@
+package grpc
+
+import (
+	"encoding/json"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// payloadCapture records messages as JSON up to a total size limit. It is
+// safe for concurrent use, as gRPC allows sending and receiving on a stream
+// from different goroutines.
+type payloadCapture struct {
+	limit  int
+	method string
+	mask   func([]byte, string) []byte
+
+	mu        sync.Mutex
+	messages  []json.RawMessage
+	size      int
+	count     int
+	truncated bool
+}
+
+// record captures a message. Calls on a nil capture are ignored.
+func (c *payloadCapture) record(m interface{}) {
+	if c == nil || m == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.count++
+	if c.truncated {
+		return
+	}
+
+	var data []byte
+	var err error
+	if msg, ok := m.(proto.Message); ok {
+		data, err = protojson.Marshal(msg)
+	} else {
+		data, err = json.Marshal(m)
+	}
+	if err != nil {
+		return
+	}
+	if c.mask != nil {
+		data = c.mask(data, c.method)
+	}
+	if c.size+len(data) > c.limit || !json.Valid(data) {
+		c.truncated = true
+		return
+	}
+	c.size += len(data)
+	c.messages = append(c.messages, data)
+}
+
+// payload returns the captured messages: a single message as is, several as
+// a list. Messages beyond the size limit are counted but not recorded. It
+// reports false if nothing was captured.
+func (c *payloadCapture) payload() (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case c.count == 0:
+		return nil, false
+	case c.count == 1 && len(c.messages) == 1:
+		return c.messages[0], true
+	case !c.truncated:
+		return c.messages, true
+	}
+	return map[string]interface{}{
+		"messages":  c.messages,
+		"count":     c.count,
+		"truncated": true,
+	}, true
+}
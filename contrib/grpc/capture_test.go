@@ -0,0 +1,100 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestPayloadCapture(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		mask     func([]byte, string) []byte
+		messages []interface{}
+		want     string
+	}{
+		{
+			name:     "none",
+			limit:    1024,
+			messages: nil,
+			want:     "",
+		},
+		{
+			name:     "single proto message",
+			limit:    1024,
+			messages: []interface{}{&healthpb.HealthCheckRequest{Service: "llm"}},
+			want:     `{"service":"llm"}`,
+		},
+		{
+			name:     "several messages",
+			limit:    1024,
+			messages: []interface{}{map[string]int{"n": 1}, map[string]int{"n": 2}},
+			want:     `[{"n":1},{"n":2}]`,
+		},
+		{
+			name:     "over the limit",
+			limit:    16,
+			messages: []interface{}{map[string]int{"n": 1}, map[string]int{"n": 2}, map[string]int{"n": 3}},
+			want:     `{"count":3,"messages":[{"n":1},{"n":2}],"truncated":true}`,
+		},
+		{
+			name:     "single message over the limit",
+			limit:    4,
+			messages: []interface{}{map[string]int{"n": 1}},
+			want:     `{"count":1,"messages":null,"truncated":true}`,
+		},
+		{
+			name:  "masked",
+			limit: 1024,
+			mask: func(payload []byte, fullMethod string) []byte {
+				return bytes.ReplaceAll(payload, []byte("secret"), []byte("***"))
+			},
+			messages: []interface{}{map[string]string{"key": "secret"}},
+			want:     `{"key":"***"}`,
+		},
+		{
+			name:  "mask returns invalid JSON",
+			limit: 1024,
+			mask: func(payload []byte, fullMethod string) []byte {
+				return payload[1:]
+			},
+			messages: []interface{}{map[string]string{"key": "secret"}},
+			want:     `{"count":1,"messages":null,"truncated":true}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capture := &payloadCapture{limit: tt.limit, method: "/llm.Gateway/Generate", mask: tt.mask}
+			for _, m := range tt.messages {
+				capture.record(m)
+			}
+
+			payload, ok := capture.payload()
+			if !ok {
+				if tt.want != "" {
+					t.Fatalf("nothing captured, want %s", tt.want)
+				}
+				return
+			}
+			got, err := json.Marshal(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("payload = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilPayloadCapture(t *testing.T) {
+	var capture *payloadCapture
+	capture.record(map[string]int{"n": 1})
+	if _, ok := capture.payload(); ok {
+		t.Error("a nil capture reported a payload")
+	}
+}
@@ -0,0 +1,400 @@
+// Package grpc provides gRPC interceptors that record calls in Langfuse.
+//
+//	server := grpc.NewServer(
+//		grpc.UnaryInterceptor(lfgrpc.UnaryServerInterceptor(client, opts)),
+//		grpc.StreamInterceptor(lfgrpc.StreamServerInterceptor(client, opts)),
+//	)
+//
+// Server interceptors record each call as a span that continues the W3C
+// trace context of the incoming metadata. Client interceptors record each
+// call as a span under the current observation and inject the trace context
+// into the outgoing metadata.
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/qinrichard/langfuse"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// defaultMaxPayloadSize is the default number of payload bytes captured per
+// call
+const defaultMaxPayloadSize = 64 * 1024
+
+// Options configures the interceptors. All fields are optional.
+type Options struct {
+	// TraceName returns the span name for a call. Defaults to the full
+	// method without its leading slash, e.g. "llm.Gateway/Generate".
+	TraceName func(fullMethod string) string
+
+	// UserID and SessionID extract the Langfuse user and session IDs for a
+	// server call, e.g. from incoming metadata or an authenticated principal
+	UserID    func(ctx context.Context) string
+	SessionID func(ctx context.Context) string
+
+	// TraceOptions returns additional options for the trace of a server call
+	TraceOptions func(ctx context.Context, fullMethod string) []langfuse.TraceOption
+
+	// CapturePayloads records request and response messages as JSON input
+	// and output, up to MaxPayloadSize bytes per call (default 64 KiB)
+	CapturePayloads bool
+	MaxPayloadSize  int
+
+	// MaskPayload redacts sensitive data from a captured message before it is
+	// recorded
+	MaskPayload func(payload []byte, fullMethod string) []byte
+
+	// Skip excludes calls, e.g. health checks, from tracing
+	Skip func(fullMethod string) bool
+}
+
+func (o Options) name(fullMethod string) string {
+	if o.TraceName != nil {
+		return o.TraceName(fullMethod)
+	}
+	return strings.TrimPrefix(fullMethod, "/")
+}
+
+func (o Options) skip(fullMethod string) bool {
+	return o.Skip != nil && o.Skip(fullMethod)
+}
+
+// newCapture returns a payload capture, or nil if payloads are not captured
+func (o Options) newCapture(fullMethod string) *payloadCapture {
+	if !o.CapturePayloads {
+		return nil
+	}
+	limit := o.MaxPayloadSize
+	if limit <= 0 {
+		limit = defaultMaxPayloadSize
+	}
+	return &payloadCapture{limit: limit, method: fullMethod, mask: o.MaskPayload}
+}
+
+// UnaryServerInterceptor returns a server interceptor that records each call
+// as a span. Incoming W3C trace context in the metadata is continued, the
+// span is available to handlers via langfuse.SpanFromContext, and status
+// codes are recorded as levels: server errors (Unknown, DeadlineExceeded,
+// Unimplemented, Internal, Unavailable, DataLoss) as ERROR, other non-OK
+// codes as WARNING.
+func UnaryServerInterceptor(client *langfuse.Client, opts Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		if opts.skip(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		span := startServerSpan(ctx, client, opts, info.FullMethod)
+		in, out := opts.newCapture(info.FullMethod), opts.newCapture(info.FullMethod)
+		in.record(req)
+
+		defer func() {
+			recovered := recover()
+			if err == nil && recovered == nil {
+				out.record(resp)
+			}
+			endServerSpan(span, in, out, err, recovered)
+			if recovered != nil {
+				panic(recovered)
+			}
+		}()
+
+		return handler(langfuse.ContextWithSpan(ctx, span), req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor. Captured payloads list the received and sent
+// messages.
+func StreamServerInterceptor(client *langfuse.Client, opts Options) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		if opts.skip(info.FullMethod) {
+			return handler(srv, ss)
+		}
+
+		span := startServerSpan(ss.Context(), client, opts, info.FullMethod)
+		stream := &serverStream{
+			ServerStream: ss,
+			ctx:          langfuse.ContextWithSpan(ss.Context(), span),
+			in:           opts.newCapture(info.FullMethod),
+			out:          opts.newCapture(info.FullMethod),
+		}
+
+		defer func() {
+			recovered := recover()
+			endServerSpan(span, stream.in, stream.out, err, recovered)
+			if recovered != nil {
+				panic(recovered)
+			}
+		}()
+
+		return handler(srv, stream)
+	}
+}
+
+// startServerSpan continues or starts the trace of a server call. The span
+// is the root of the trace in this service, so each call is recorded once.
+func startServerSpan(ctx context.Context, client *langfuse.Client, opts Options, fullMethod string) *langfuse.Span {
+	md, _ := metadata.FromIncomingContext(ctx)
+	span := client.ContinueSpan(ctx, metadataCarrier(md), opts.name(fullMethod),
+		langfuse.WithSpanMetadata(rpcMetadata(fullMethod)))
+
+	var traceOpts []langfuse.TraceOption
+	if opts.UserID != nil {
+		if userID := opts.UserID(ctx); userID != "" {
+			traceOpts = append(traceOpts, langfuse.WithTraceUserID(userID))
+		}
+	}
+	if opts.SessionID != nil {
+		if sessionID := opts.SessionID(ctx); sessionID != "" {
+			traceOpts = append(traceOpts, langfuse.WithTraceSessionID(sessionID))
+		}
+	}
+	if opts.TraceOptions != nil {
+		traceOpts = append(traceOpts, opts.TraceOptions(ctx, fullMethod)...)
+	}
+	langfuse.TraceFromContext(span.Context()).Update(traceOpts...)
+	return span
+}
+
+// endServerSpan records the outcome of a server call and ends its span
+func endServerSpan(span *langfuse.Span, in, out *payloadCapture, err error, recovered interface{}) {
+	var traceUpdates []langfuse.TraceOption
+	if input, ok := in.payload(); ok {
+		traceUpdates = append(traceUpdates, langfuse.WithTraceInput(input))
+	}
+	if output, ok := out.payload(); ok {
+		traceUpdates = append(traceUpdates, langfuse.WithTraceOutput(output))
+	}
+	langfuse.TraceFromContext(span.Context()).Update(traceUpdates...)
+
+	code := status.Code(err)
+	message := ""
+	if err != nil {
+		message = status.Convert(err).Message()
+	}
+	if recovered != nil {
+		code = codes.Internal
+		message = fmt.Sprintf("panic: %v", recovered)
+	}
+
+	updates := []langfuse.SpanOption{langfuse.WithSpanMetadata(statusMetadata(code))}
+	if code != codes.OK {
+		level := langfuse.LogLevelWarning
+		if serverError(code) {
+			level = langfuse.LogLevelError
+		}
+		updates = append(updates,
+			langfuse.WithSpanLevel(level),
+			langfuse.WithSpanStatusMessage(statusMessage(code, message)),
+		)
+	}
+	span.Update(updates...)
+	span.End()
+}
+
+// serverError reports whether a status code indicates a server-side failure
+// rather than a problem with the request
+func serverError(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented,
+		codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+// statusMessage formats a status code and message, e.g.
+// "NotFound: model not found"
+func statusMessage(code codes.Code, message string) string {
+	if message == "" {
+		return code.String()
+	}
+	return code.String() + ": " + message
+}
+
+// serverStream passes the span context to stream handlers and captures
+// messages
+type serverStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	in, out *payloadCapture
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.in.record(m)
+	}
+	return err
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.out.record(m)
+	}
+	return err
+}
+
+// UnaryClientInterceptor returns a client interceptor that records each call
+// as a span under the current observation in ctx and injects the trace
+// context into the outgoing metadata. If ctx carries no trace, one is created
+// for the call. Non-OK status codes are recorded as ERROR.
+func UnaryClientInterceptor(client *langfuse.Client, opts Options) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		if opts.skip(method) {
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		}
+
+		span := startClientSpan(ctx, client, opts, method)
+		in, out := opts.newCapture(method), opts.newCapture(method)
+		in.record(req)
+
+		err := invoker(outgoingContext(span), method, req, reply, cc, callOpts...)
+		if err == nil {
+			out.record(reply)
+		}
+		endClientSpan(span, in, out, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor is the streaming counterpart of
+// UnaryClientInterceptor. The span ends when the stream completes: when
+// RecvMsg returns an error, including io.EOF, or when a unary response has
+// been received.
+func StreamClientInterceptor(client *langfuse.Client, opts Options) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if opts.skip(method) {
+			return streamer(ctx, desc, cc, method, callOpts...)
+		}
+
+		span := startClientSpan(ctx, client, opts, method)
+		cs, err := streamer(outgoingContext(span), desc, cc, method, callOpts...)
+		if err != nil {
+			endClientSpan(span, nil, nil, err)
+			return nil, err
+		}
+
+		return &clientStream{
+			ClientStream:  cs,
+			span:          span,
+			serverStreams: desc.ServerStreams,
+			in:            opts.newCapture(method),
+			out:           opts.newCapture(method),
+		}, nil
+	}
+}
+
+// startClientSpan starts the span of a client call
+func startClientSpan(ctx context.Context, client *langfuse.Client, opts Options, method string) *langfuse.Span {
+	return client.StartSpan(ctx, opts.name(method), langfuse.WithSpanMetadata(rpcMetadata(method)))
+}
+
+// outgoingContext returns the span's context with the trace context added to
+// the outgoing metadata
+func outgoingContext(span *langfuse.Span) context.Context {
+	ctx := span.Context()
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	span.Inject(metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// endClientSpan records the outcome of a client call and ends its span
+func endClientSpan(span *langfuse.Span, in, out *payloadCapture, err error) {
+	code := status.Code(err)
+	updates := []langfuse.SpanOption{langfuse.WithSpanMetadata(statusMetadata(code))}
+	if input, ok := in.payload(); ok {
+		updates = append(updates, langfuse.WithSpanInput(input))
+	}
+	if output, ok := out.payload(); ok {
+		updates = append(updates, langfuse.WithSpanOutput(output))
+	}
+	if code != codes.OK {
+		updates = append(updates,
+			langfuse.WithSpanLevel(langfuse.LogLevelError),
+			langfuse.WithSpanStatusMessage(statusMessage(code, status.Convert(err).Message())),
+		)
+	}
+	span.Update(updates...)
+	span.End()
+}
+
+// clientStream captures messages and ends the span when the stream completes
+type clientStream struct {
+	grpc.ClientStream
+	span          *langfuse.Span
+	serverStreams bool
+	in, out       *payloadCapture
+	once          sync.Once
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.in.record(m)
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.finish(err)
+		return err
+	}
+	s.out.record(m)
+	if !s.serverStreams {
+		s.finish(nil)
+	}
+	return nil
+}
+
+func (s *clientStream) Header() (metadata.MD, error) {
+	md, err := s.ClientStream.Header()
+	if err != nil {
+		s.finish(err)
+	}
+	return md, err
+}
+
+// finish ends the span exactly once. io.EOF marks a successful end of stream.
+func (s *clientStream) finish(err error) {
+	s.once.Do(func() {
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		endClientSpan(s.span, s.in, s.out, err)
+	})
+}
+
+// rpcMetadata returns the OpenTelemetry RPC attributes of a method as
+// observation metadata
+func rpcMetadata(fullMethod string) map[string]interface{} {
+	md := map[string]interface{}{"rpc.system": "grpc"}
+	if service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/"); ok {
+		md["rpc.service"] = service
+		md["rpc.method"] = method
+	}
+	return md
+}
+
+// statusMetadata records the numeric status code of a call
+func statusMetadata(code codes.Code) map[string]interface{} {
+	return map[string]interface{}{"rpc.grpc.status_code": strconv.Itoa(int(code))}
+}
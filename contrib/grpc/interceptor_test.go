@@ -0,0 +1,314 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/qinrichard/langfuse"
+	"github.com/qinrichard/langfuse/langfusetest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient returns a Langfuse client whose exported spans are recorded.
+// The returned function flushes the client.
+func newTestClient(t *testing.T) (*langfuse.Client, func() *langfusetest.Recorder) {
+	client, recorder := langfusetest.NewClient(t, langfuse.Config{})
+	return client, func() *langfusetest.Recorder {
+		if err := client.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return recorder
+	}
+}
+
+// dialHealth serves the health service with the server interceptors and
+// returns a client connection using the client interceptors. The returned
+// function stops the server once its handlers have returned.
+func dialHealth(t *testing.T, client *langfuse.Client, opts Options) (healthpb.HealthClient, *health.Server, func()) {
+	listener := bufconn.Listen(1 << 20)
+	healthServer := health.NewServer()
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(client, opts)),
+		grpc.StreamInterceptor(StreamServerInterceptor(client, opts)),
+	)
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(client, opts)),
+		grpc.WithStreamInterceptor(StreamClientInterceptor(client, opts)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn), healthServer, server.GracefulStop
+}
+
+// clientAndServer splits the two observations of a call and checks that the
+// server observation continues the client's trace
+func clientAndServer(t *testing.T, spans []sdktrace.ReadOnlySpan) (client, server sdktrace.ReadOnlySpan) {
+	t.Helper()
+	if len(spans) != 2 {
+		t.Fatalf("got %d observations, want one on each side", len(spans))
+	}
+	client, server = spans[0], spans[1]
+	if server.Parent().SpanID() != client.SpanContext().SpanID() {
+		client, server = server, client
+	}
+	if server.Parent().SpanID() != client.SpanContext().SpanID() {
+		t.Fatal("server observation is not a child of the client observation")
+	}
+	return client, server
+}
+
+func TestUnaryInterceptors(t *testing.T) {
+	client, flush := newTestClient(t)
+	health, _, _ := dialHealth(t, client, Options{
+		CapturePayloads: true,
+		UserID: func(ctx context.Context) string {
+			md, _ := metadata.FromIncomingContext(ctx)
+			return metadataCarrier(md).Get("x-user-id")
+		},
+	})
+
+	trace := client.CreateTrace(context.Background(), "agent")
+	ctx := metadata.AppendToOutgoingContext(trace.Context(), "x-user-id", "user-1")
+	if _, err := health.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: "missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("got %v, want NotFound", err)
+	}
+	trace.End()
+
+	spans := flush().Named("grpc.health.v1.Health/Check")
+	if len(spans) != 4 {
+		t.Fatalf("got %d observations, want two per call", len(spans))
+	}
+	var ok, notFound []sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		if langfusetest.Attrs(span)["langfuse.observation.metadata.rpc.grpc.status_code"] == "0" {
+			ok = append(ok, span)
+		} else {
+			notFound = append(notFound, span)
+		}
+	}
+
+	clientSpan, serverSpan := clientAndServer(t, ok)
+	if clientSpan.SpanContext().TraceID().String() != trace.ID() {
+		t.Error("client observation is not part of the caller's trace")
+	}
+	clientAttrs, serverAttrs := langfusetest.Attrs(clientSpan), langfusetest.Attrs(serverSpan)
+	for key, want := range map[string]string{
+		"langfuse.observation.metadata.rpc.system":  "grpc",
+		"langfuse.observation.metadata.rpc.service": "grpc.health.v1.Health",
+		"langfuse.observation.metadata.rpc.method":  "Check",
+		"langfuse.observation.input":                `{}`,
+		"langfuse.observation.output":               `{"status":"SERVING"}`,
+	} {
+		if clientAttrs[key] != want {
+			t.Errorf("client: %s = %s, want %s", key, clientAttrs[key], want)
+		}
+	}
+	for key, want := range map[string]string{
+		"langfuse.observation.type":                "span",
+		"langfuse.observation.metadata.rpc.method": "Check",
+		"langfuse.trace.input":                     `{}`,
+		"langfuse.trace.output":                    `{"status":"SERVING"}`,
+		"langfuse.user.id":                         "user-1",
+	} {
+		if serverAttrs[key] != want {
+			t.Errorf("server: %s = %s, want %s", key, serverAttrs[key], want)
+		}
+	}
+
+	clientSpan, serverSpan = clientAndServer(t, notFound)
+	for side, tt := range map[string]struct {
+		span  sdktrace.ReadOnlySpan
+		level langfuse.LogLevel
+	}{
+		"client": {clientSpan, langfuse.LogLevelError},
+		"server": {serverSpan, langfuse.LogLevelWarning},
+	} {
+		got := langfusetest.Attrs(tt.span)
+		if got["langfuse.observation.level"] != string(tt.level) {
+			t.Errorf("%s: level = %s, want %s", side, got["langfuse.observation.level"], tt.level)
+		}
+		if got["langfuse.observation.status_message"] != "NotFound: unknown service" {
+			t.Errorf("%s: status message = %s", side, got["langfuse.observation.status_message"])
+		}
+		if got["langfuse.observation.metadata.rpc.grpc.status_code"] != "5" {
+			t.Errorf("%s: status code = %s", side, got["langfuse.observation.metadata.rpc.grpc.status_code"])
+		}
+	}
+}
+
+func TestStreamInterceptors(t *testing.T) {
+	client, flush := newTestClient(t)
+	health, healthServer, stop := dialHealth(t, client, Options{CapturePayloads: true})
+
+	trace := client.CreateTrace(context.Background(), "agent")
+	ctx, cancel := context.WithCancel(trace.Context())
+	stream, err := health.Watch(ctx, &healthpb.HealthCheckRequest{Service: "llm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := stream.Recv(); err != nil || resp.Status != healthpb.HealthCheckResponse_SERVICE_UNKNOWN {
+		t.Fatalf("got %v, %v", resp, err)
+	}
+	healthServer.SetServingStatus("llm", healthpb.HealthCheckResponse_SERVING)
+	if resp, err := stream.Recv(); err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("got %v, %v", resp, err)
+	}
+	cancel()
+	if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+		t.Fatalf("got %v, want Canceled", err)
+	}
+	trace.End()
+	stop()
+
+	clientSpan, _ := clientAndServer(t, flush().Named("grpc.health.v1.Health/Watch"))
+	got := langfusetest.Attrs(clientSpan)
+	if got["langfuse.observation.input"] != `{"service":"llm"}` {
+		t.Errorf("input = %s", got["langfuse.observation.input"])
+	}
+	if want := `[{"status":"SERVICE_UNKNOWN"},{"status":"SERVING"}]`; got["langfuse.observation.output"] != want {
+		t.Errorf("output = %s, want %s", got["langfuse.observation.output"], want)
+	}
+	if got["langfuse.observation.level"] != string(langfuse.LogLevelError) {
+		t.Errorf("level = %s, want ERROR for a canceled stream", got["langfuse.observation.level"])
+	}
+}
+
+func TestSkip(t *testing.T) {
+	client, flush := newTestClient(t)
+	health, _, _ := dialHealth(t, client, Options{
+		Skip: func(fullMethod string) bool { return fullMethod == healthpb.Health_Check_FullMethodName },
+	})
+
+	if _, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if spans := flush().Named("grpc.health.v1.Health/Check"); len(spans) != 0 {
+		t.Errorf("got %d observations for a skipped method", len(spans))
+	}
+}
+
+func TestUnaryServerInterceptorStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		panic   interface{}
+		level   langfuse.LogLevel
+		message string
+		code    string
+	}{
+		{"ok", nil, nil, "", "", "0"},
+		{"client error", status.Error(codes.InvalidArgument, "empty prompt"), nil, langfuse.LogLevelWarning, "InvalidArgument: empty prompt", "3"},
+		{"server error", status.Error(codes.Unavailable, "model overloaded"), nil, langfuse.LogLevelError, "Unavailable: model overloaded", "14"},
+		{"plain error", errors.New("boom"), nil, langfuse.LogLevelError, "Unknown: boom", "2"},
+		{"panic", nil, "boom", langfuse.LogLevelError, "Internal: panic: boom", "13"},
+	}
+
+	client, flush := newTestClient(t)
+	interceptor := UnaryServerInterceptor(client, Options{
+		TraceName: func(fullMethod string) string { return "llm " + fullMethod },
+	})
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if recovered := recover(); recovered != tt.panic {
+					t.Errorf("%s: recovered %v, want %v", tt.name, recovered, tt.panic)
+				}
+			}()
+			info := &grpc.UnaryServerInfo{FullMethod: "/llm.Gateway/" + tt.name}
+			interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				if langfuse.SpanFromContext(ctx) == nil {
+					t.Errorf("%s: handler context carries no span", tt.name)
+				}
+				if tt.panic != nil {
+					panic(tt.panic)
+				}
+				return nil, tt.err
+			})
+		}()
+	}
+
+	recorder := flush()
+	for _, tt := range tests {
+		spans := recorder.Named("llm /llm.Gateway/" + tt.name)
+		if len(spans) != 1 {
+			t.Errorf("%s: got %d observations, want 1", tt.name, len(spans))
+			continue
+		}
+		got := langfusetest.Attrs(spans[0])
+		if got["langfuse.observation.level"] != string(tt.level) {
+			t.Errorf("%s: level = %q, want %q", tt.name, got["langfuse.observation.level"], tt.level)
+		}
+		if got["langfuse.observation.status_message"] != tt.message {
+			t.Errorf("%s: status message = %q, want %q", tt.name, got["langfuse.observation.status_message"], tt.message)
+		}
+		if got["langfuse.observation.metadata.rpc.grpc.status_code"] != tt.code {
+			t.Errorf("%s: status code = %q, want %q", tt.name, got["langfuse.observation.metadata.rpc.grpc.status_code"], tt.code)
+		}
+	}
+}
+
+func TestClientStreamEOF(t *testing.T) {
+	client, flush := newTestClient(t)
+	interceptor := StreamClientInterceptor(client, Options{})
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		if len(md.Get("traceparent")) != 1 {
+			t.Error("outgoing metadata carries no traceparent")
+		}
+		return eofStream{}, nil
+	}
+
+	trace := client.CreateTrace(context.Background(), "agent")
+	stream, err := interceptor(trace.Context(), &grpc.StreamDesc{ServerStreams: true}, nil, "/llm.Gateway/Stream", streamer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := stream.RecvMsg(nil); err != io.EOF {
+			t.Fatalf("got %v, want io.EOF", err)
+		}
+	}
+	trace.End()
+
+	spans := flush().Named("llm.Gateway/Stream")
+	if len(spans) != 1 {
+		t.Fatalf("got %d observations, want 1", len(spans))
+	}
+	if got := langfusetest.Attrs(spans[0]); got["langfuse.observation.level"] != "" || got["langfuse.observation.metadata.rpc.grpc.status_code"] != "0" {
+		t.Errorf("io.EOF recorded as level %q, status code %q", got["langfuse.observation.level"], got["langfuse.observation.metadata.rpc.grpc.status_code"])
+	}
+}
+
+// eofStream is a client stream that has ended
+type eofStream struct {
+	grpc.ClientStream
+}
+
+func (eofStream) RecvMsg(m interface{}) error {
+	return io.EOF
+}
@@ -0,0 +1,31 @@
+package grpc
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestMetadataCarrier(t *testing.T) {
+	md := metadata.Pairs("x-user-id", "user-1", "x-user-id", "user-2")
+	carrier := metadataCarrier(md)
+	carrier.Set("Traceparent", "00-1-2-01")
+
+	if got := carrier.Get("traceparent"); got != "00-1-2-01" {
+		t.Errorf("Get(traceparent) = %q", got)
+	}
+	if got := carrier.Get("X-User-ID"); got != "user-1" {
+		t.Errorf("Get(X-User-ID) = %q, want the first value", got)
+	}
+	if got := carrier.Get("baggage"); got != "" {
+		t.Errorf("Get(baggage) = %q, want empty", got)
+	}
+
+	keys := carrier.Keys()
+	sort.Strings(keys)
+	if want := []string{"traceparent", "x-user-id"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Keys() = %v, want %v", keys, want)
+	}
+}
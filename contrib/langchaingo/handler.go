@@ -0,0 +1,464 @@
+// Package langchaingo records github.com/tmc/langchaingo runs in Langfuse
+// through a callbacks.Handler.
+//
+//	trace := client.CreateTrace(ctx, "qa")
+//	handler := langchaingo.NewHandler(trace)
+//	chain := chains.NewRetrievalQAFromLLM(llm, retriever)
+//	chain.Callbacks = handler
+//
+// Chains become chain spans, LLM calls generations, tools tool spans,
+// retrievers retriever spans and agent actions events. langchaingo callbacks
+// carry no run IDs, so observations are nested by the order in which they are
+// started and ended. Use one Handler per run rather than sharing it between
+// concurrent runs.
+package langchaingo
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qinrichard/langfuse"
+	"github.com/tmc/langchaingo/callbacks"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+)
+
+// Handler is a callbacks.Handler that records a run under a trace
+type Handler struct {
+	trace *langfuse.Trace
+	model string
+
+	mu         sync.Mutex
+	stack      []openSpan
+	generation *langfuse.Generation
+	firstChunk bool
+	toolName   string
+}
+
+var _ callbacks.Handler = (*Handler)(nil)
+
+// Kinds of spans kept on the stack
+const (
+	kindChain     = "chain"
+	kindTool      = "tool"
+	kindRetriever = "retriever"
+)
+
+// openSpan is a started span that has not ended yet
+type openSpan struct {
+	kind string
+	span *langfuse.Span
+}
+
+// parent creates observations; both *langfuse.Trace and *langfuse.Span
+// implement it
+type parent interface {
+	CreateGeneration(name string, opts ...langfuse.GenerationOption) *langfuse.Generation
+	CreateEvent(name string, opts ...langfuse.EventOption) *langfuse.Event
+	CreateChain(name string, opts ...langfuse.SpanOption) *langfuse.Span
+	CreateTool(name string, opts ...langfuse.SpanOption) *langfuse.Span
+	CreateRetriever(name string, opts ...langfuse.SpanOption) *langfuse.Span
+}
+
+// HandlerOption defines options for Handler creation
+type HandlerOption func(*Handler)
+
+// WithModel sets the model name recorded on generations, which langchaingo
+// does not pass to callbacks
+func WithModel(model string) HandlerOption {
+	return func(h *Handler) {
+		h.model = model
+	}
+}
+
+// NewHandler creates a handler that records observations under trace
+func NewHandler(trace *langfuse.Trace, opts ...HandlerOption) *Handler {
+	h := &Handler{trace: trace}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// current returns the innermost open span, or the trace
+func (h *Handler) current() parent {
+	if n := len(h.stack); n > 0 {
+		return h.stack[n-1].span
+	}
+	return h.trace
+}
+
+func (h *Handler) push(kind string, span *langfuse.Span) {
+	h.stack = append(h.stack, openSpan{kind: kind, span: span})
+}
+
+// pop removes the innermost open span of the given kind. Spans opened after it
+// that were never ended are ended as well.
+func (h *Handler) pop(kind string) *langfuse.Span {
+	for i := len(h.stack) - 1; i >= 0; i-- {
+		if h.stack[i].kind != kind {
+			continue
+		}
+		span := h.stack[i].span
+		for _, dangling := range h.stack[i+1:] {
+			dangling.span.End()
+		}
+		h.stack = h.stack[:i]
+		return span
+	}
+	return nil
+}
+
+// HandleText is ignored
+func (h *Handler) HandleText(ctx context.Context, text string) {}
+
+// HandleLLMStart starts a generation for a completion-style call
+func (h *Handler) HandleLLMStart(ctx context.Context, prompts []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.startGeneration(langfuse.WithGenerationInput(prompts))
+}
+
+// HandleLLMGenerateContentStart starts a generation for a chat call
+func (h *Handler) HandleLLMGenerateContentStart(ctx context.Context, ms []llms.MessageContent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.startGeneration(langfuse.WithGenerationInput(chatInput(ms)))
+}
+
+func (h *Handler) startGeneration(input langfuse.GenerationOption) {
+	if h.generation != nil {
+		h.generation.End()
+	}
+	opts := []langfuse.GenerationOption{input}
+	if h.model != "" {
+		opts = append(opts, langfuse.WithGenerationModel(h.model))
+	}
+	h.generation = h.current().CreateGeneration("llm", opts...)
+	h.firstChunk = false
+}
+
+// HandleStreamingFunc records the arrival of the first streamed chunk as the
+// completion start time
+func (h *Handler) HandleStreamingFunc(ctx context.Context, chunk []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.generation != nil && !h.firstChunk && len(chunk) > 0 {
+		h.firstChunk = true
+		h.generation.Update(langfuse.WithGenerationStartTime(time.Now()))
+	}
+}
+
+// HandleLLMGenerateContentEnd ends the generation with the first choice as
+// output
+func (h *Handler) HandleLLMGenerateContentEnd(ctx context.Context, res *llms.ContentResponse) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.generation == nil {
+		return
+	}
+	if res != nil && len(res.Choices) > 0 && res.Choices[0] != nil {
+		h.generation.Update(choiceOptions(res.Choices[0])...)
+	}
+	h.generation.End()
+	h.generation = nil
+}
+
+// HandleLLMError ends the generation as failed
+func (h *Handler) HandleLLMError(ctx context.Context, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.generation == nil {
+		return
+	}
+	h.generation.Update(
+		langfuse.WithGenerationLevel(langfuse.LogLevelError),
+		langfuse.WithGenerationStatusMessage(err.Error()),
+	)
+	h.generation.End()
+	h.generation = nil
+}
+
+// HandleChainStart starts a chain span
+func (h *Handler) HandleChainStart(ctx context.Context, inputs map[string]any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.push(kindChain, h.current().CreateChain("chain", langfuse.WithSpanInput(inputs)))
+}
+
+// HandleChainEnd ends the innermost chain span
+func (h *Handler) HandleChainEnd(ctx context.Context, outputs map[string]any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if span := h.pop(kindChain); span != nil {
+		span.Update(langfuse.WithSpanOutput(outputs))
+		span.End()
+	}
+}
+
+// HandleChainError ends the innermost chain span as failed
+func (h *Handler) HandleChainError(ctx context.Context, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	endWithError(h.pop(kindChain), err)
+}
+
+// HandleToolStart starts a tool span, named after the tool of the preceding
+// agent action if there was one
+func (h *Handler) HandleToolStart(ctx context.Context, input string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	name := "tool"
+	opts := []langfuse.SpanOption{langfuse.WithToolArguments(input)}
+	if h.toolName != "" {
+		name = h.toolName
+		opts = append(opts, langfuse.WithToolName(h.toolName))
+		h.toolName = ""
+	}
+	h.push(kindTool, h.current().CreateTool(name, opts...))
+}
+
+// HandleToolEnd ends the innermost tool span
+func (h *Handler) HandleToolEnd(ctx context.Context, output string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if span := h.pop(kindTool); span != nil {
+		span.Update(langfuse.WithToolResult(output))
+		span.End()
+	}
+}
+
+// HandleToolError ends the innermost tool span as failed
+func (h *Handler) HandleToolError(ctx context.Context, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	endWithError(h.pop(kindTool), err)
+}
+
+// HandleAgentAction records the action as an event
+func (h *Handler) HandleAgentAction(ctx context.Context, action schema.AgentAction) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.toolName = action.Tool
+	h.current().CreateEvent("agent-action",
+		langfuse.WithEventInput(map[string]interface{}{
+			"tool":       action.Tool,
+			"tool_input": action.ToolInput,
+			"tool_id":    action.ToolID,
+		}),
+		agentLog(action.Log),
+	)
+}
+
+// HandleAgentFinish records the final answer as an event
+func (h *Handler) HandleAgentFinish(ctx context.Context, finish schema.AgentFinish) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.current().CreateEvent("agent-finish",
+		langfuse.WithEventOutput(finish.ReturnValues),
+		agentLog(finish.Log),
+	)
+}
+
+// agentLog records the agent's reasoning log as event metadata
+func agentLog(log string) langfuse.EventOption {
+	metadata := map[string]interface{}{}
+	if log != "" {
+		metadata["log"] = log
+	}
+	return langfuse.WithEventMetadata(metadata)
+}
+
+// HandleRetrieverStart starts a retriever span
+func (h *Handler) HandleRetrieverStart(ctx context.Context, query string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.push(kindRetriever, h.current().CreateRetriever("retriever", langfuse.WithRetrieverQuery(query)))
+}
+
+// HandleRetrieverEnd ends the innermost retriever span with the documents
+func (h *Handler) HandleRetrieverEnd(ctx context.Context, query string, documents []schema.Document) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	span := h.pop(kindRetriever)
+	if span == nil {
+		return
+	}
+	docs := make([]langfuse.RetrievedDocument, 0, len(documents))
+	for _, d := range documents {
+		doc := langfuse.RetrievedDocument{Content: d.PageContent, Metadata: d.Metadata}
+		if d.Score != 0 {
+			score := float64(d.Score)
+			doc.Score = &score
+		}
+		docs = append(docs, doc)
+	}
+	span.Update(langfuse.WithRetrievedDocuments(docs))
+	span.End()
+}
+
+// endWithError ends a span as failed
+func endWithError(span *langfuse.Span, err error) {
+	if span == nil {
+		return
+	}
+	span.Update(
+		langfuse.WithSpanLevel(langfuse.LogLevelError),
+		langfuse.WithSpanStatusMessage(err.Error()),
+	)
+	span.End()
+}
+
+// chatRoles maps langchaingo message types to chat roles
+var chatRoles = map[llms.ChatMessageType]string{
+	llms.ChatMessageTypeSystem:   langfuse.ChatRoleSystem,
+	llms.ChatMessageTypeHuman:    langfuse.ChatRoleUser,
+	llms.ChatMessageTypeGeneric:  langfuse.ChatRoleUser,
+	llms.ChatMessageTypeAI:       langfuse.ChatRoleAssistant,
+	llms.ChatMessageTypeTool:     langfuse.ChatRoleTool,
+	llms.ChatMessageTypeFunction: langfuse.ChatRoleTool,
+}
+
+// chatInput converts langchaingo messages into a chat input. Tool responses
+// become separate tool messages.
+func chatInput(ms []llms.MessageContent) langfuse.ChatInput {
+	var input langfuse.ChatInput
+	for _, m := range ms {
+		role, ok := chatRoles[m.Role]
+		if !ok {
+			role = string(m.Role)
+		}
+		msg := langfuse.ChatMessage{Role: role}
+		var toolMessages []langfuse.ChatMessage
+
+		for _, part := range m.Parts {
+			switch p := part.(type) {
+			case llms.TextContent:
+				msg.Parts = append(msg.Parts, langfuse.TextPart(p.Text))
+			case llms.ImageURLContent:
+				image := langfuse.ImagePart(p.URL)
+				image.ImageURL.Detail = p.Detail
+				msg.Parts = append(msg.Parts, image)
+			case llms.BinaryContent:
+				msg.Parts = append(msg.Parts, binaryPart(p))
+			case llms.ToolCall:
+				if p.FunctionCall != nil {
+					msg.ToolCalls = append(msg.ToolCalls, langfuse.NewToolCall(p.ID, p.FunctionCall.Name, p.FunctionCall.Arguments))
+				}
+			case llms.ToolCallResponse:
+				toolMessages = append(toolMessages, langfuse.ChatMessage{
+					Role:       langfuse.ChatRoleTool,
+					Name:       p.Name,
+					Content:    p.Content,
+					ToolCallID: p.ToolCallID,
+				})
+			}
+		}
+
+		// Collapse text-only content to a plain string for readability
+		if len(msg.Parts) == 1 && msg.Parts[0].Type == langfuse.ContentPartTypeText {
+			msg.Content = msg.Parts[0].Text
+			msg.Parts = nil
+		}
+
+		input.Messages = append(input.Messages, toolMessages...)
+		if len(msg.Parts) > 0 || msg.Content != "" || len(msg.ToolCalls) > 0 {
+			input.Messages = append(input.Messages, msg)
+		}
+	}
+	return input
+}
+
+// binaryPart converts inline binary content into an image, audio or file
+// part depending on its MIME type
+func binaryPart(p llms.BinaryContent) langfuse.ContentPart {
+	media := langfuse.NewMediaFromBytes(p.Data, p.MIMEType)
+	switch {
+	case strings.HasPrefix(p.MIMEType, "image/"):
+		return langfuse.ImagePartFromMedia(media)
+	case strings.HasPrefix(p.MIMEType, "audio/"):
+		return langfuse.AudioPartFromMedia(media)
+	}
+	return langfuse.FilePartFromMedia(media, "")
+}
+
+// usageKeys maps the token counts reported in GenerationInfo by the
+// langchaingo providers to Langfuse usage details. OpenAI counts cached
+// prompt tokens as part of the prompt, while Anthropic reports cache reads
+// and writes separately from the input tokens.
+var usageKeys = map[string]string{
+	"PromptTokens":             "input",
+	"InputTokens":              "input",
+	"CompletionTokens":         "output",
+	"OutputTokens":             "output",
+	"TotalTokens":              "total",
+	"ReasoningTokens":          "output_reasoning_tokens",
+	"PromptCachedTokens":       "input_cached_tokens",
+	"CacheReadInputTokens":     "cache_read_input_tokens",
+	"CacheCreationInputTokens": "cache_creation_input_tokens",
+}
+
+// usageDetails collects the token counts of GenerationInfo into Langfuse
+// usage details, or nil if there are none
+func usageDetails(info map[string]any) map[string]int {
+	counts := make(map[string]int)
+	for key, detail := range usageKeys {
+		if count, ok := intValue(info[key]); ok && count > 0 {
+			counts[detail] = count
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	input, output, total := counts["input"], counts["output"], counts["total"]
+	if total == 0 {
+		total = input + output + counts["cache_read_input_tokens"] + counts["cache_creation_input_tokens"]
+	}
+	delete(counts, "input")
+	delete(counts, "output")
+	delete(counts, "total")
+	return langfuse.NewUsageDetails(input, output, total, counts)
+}
+
+// choiceOptions maps a content choice onto generation options
+func choiceOptions(choice *llms.ContentChoice) []langfuse.GenerationOption {
+	message := langfuse.ChatMessage{Role: langfuse.ChatRoleAssistant, Content: choice.Content}
+	for _, tc := range choice.ToolCalls {
+		if tc.FunctionCall != nil {
+			message.ToolCalls = append(message.ToolCalls, langfuse.NewToolCall(tc.ID, tc.FunctionCall.Name, tc.FunctionCall.Arguments))
+		}
+	}
+	if len(message.ToolCalls) == 0 && choice.FuncCall != nil {
+		message.ToolCalls = append(message.ToolCalls, langfuse.NewToolCall("", choice.FuncCall.Name, choice.FuncCall.Arguments))
+	}
+
+	opts := []langfuse.GenerationOption{langfuse.WithGenerationOutput(message)}
+
+	if usage := usageDetails(choice.GenerationInfo); usage != nil {
+		opts = append(opts, langfuse.WithGenerationUsageDetails(usage))
+	}
+
+	if choice.StopReason != "" {
+		opts = append(opts, langfuse.WithGenerationMetadata(map[string]interface{}{
+			"stop_reason": choice.StopReason,
+		}))
+	}
+	return opts
+}
+
+// intValue converts the numeric types providers use for token counts
+func intValue(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,221 @@
+package langchaingo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/qinrichard/langfuse"
+	"github.com/qinrichard/langfuse/langfusetest"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/schema"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// newTestTrace returns a trace and a function that ends it, flushes the
+// client and returns the recorded spans
+func newTestTrace(t *testing.T) (*langfuse.Trace, func() *langfusetest.Recorder) {
+	client, recorder := langfusetest.NewClient(t, langfuse.Config{})
+	trace := client.CreateTrace(context.Background(), "run")
+	return trace, func() *langfusetest.Recorder {
+		trace.End()
+		if err := client.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return recorder
+	}
+}
+
+func TestHandlerNesting(t *testing.T) {
+	trace, flush := newTestTrace(t)
+	h := NewHandler(trace, WithModel("gpt-4o"))
+	ctx := context.Background()
+
+	h.HandleChainStart(ctx, map[string]any{"question": "weather?"})
+	h.HandleRetrieverStart(ctx, "weather")
+	h.HandleRetrieverEnd(ctx, "weather", []schema.Document{{PageContent: "sunny", Score: 0.5}})
+	h.HandleLLMGenerateContentStart(ctx, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "weather?")})
+	h.HandleStreamingFunc(ctx, []byte("Sun"))
+	h.HandleLLMGenerateContentEnd(ctx, &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		Content:        "Sunny",
+		StopReason:     "stop",
+		GenerationInfo: map[string]any{"PromptTokens": 10, "CompletionTokens": 5, "TotalTokens": 15},
+	}}})
+	h.HandleAgentAction(ctx, schema.AgentAction{Tool: "get_weather", ToolInput: "Paris", Log: "checking"})
+	h.HandleToolStart(ctx, "Paris")
+	h.HandleToolEnd(ctx, "sunny")
+	h.HandleChainEnd(ctx, map[string]any{"answer": "Sunny"})
+	recorder := flush()
+
+	chain := recorder.Find(t, "chain")
+	tests := []struct {
+		name   string
+		parent sdktrace.ReadOnlySpan
+		want   map[string]string
+	}{
+		{
+			name:   "chain",
+			parent: recorder.Find(t, "run"),
+			want: map[string]string{
+				"langfuse.observation.type":   "chain",
+				"langfuse.observation.input":  `{"question":"weather?"}`,
+				"langfuse.observation.output": `{"answer":"Sunny"}`,
+			},
+		},
+		{
+			name:   "retriever",
+			parent: chain,
+			want: map[string]string{
+				"langfuse.observation.type":   "retriever",
+				"langfuse.observation.input":  `"weather"`,
+				"langfuse.observation.output": `{"documents":[{"content":"sunny","score":0.5}]}`,
+			},
+		},
+		{
+			name:   "llm",
+			parent: chain,
+			want: map[string]string{
+				"langfuse.observation.model.name":           "gpt-4o",
+				"langfuse.observation.input":                `{"messages":[{"role":"user","content":"weather?"}]}`,
+				"langfuse.observation.output":               `{"role":"assistant","content":"Sunny"}`,
+				"langfuse.observation.usage_details":        `{"input":10,"output":5,"total":15}`,
+				"langfuse.observation.metadata.stop_reason": "stop",
+			},
+		},
+		{
+			name:   "agent-action",
+			parent: chain,
+			want: map[string]string{
+				"langfuse.observation.input":        `{"tool":"get_weather","tool_id":"","tool_input":"Paris"}`,
+				"langfuse.observation.metadata.log": "checking",
+			},
+		},
+		{
+			name:   "get_weather",
+			parent: chain,
+			want: map[string]string{
+				"langfuse.observation.type":               "tool",
+				"langfuse.observation.metadata.tool_name": "get_weather",
+				"langfuse.observation.input":              `"Paris"`,
+				"langfuse.observation.output":             `"sunny"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span := recorder.Find(t, tt.name)
+			if span.Parent().SpanID() != tt.parent.SpanContext().SpanID() {
+				t.Errorf("parent is not %s", tt.parent.Name())
+			}
+			got := langfusetest.Attrs(span)
+			for key, value := range tt.want {
+				if got[key] != value {
+					t.Errorf("%s = %s, want %s", key, got[key], value)
+				}
+			}
+		})
+	}
+	if langfusetest.Attrs(recorder.Find(t, "llm"))["langfuse.observation.completion_start_time"] == "" {
+		t.Error("completion start time not recorded")
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	trace, flush := newTestTrace(t)
+	h := NewHandler(trace)
+	ctx := context.Background()
+
+	h.HandleChainStart(ctx, nil)
+	// A tool left open when its chain fails is ended with the chain
+	h.HandleToolStart(ctx, "input")
+	h.HandleLLMStart(ctx, []string{"prompt"})
+	h.HandleLLMError(ctx, errors.New("rate limited"))
+	h.HandleChainError(ctx, errors.New("chain failed"))
+	recorder := flush()
+
+	tests := []struct {
+		name    string
+		level   string
+		message string
+	}{
+		{name: "llm", level: string(langfuse.LogLevelError), message: "rate limited"},
+		{name: "chain", level: string(langfuse.LogLevelError), message: "chain failed"},
+		{name: "tool"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := langfusetest.Attrs(recorder.Find(t, tt.name))
+			if got["langfuse.observation.level"] != tt.level {
+				t.Errorf("level = %q, want %q", got["langfuse.observation.level"], tt.level)
+			}
+			if got["langfuse.observation.status_message"] != tt.message {
+				t.Errorf("status message = %q, want %q", got["langfuse.observation.status_message"], tt.message)
+			}
+		})
+	}
+}
+
+func TestUsageDetails(t *testing.T) {
+	tests := []struct {
+		name string
+		info map[string]any
+		want map[string]int
+	}{
+		{name: "none", info: map[string]any{"StopReason": "stop"}},
+		{
+			name: "openai",
+			info: map[string]any{"PromptTokens": 100, "CompletionTokens": 50, "TotalTokens": 150, "ReasoningTokens": 20, "PromptCachedTokens": 30},
+			want: map[string]int{"input": 70, "output": 30, "total": 150, "input_cached_tokens": 30, "output_reasoning_tokens": 20},
+		},
+		{
+			name: "anthropic",
+			info: map[string]any{"InputTokens": int64(10), "OutputTokens": float64(5), "CacheReadInputTokens": 40, "CacheCreationInputTokens": 8},
+			want: map[string]int{"input": 10, "output": 5, "total": 63, "cache_read_input_tokens": 40, "cache_creation_input_tokens": 8},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := usageDetails(tt.info); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatInput(t *testing.T) {
+	input := chatInput([]llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "Be brief"),
+		{Role: llms.ChatMessageTypeHuman, Parts: []llms.ContentPart{
+			llms.TextContent{Text: "What is this?"},
+			llms.ImageURLContent{URL: "https://example.com/cat.png", Detail: "low"},
+			llms.BinaryContent{MIMEType: "image/png", Data: []byte("png")},
+			llms.BinaryContent{MIMEType: "audio/wav", Data: []byte("wav")},
+			llms.BinaryContent{MIMEType: "application/pdf", Data: []byte("pdf")},
+		}},
+		{Role: llms.ChatMessageTypeAI, Parts: []llms.ContentPart{
+			llms.ToolCall{ID: "call_1", Type: "function", FunctionCall: &llms.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+		}},
+		{Role: llms.ChatMessageTypeTool, Parts: []llms.ContentPart{
+			llms.ToolCallResponse{ToolCallID: "call_1", Name: "get_weather", Content: "sunny"},
+		}},
+	})
+
+	image := langfuse.ImagePart("https://example.com/cat.png")
+	image.ImageURL.Detail = "low"
+	want := []langfuse.ChatMessage{
+		{Role: langfuse.ChatRoleSystem, Content: "Be brief"},
+		{Role: langfuse.ChatRoleUser, Parts: []langfuse.ContentPart{
+			langfuse.TextPart("What is this?"),
+			image,
+			langfuse.ImagePartFromMedia(langfuse.NewMediaFromBytes([]byte("png"), "image/png")),
+			langfuse.AudioPartFromMedia(langfuse.NewMediaFromBytes([]byte("wav"), "audio/wav")),
+			langfuse.FilePartFromMedia(langfuse.NewMediaFromBytes([]byte("pdf"), "application/pdf"), ""),
+		}},
+		{Role: langfuse.ChatRoleAssistant, ToolCalls: []langfuse.ToolCall{langfuse.NewToolCall("call_1", "get_weather", `{"city":"Paris"}`)}},
+		{Role: langfuse.ChatRoleTool, Name: "get_weather", Content: "sunny", ToolCallID: "call_1"},
+	}
+	if !reflect.DeepEqual(input.Messages, want) {
+		t.Errorf("messages:\n got %+v\nwant %+v", input.Messages, want)
+	}
+}
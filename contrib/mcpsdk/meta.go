@@ -0,0 +1,90 @@
+package mcpsdk
+
+import (
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// metaCarrier adapts a request _meta map to propagation.TextMapCarrier, so
+// the trace context travels as the traceparent, tracestate and baggage keys
+type metaCarrier map[string]any
+
+var _ propagation.TextMapCarrier = metaCarrier(nil)
+
+// Get returns the string value stored under key
+func (m metaCarrier) Get(key string) string {
+	value, _ := m[key].(string)
+	return value
+}
+
+// Set stores a string value under key
+func (m metaCarrier) Set(key, value string) {
+	m[key] = value
+}
+
+// Keys lists the keys with string values
+func (m metaCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key, value := range m {
+		if _, ok := value.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// withMeta returns a copy of a client request whose params carry meta. It
+// reports false for request types other than the instrumented ones.
+func withMeta(req mcp.Request, meta metaCarrier) (mcp.Request, bool) {
+	switch r := req.(type) {
+	case *mcp.ClientRequest[mcp.Params]:
+		// ClientSession methods send their params behind the interface
+		params, ok := cloneParams(r.Params)
+		if !ok {
+			return nil, false
+		}
+		params.SetMeta(meta)
+		return &mcp.ClientRequest[mcp.Params]{Session: r.Session, Params: params}, true
+	case *mcp.ClientRequest[*mcp.CallToolParams]:
+		return cloneWithMeta(r, meta), true
+	case *mcp.ClientRequest[*mcp.ReadResourceParams]:
+		return cloneWithMeta(r, meta), true
+	case *mcp.ClientRequest[*mcp.GetPromptParams]:
+		return cloneWithMeta(r, meta), true
+	}
+	return nil, false
+}
+
+// cloneParams copies the params of an instrumented request. It reports false
+// for other params.
+func cloneParams(params mcp.Params) (mcp.Params, bool) {
+	switch p := params.(type) {
+	case *mcp.CallToolParams:
+		return clone(p), true
+	case *mcp.ReadResourceParams:
+		return clone(p), true
+	case *mcp.GetPromptParams:
+		return clone(p), true
+	}
+	return nil, false
+}
+
+// cloneWithMeta copies a client request and its params and sets meta on the
+// copied params
+func cloneWithMeta[T any, P interface {
+	*T
+	mcp.Params
+}](r *mcp.ClientRequest[P], meta metaCarrier) *mcp.ClientRequest[P] {
+	params := P(clone((*T)(r.Params)))
+	params.SetMeta(meta)
+	return &mcp.ClientRequest[P]{Session: r.Session, Params: params}
+}
+
+// clone returns a shallow copy of p, or a zero value when p is nil
+func clone[T any](p *T) *T {
+	c := new(T)
+	if p != nil {
+		*c = *p
+	}
+	return c
+}
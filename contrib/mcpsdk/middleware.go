@@ -0,0 +1,256 @@
+// Package mcpsdk instruments clients and servers of the Model Context
+// Protocol Go SDK (github.com/modelcontextprotocol/go-sdk) with Langfuse.
+//
+//	client := mcp.NewClient(impl, nil)
+//	client.AddSendingMiddleware(mcpsdk.ClientMiddleware(lf))
+//
+//	server := mcp.NewServer(impl, nil)
+//	server.AddReceivingMiddleware(mcpsdk.ServerMiddleware(lf))
+//
+// Each tools/call is recorded as a tool observation and each resources/read
+// and prompts/get as a span, with arguments, results and errors. The client
+// writes the W3C trace context into the request _meta, from which the server
+// continues the trace, so server-side observations join the client's trace.
+// Other methods are passed through unchanged.
+package mcpsdk
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/qinrichard/langfuse"
+)
+
+// Instrumented MCP methods
+const (
+	methodCallTool     = "tools/call"
+	methodReadResource = "resources/read"
+	methodGetPrompt    = "prompts/get"
+)
+
+// ClientMiddleware returns a sending middleware for mcp.Client that records
+// requests under the current observation of the request context and
+// propagates the trace context to the server
+func ClientMiddleware(client *langfuse.Client) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			call, ok := parseCall(method, req)
+			if !ok {
+				return next(ctx, method, req)
+			}
+
+			var span *langfuse.Span
+			if method == methodCallTool {
+				span = client.StartTool(ctx, call.name(), call.startOptions(req)...)
+			} else {
+				span = client.StartSpan(ctx, call.name(), call.startOptions(req)...)
+			}
+
+			// The trace context goes into a copy of the request, so the
+			// caller's params and their _meta are left untouched
+			meta := make(metaCarrier, len(req.GetParams().GetMeta())+3)
+			for key, value := range req.GetParams().GetMeta() {
+				meta[key] = value
+			}
+			span.Inject(meta)
+			if injected, ok := withMeta(req, meta); ok {
+				req = injected
+			}
+
+			result, err := next(span.Context(), method, req)
+			span.Update(resultOptions(result, err)...)
+			span.End()
+			return result, err
+		}
+	}
+}
+
+// ServerMiddleware returns a receiving middleware for mcp.Server that
+// continues the client's trace from the request _meta and records the
+// request under it. Handlers receive a context carrying the observation, so
+// observations they create are nested under it.
+func ServerMiddleware(client *langfuse.Client) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			call, ok := parseCall(method, req)
+			if !ok {
+				return next(ctx, method, req)
+			}
+
+			// The observation is the root of the trace in this service, so
+			// the request is recorded once
+			carrier := metaCarrier(req.GetParams().GetMeta())
+			var span *langfuse.Span
+			if method == methodCallTool {
+				span = client.ContinueTool(ctx, carrier, call.name(), call.startOptions(req)...)
+			} else {
+				span = client.ContinueSpan(ctx, carrier, call.name(), call.startOptions(req)...)
+			}
+
+			result, err := next(langfuse.ContextWithSpan(ctx, span), method, req)
+			span.Update(resultOptions(result, err)...)
+			span.End()
+			return result, err
+		}
+	}
+}
+
+// call holds the fields of an instrumented request. Client and server params
+// differ in type, e.g. mcp.CallToolParams and mcp.CallToolParamsRaw, so they
+// are read from their wire format.
+type call struct {
+	method    string
+	Name      string          `json:"name"`
+	URI       string          `json:"uri"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// parseCall reads an instrumented request. It reports false for other
+// methods.
+func parseCall(method string, req mcp.Request) (call, bool) {
+	switch method {
+	case methodCallTool, methodReadResource, methodGetPrompt:
+	default:
+		return call{}, false
+	}
+	c := call{method: method}
+	if req == nil || req.GetParams() == nil {
+		return c, false
+	}
+	if data, err := json.Marshal(req.GetParams()); err == nil {
+		_ = json.Unmarshal(data, &c)
+	}
+	return c, true
+}
+
+// name names the observation after the method and its target, e.g.
+// "tools/call get_weather"
+func (c call) name() string {
+	target := c.Name
+	if c.method == methodReadResource {
+		target = c.URI
+	}
+	if target == "" {
+		return c.method
+	}
+	return c.method + " " + target
+}
+
+// startOptions records the request arguments and the MCP method and session
+func (c call) startOptions(req mcp.Request) []langfuse.SpanOption {
+	metadata := map[string]interface{}{"mcp_method": c.method}
+	if id := sessionID(req.GetSession()); id != "" {
+		metadata["mcp_session_id"] = id
+	}
+	opts := []langfuse.SpanOption{langfuse.WithSpanMetadata(metadata)}
+
+	switch c.method {
+	case methodCallTool:
+		opts = append(opts, langfuse.WithToolName(c.Name))
+		if len(c.Arguments) > 0 {
+			opts = append(opts, langfuse.WithToolArguments(c.Arguments))
+		}
+	case methodReadResource:
+		opts = append(opts, langfuse.WithSpanInput(map[string]string{"uri": c.URI}))
+	case methodGetPrompt:
+		input := map[string]interface{}{"name": c.Name}
+		if len(c.Arguments) > 0 {
+			input["arguments"] = c.Arguments
+		}
+		opts = append(opts, langfuse.WithSpanInput(input))
+	}
+	return opts
+}
+
+// sessionID returns the ID of a client or server session
+func sessionID(session mcp.Session) string {
+	switch s := session.(type) {
+	case *mcp.ClientSession:
+		if s != nil {
+			return s.ID()
+		}
+	case *mcp.ServerSession:
+		if s != nil {
+			return s.ID()
+		}
+	}
+	return ""
+}
+
+// resultOptions records the result of a request. Tool results flagged as
+// errors are recorded at error level with their text as status message.
+func resultOptions(result mcp.Result, err error) []langfuse.SpanOption {
+	if err != nil {
+		return []langfuse.SpanOption{
+			langfuse.WithSpanLevel(langfuse.LogLevelError),
+			langfuse.WithSpanStatusMessage(err.Error()),
+		}
+	}
+
+	switch r := result.(type) {
+	case *mcp.CallToolResult:
+		if r == nil {
+			return nil
+		}
+		var opts []langfuse.SpanOption
+		if r.StructuredContent != nil {
+			opts = append(opts, langfuse.WithToolResult(r.StructuredContent))
+		} else {
+			opts = append(opts, langfuse.WithToolResult(r.Content))
+		}
+		if r.IsError {
+			opts = append(opts,
+				langfuse.WithSpanLevel(langfuse.LogLevelError),
+				langfuse.WithSpanStatusMessage(contentText(r.Content)),
+			)
+		}
+		return opts
+	case *mcp.ReadResourceResult:
+		if r == nil {
+			return nil
+		}
+		return []langfuse.SpanOption{langfuse.WithSpanOutput(r.Contents)}
+	case *mcp.GetPromptResult:
+		if r == nil {
+			return nil
+		}
+		return []langfuse.SpanOption{langfuse.WithSpanOutput(promptMessages(r.Messages))}
+	}
+	return nil
+}
+
+// promptMessages converts prompt messages into chat messages. Content other
+// than text is recorded in its wire format.
+func promptMessages(messages []*mcp.PromptMessage) []langfuse.ChatMessage {
+	result := make([]langfuse.ChatMessage, 0, len(messages))
+	for _, m := range messages {
+		if m == nil {
+			continue
+		}
+		msg := langfuse.ChatMessage{Role: string(m.Role)}
+		if text, ok := m.Content.(*mcp.TextContent); ok {
+			msg.Content = text.Text
+		} else if m.Content != nil {
+			if data, err := m.Content.MarshalJSON(); err == nil {
+				msg.Content = string(data)
+			}
+		}
+		result = append(result, msg)
+	}
+	return result
+}
+
+// contentText joins the text of tool result content
+func contentText(content []mcp.Content) string {
+	var text string
+	for _, c := range content {
+		if t, ok := c.(*mcp.TextContent); ok {
+			if text != "" {
+				text += "\n"
+			}
+			text += t.Text
+		}
+	}
+	return text
+}
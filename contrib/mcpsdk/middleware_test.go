@@ -0,0 +1,215 @@
+package mcpsdk
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/qinrichard/langfuse"
+	"github.com/qinrichard/langfuse/langfusetest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+type weatherInput struct {
+	City string `json:"city"`
+}
+
+type weatherOutput struct {
+	Forecast string `json:"forecast"`
+}
+
+// connect starts an instrumented server and client connected in memory. The
+// returned function flushes the Langfuse client and returns the recorder.
+func connect(t *testing.T, server *mcp.Server) (*mcp.ClientSession, *langfuse.Client, func() *langfusetest.Recorder) {
+	lf, recorder := langfusetest.NewClient(t, langfuse.Config{})
+
+	server.AddReceivingMiddleware(ServerMiddleware(lf))
+	client := mcp.NewClient(&mcp.Implementation{Name: "client", Version: "v1"}, nil)
+	client.AddSendingMiddleware(ClientMiddleware(lf))
+
+	clientTransport, serverTransport := mcp.NewInMemoryTransports()
+	ctx := context.Background()
+	serverSession, err := server.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return session, lf, func() *langfusetest.Recorder {
+		session.Close()
+		serverSession.Wait()
+		if err := lf.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return recorder
+	}
+}
+
+func TestCallTool(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "server", Version: "v1"}, nil)
+	var handlerHasSpan bool
+	mcp.AddTool(server, &mcp.Tool{Name: "get_weather"}, func(ctx context.Context, req *mcp.CallToolRequest, in weatherInput) (*mcp.CallToolResult, weatherOutput, error) {
+		handlerHasSpan = langfuse.SpanFromContext(ctx) != nil
+		return nil, weatherOutput{Forecast: "sunny in " + in.City}, nil
+	})
+	session, lf, flush := connect(t, server)
+
+	trace := lf.CreateTrace(context.Background(), "agent")
+	params := &mcp.CallToolParams{
+		Meta:      mcp.Meta{"caller": "test"},
+		Name:      "get_weather",
+		Arguments: map[string]any{"city": "Paris"},
+	}
+	if _, err := session.CallTool(trace.Context(), params); err != nil {
+		t.Fatal(err)
+	}
+	trace.End()
+
+	if _, ok := params.Meta["traceparent"]; ok || params.Meta["caller"] != "test" {
+		t.Errorf("caller's _meta changed to %v", params.Meta)
+	}
+	if !handlerHasSpan {
+		t.Error("tool handler context carries no span")
+	}
+
+	spans := flush().Named("tools/call get_weather")
+	if len(spans) != 2 {
+		t.Fatalf("got %d observations, want one on each side", len(spans))
+	}
+	clientSpan, serverSpan := spans[0], spans[1]
+	if serverSpan.Parent().SpanID() != clientSpan.SpanContext().SpanID() {
+		clientSpan, serverSpan = serverSpan, clientSpan
+	}
+	if serverSpan.Parent().SpanID() != clientSpan.SpanContext().SpanID() {
+		t.Fatal("server observation is not a child of the client observation")
+	}
+	if clientSpan.SpanContext().TraceID().String() != trace.ID() {
+		t.Error("client observation is not part of the caller's trace")
+	}
+
+	for side, span := range map[string]sdktrace.ReadOnlySpan{"client": clientSpan, "server": serverSpan} {
+		got := langfusetest.Attrs(span)
+		want := map[string]string{
+			"langfuse.observation.type":                "tool",
+			"langfuse.observation.metadata.tool_name":  "get_weather",
+			"langfuse.observation.metadata.mcp_method": "tools/call",
+			"langfuse.observation.input":               `{"city":"Paris"}`,
+			"langfuse.observation.output":              `{"forecast":"sunny in Paris"}`,
+		}
+		for key, value := range want {
+			if got[key] != value {
+				t.Errorf("%s: %s = %s, want %s", side, key, got[key], value)
+			}
+		}
+	}
+}
+
+func TestCallToolError(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "server", Version: "v1"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "fail"}, func(ctx context.Context, req *mcp.CallToolRequest, in weatherInput) (*mcp.CallToolResult, weatherOutput, error) {
+		return &mcp.CallToolResult{IsError: true, Content: []mcp.Content{&mcp.TextContent{Text: "no such city"}}}, weatherOutput{}, nil
+	})
+	session, lf, flush := connect(t, server)
+
+	trace := lf.CreateTrace(context.Background(), "agent")
+	result, err := session.CallTool(trace.Context(), &mcp.CallToolParams{Name: "fail", Arguments: map[string]any{"city": "Atlantis"}})
+	if err != nil || !result.IsError {
+		t.Fatalf("got %v, %v", result, err)
+	}
+	trace.End()
+
+	for _, span := range flush().Named("tools/call fail") {
+		got := langfusetest.Attrs(span)
+		if got["langfuse.observation.level"] != string(langfuse.LogLevelError) || got["langfuse.observation.status_message"] != "no such city" {
+			t.Errorf("level %q, status message %q", got["langfuse.observation.level"], got["langfuse.observation.status_message"])
+		}
+	}
+}
+
+func TestGetPrompt(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "server", Version: "v1"}, nil)
+	server.AddPrompt(&mcp.Prompt{Name: "greet"}, func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		return &mcp.GetPromptResult{Messages: []*mcp.PromptMessage{
+			{Role: "user", Content: &mcp.TextContent{Text: "Hello " + req.Params.Arguments["name"]}},
+		}}, nil
+	})
+	session, lf, flush := connect(t, server)
+
+	trace := lf.CreateTrace(context.Background(), "agent")
+	if _, err := session.GetPrompt(trace.Context(), &mcp.GetPromptParams{Name: "greet", Arguments: map[string]string{"name": "Ada"}}); err != nil {
+		t.Fatal(err)
+	}
+	trace.End()
+
+	spans := flush().Named("prompts/get greet")
+	if len(spans) != 2 {
+		t.Fatalf("got %d observations, want one on each side", len(spans))
+	}
+	for _, span := range spans {
+		got := langfusetest.Attrs(span)
+		want := map[string]string{
+			"langfuse.observation.type":   "span",
+			"langfuse.observation.input":  `{"arguments":{"name":"Ada"},"name":"greet"}`,
+			"langfuse.observation.output": `[{"role":"user","content":"Hello Ada"}]`,
+		}
+		for key, value := range want {
+			if got[key] != value {
+				t.Errorf("%s = %s, want %s", key, got[key], value)
+			}
+		}
+	}
+}
+
+func TestWithMeta(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          mcp.Request
+		instrumented bool
+	}{
+		{"session call tool", &mcp.ClientRequest[mcp.Params]{Params: &mcp.CallToolParams{Name: "get_weather"}}, true},
+		{"session read resource", &mcp.ClientRequest[mcp.Params]{Params: &mcp.ReadResourceParams{URI: "file:///a.txt"}}, true},
+		{"session get prompt", &mcp.ClientRequest[mcp.Params]{Params: &mcp.GetPromptParams{Name: "greet"}}, true},
+		{"session list tools", &mcp.ClientRequest[mcp.Params]{Params: &mcp.ListToolsParams{}}, false},
+		{"typed call tool", &mcp.ClientRequest[*mcp.CallToolParams]{Params: &mcp.CallToolParams{Name: "get_weather"}}, true},
+		{"typed nil params", &mcp.ClientRequest[*mcp.GetPromptParams]{}, true},
+		{"typed list tools", &mcp.ClientRequest[*mcp.ListToolsParams]{Params: &mcp.ListToolsParams{}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := tt.req.GetParams()
+			injected, ok := withMeta(tt.req, metaCarrier{"traceparent": "00-1-2-01"})
+			if ok != tt.instrumented {
+				t.Fatalf("instrumented = %v, want %v", ok, tt.instrumented)
+			}
+			if !ok {
+				return
+			}
+			if got := injected.GetParams().GetMeta()["traceparent"]; got != "00-1-2-01" {
+				t.Errorf("traceparent = %v", got)
+			}
+			if params != nil && !reflect.ValueOf(params).IsNil() && params.GetMeta() != nil {
+				t.Errorf("the caller's params were modified: %v", params.GetMeta())
+			}
+		})
+	}
+}
+
+func TestMetaCarrier(t *testing.T) {
+	carrier := metaCarrier{"progressToken": 7}
+	carrier.Set("traceparent", "00-1-2-01")
+
+	if got := carrier.Get("traceparent"); got != "00-1-2-01" {
+		t.Errorf("Get(traceparent) = %q", got)
+	}
+	if got := carrier.Get("progressToken"); got != "" {
+		t.Errorf("Get(progressToken) = %q, want empty for non-string values", got)
+	}
+	if keys := carrier.Keys(); !reflect.DeepEqual(keys, []string{"traceparent"}) {
+		t.Errorf("Keys() = %v", keys)
+	}
+}
@@ -0,0 +1,56 @@
+// Package openaigo instruments the official github.com/openai/openai-go
+// client with Langfuse through its request middleware.
+//
+//	client := openai.NewClient(openaigo.WithLangfuse(lf))
+//
+// Chat completions, completions, embeddings and Responses API calls are
+// recorded as generations under the observation carried by the request
+// context, including streamed responses. Each retry attempt is recorded as its
+// own generation.
+//
+// Chat completion and Responses API parameters are decoded into the SDK's
+// typed params and recorded as model parameters. Costs are recorded for the
+// models given to WithPrices.
+package openaigo
+
+import (
+	"github.com/openai/openai-go/v3/option"
+	"github.com/qinrichard/langfuse"
+)
+
+// config holds the middleware settings
+type config struct {
+	prices langfuse.PriceTable
+}
+
+// Option configures the middleware
+type Option func(*config)
+
+// WithPrices records the cost of calls to the models in prices
+func WithPrices(prices langfuse.PriceTable) Option {
+	return func(c *config) {
+		c.prices = prices
+	}
+}
+
+// Middleware returns openai-go middleware that records calls with client
+func Middleware(client *langfuse.Client, opts ...Option) option.Middleware {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	rtOpts := []langfuse.RoundTripperOption{
+		langfuse.WithProviders(langfuse.ProviderOpenAI),
+		langfuse.WithParams(requestParams),
+	}
+	if len(cfg.prices) > 0 {
+		rtOpts = append(rtOpts, langfuse.WithCost(cfg.prices.Cost))
+	}
+	return langfuse.NewRoundTripper(client, nil, rtOpts...).Middleware
+}
+
+// WithLangfuse returns a request option that installs Middleware
+func WithLangfuse(client *langfuse.Client, opts ...Option) option.RequestOption {
+	return option.WithMiddleware(Middleware(client, opts...))
+}
@@ -0,0 +1,120 @@
+package openaigo
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+	"github.com/openai/openai-go/v3/responses"
+	"github.com/qinrichard/langfuse"
+	"github.com/qinrichard/langfuse/langfusetest"
+)
+
+func TestMiddleware(t *testing.T) {
+	var attempts atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.Header().Set("Retry-After-Ms", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"c1","object":"chat.completion","model":"gpt-4o-2024-08-06",
+			"choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],
+			"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15,"prompt_tokens_details":{"cached_tokens":8}}}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	lf, recorder := langfusetest.NewClient(t, langfuse.Config{})
+	client := openai.NewClient(
+		option.WithAPIKey("sk-test"),
+		option.WithBaseURL(server.URL+"/v1/"),
+		option.WithUnsafeAllowHTTP(),
+		option.WithMaxRetries(1),
+		WithLangfuse(lf, WithPrices(langfuse.PriceTable{"gpt-4o": {Input: 2.5, CacheRead: 1.25, Output: 10}, "gpt-4": {Input: 30, Output: 60}})),
+	)
+
+	trace := lf.CreateTrace(context.Background(), "test")
+	completion, err := client.Chat.Completions.New(trace.Context(), openai.ChatCompletionNewParams{
+		Model:       openai.ChatModelGPT4o,
+		Messages:    []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi")},
+		Temperature: openai.Float(0.2),
+		Stop:        openai.ChatCompletionNewParamsStopUnion{OfString: openai.String("END")},
+		LogitBias:   map[string]int64{"50256": -100},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completion.Choices[0].Message.Content != "hello" {
+		t.Errorf("caller got %q", completion.Choices[0].Message.Content)
+	}
+	trace.End()
+	if err := lf.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	generations := recorder.Named("OpenAI-chat-completion")
+	if len(generations) != 2 {
+		t.Fatalf("got %d generations, want one per attempt", len(generations))
+	}
+	var failed, succeeded map[string]string
+	for _, span := range generations {
+		g := langfusetest.Attrs(span)
+		if g["langfuse.observation.level"] == string(langfuse.LogLevelError) {
+			failed = g
+		} else {
+			succeeded = g
+		}
+	}
+	if failed == nil || succeeded == nil {
+		t.Fatalf("want a failed and a successful attempt, got %v", generations)
+	}
+	want := map[string]string{
+		"langfuse.observation.model.name":       "gpt-4o-2024-08-06",
+		"langfuse.observation.input":            `{"messages":[{"role":"user","content":"hi"}]}`,
+		"langfuse.observation.output":           `{"role":"assistant","content":"hello"}`,
+		"langfuse.observation.usage_details":    `{"input":2,"input_cached_tokens":8,"output":5,"total":15}`,
+		"langfuse.observation.model.parameters": `{"logit_bias":{"50256":-100},"stop":["END"],"temperature":0.2}`,
+	}
+	for key, value := range want {
+		if succeeded[key] != value {
+			t.Errorf("%s = %s, want %s", key, succeeded[key], value)
+		}
+	}
+
+	// 2 uncached input tokens at $2.50, 8 cached at $1.25 and 5 output tokens
+	// at $10 per million
+	var cost langfuse.Cost
+	if err := json.Unmarshal([]byte(succeeded["langfuse.observation.cost_details"]), &cost); err != nil {
+		t.Fatalf("cost details: %v", err)
+	}
+	if math.Abs(cost.Input-15e-6) > 1e-12 || math.Abs(cost.Output-50e-6) > 1e-12 || math.Abs(cost.Total-65e-6) > 1e-12 {
+		t.Errorf("cost = %+v, want gpt-4o prices applied", cost)
+	}
+}
+
+func TestResponseParams(t *testing.T) {
+	var p responses.ResponseNewParams
+	body := `{"model":"gpt-5","input":"hi","max_output_tokens":100,"reasoning":{"effort":"low"},` +
+		`"text":{"format":{"type":"json_object"},"verbosity":"high"},"truncation":"auto"}`
+	if err := p.UnmarshalJSON([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(responseParams(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"max_tokens":100,"reasoning_effort":"low","response_format":{"type":"json_object"},"truncation":"auto","verbosity":"high"}`
+	if string(data) != want {
+		t.Errorf("params = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,145 @@
+package openaigo
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/packages/param"
+	"github.com/openai/openai-go/v3/responses"
+	"github.com/qinrichard/langfuse"
+)
+
+// requestParams decodes chat completion and Responses API requests into the
+// SDK's typed parameters and maps them to Langfuse generation parameters.
+// Other endpoints keep the parameters parsed by the core RoundTripper.
+func requestParams(req *http.Request, body []byte) (langfuse.GenerationParams, bool) {
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/chat/completions"):
+		var params openai.ChatCompletionNewParams
+		if err := params.UnmarshalJSON(body); err != nil {
+			return langfuse.GenerationParams{}, false
+		}
+		return chatCompletionParams(params), true
+	case strings.HasSuffix(req.URL.Path, "/responses"):
+		var params responses.ResponseNewParams
+		if err := params.UnmarshalJSON(body); err != nil {
+			return langfuse.GenerationParams{}, false
+		}
+		return responseParams(params), true
+	}
+	return langfuse.GenerationParams{}, false
+}
+
+// chatCompletionParams maps the parameters of a chat completion request
+func chatCompletionParams(p openai.ChatCompletionNewParams) langfuse.GenerationParams {
+	params := langfuse.GenerationParams{
+		Temperature:         optFloat(p.Temperature),
+		MaxTokens:           optInt(p.MaxTokens),
+		MaxCompletionTokens: optInt(p.MaxCompletionTokens),
+		TopP:                optFloat(p.TopP),
+		FrequencyPenalty:    optFloat(p.FrequencyPenalty),
+		PresencePenalty:     optFloat(p.PresencePenalty),
+		Seed:                optInt(p.Seed),
+		N:                   optInt(p.N),
+		ParallelToolCalls:   optBool(p.ParallelToolCalls),
+		ReasoningEffort:     string(p.ReasoningEffort),
+	}
+	if p.Stop.OfString.Valid() {
+		params.Stop = []string{p.Stop.OfString.Value}
+	} else {
+		params.Stop = p.Stop.OfStringArray
+	}
+	if !param.IsOmitted(p.ResponseFormat) {
+		params.ResponseFormat = p.ResponseFormat
+	}
+	if !param.IsOmitted(p.ToolChoice) {
+		params.ToolChoice = p.ToolChoice
+	}
+
+	other := map[string]interface{}{}
+	if len(p.LogitBias) > 0 {
+		other["logit_bias"] = p.LogitBias
+	}
+	if p.Logprobs.Valid() {
+		other["logprobs"] = p.Logprobs.Value
+	}
+	if p.TopLogprobs.Valid() {
+		other["top_logprobs"] = p.TopLogprobs.Value
+	}
+	if p.ServiceTier != "" {
+		other["service_tier"] = p.ServiceTier
+	}
+	if p.Verbosity != "" {
+		other["verbosity"] = p.Verbosity
+	}
+	if len(p.Modalities) > 0 {
+		other["modalities"] = p.Modalities
+	}
+	if len(other) > 0 {
+		params.Other = other
+	}
+	return params
+}
+
+// responseParams maps the parameters of a Responses API request. The
+// output token limit is recorded as max_tokens and the text format as
+// response_format.
+func responseParams(p responses.ResponseNewParams) langfuse.GenerationParams {
+	params := langfuse.GenerationParams{
+		Temperature:       optFloat(p.Temperature),
+		MaxTokens:         optInt(p.MaxOutputTokens),
+		TopP:              optFloat(p.TopP),
+		ParallelToolCalls: optBool(p.ParallelToolCalls),
+		ReasoningEffort:   string(p.Reasoning.Effort),
+	}
+	if !param.IsOmitted(p.Text.Format) {
+		params.ResponseFormat = p.Text.Format
+	}
+	if !param.IsOmitted(p.ToolChoice) {
+		params.ToolChoice = p.ToolChoice
+	}
+
+	other := map[string]interface{}{}
+	if p.MaxToolCalls.Valid() {
+		other["max_tool_calls"] = p.MaxToolCalls.Value
+	}
+	if p.TopLogprobs.Valid() {
+		other["top_logprobs"] = p.TopLogprobs.Value
+	}
+	if p.ServiceTier != "" {
+		other["service_tier"] = p.ServiceTier
+	}
+	if p.Truncation != "" {
+		other["truncation"] = p.Truncation
+	}
+	if p.Text.Verbosity != "" {
+		other["verbosity"] = p.Text.Verbosity
+	}
+	if len(other) > 0 {
+		params.Other = other
+	}
+	return params
+}
+
+func optFloat(o param.Opt[float64]) *float64 {
+	if !o.Valid() {
+		return nil
+	}
+	return &o.Value
+}
+
+func optInt(o param.Opt[int64]) *int {
+	if !o.Valid() {
+		return nil
+	}
+	v := int(o.Value)
+	return &v
+}
+
+func optBool(o param.Opt[bool]) *bool {
+	if !o.Valid() {
+		return nil
+	}
+	return &o.Value
+}
@@ -0,0 +1,70 @@
+package langfuse
+
+import "strings"
+
+// ModelPrice is the price of a model in US dollars per million tokens. Cache
+// reads and writes are charged at Input unless CacheRead or CacheWrite is set.
+type ModelPrice struct {
+	Input      float64
+	CacheRead  float64
+	CacheWrite float64
+	Output     float64
+}
+
+// PriceTable maps model names to prices. A model is priced by its exact name
+// or else by the longest name it starts with, so "gpt-4o" also prices
+// "gpt-4o-2024-08-06". Its Cost method is a CostFunc:
+//
+//	rt := langfuse.NewRoundTripper(client, nil, langfuse.WithCost(prices.Cost))
+type PriceTable map[string]ModelPrice
+
+// Cost computes the cost of a call from the usage details recorded by the
+// RoundTripper. Cached input is reported as input_cached_tokens (OpenAI,
+// Gemini) or cache_read_input_tokens and cache_creation_input_tokens
+// (Anthropic) and is not part of input. Other input_ and output_ breakdowns,
+// e.g. audio or reasoning tokens, are charged at Input and Output.
+func (t PriceTable) Cost(model string, usage map[string]int) (Cost, bool) {
+	price, ok := t.lookup(model)
+	if !ok {
+		return Cost{}, false
+	}
+	cacheRead, cacheWrite := price.CacheRead, price.CacheWrite
+	if cacheRead == 0 {
+		cacheRead = price.Input
+	}
+	if cacheWrite == 0 {
+		cacheWrite = price.Input
+	}
+
+	var cost Cost
+	for key, count := range usage {
+		tokens := float64(count) / 1e6
+		switch {
+		case key == "input_cached_tokens" || key == "cache_read_input_tokens":
+			cost.Input += tokens * cacheRead
+		case key == "cache_creation_input_tokens":
+			cost.Input += tokens * cacheWrite
+		case key == "input" || strings.HasPrefix(key, "input_"):
+			cost.Input += tokens * price.Input
+		case key == "output" || strings.HasPrefix(key, "output_"):
+			cost.Output += tokens * price.Output
+		}
+	}
+	cost.Total = cost.Input + cost.Output
+	return cost, true
+}
+
+// lookup finds the price of model by exact name or longest prefix
+func (t PriceTable) lookup(model string) (ModelPrice, bool) {
+	if price, ok := t[model]; ok {
+		return price, true
+	}
+	var found ModelPrice
+	longest := 0
+	for name, price := range t {
+		if len(name) > longest && strings.HasPrefix(model, name) {
+			found, longest = price, len(name)
+		}
+	}
+	return found, longest > 0
+}
@@ -0,0 +1,55 @@
+package langfuse
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPriceTableCost(t *testing.T) {
+	prices := PriceTable{
+		"gpt-4o":            {Input: 2.5, CacheRead: 1.25, Output: 10},
+		"gpt-4o-mini":       {Input: 0.15, Output: 0.6},
+		"claude-sonnet-4-5": {Input: 3, CacheRead: 0.3, CacheWrite: 3.75, Output: 15},
+	}
+	tests := []struct {
+		name  string
+		model string
+		usage map[string]int
+		want  Cost
+	}{
+		{
+			name:  "cached tokens are not in input",
+			model: "gpt-4o-2024-08-06",
+			usage: NewUsageDetails(1000, 100, 0, map[string]int{"input_cached_tokens": 800, "output_reasoning_tokens": 40}),
+			want:  Cost{Input: (200*2.5 + 800*1.25) / 1e6, Output: 100 * 10 / 1e6},
+		},
+		{
+			name:  "longest prefix",
+			model: "gpt-4o-mini-2024-07-18",
+			usage: NewUsageDetails(1000, 0, 0, nil),
+			want:  Cost{Input: 1000 * 0.15 / 1e6},
+		},
+		{
+			name:  "anthropic cache reads and writes",
+			model: "claude-sonnet-4-5-20250929",
+			usage: map[string]int{"input": 10, "output": 5, "cache_read_input_tokens": 100, "cache_creation_input_tokens": 20, "total": 135},
+			want:  Cost{Input: (10*3 + 100*0.3 + 20*3.75) / 1e6, Output: 5 * 15 / 1e6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := prices.Cost(tt.model, tt.usage)
+			if !ok {
+				t.Fatal("model not priced")
+			}
+			tt.want.Total = tt.want.Input + tt.want.Output
+			if math.Abs(got.Input-tt.want.Input) > 1e-12 || math.Abs(got.Output-tt.want.Output) > 1e-12 || math.Abs(got.Total-tt.want.Total) > 1e-12 {
+				t.Errorf("cost = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := prices.Cost("o3", map[string]int{"input": 1}); ok {
+		t.Error("unlisted model priced")
+	}
+}
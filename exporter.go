@@ -0,0 +1,140 @@
+package langfuse
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+)
+
+// RetryConfig configures how failed exports are retried with exponential
+// backoff. Zero durations use the OpenTelemetry defaults of 5 seconds initial
+// interval, 30 seconds maximum interval and 1 minute maximum elapsed time.
+type RetryConfig struct {
+	Disabled        bool          // Do not retry failed exports
+	InitialInterval time.Duration // Wait before the first retry
+	MaxInterval     time.Duration // Upper bound of the wait between retries
+	MaxElapsedTime  time.Duration // Give up on an export after this long
+}
+
+// Exporter defaults of OpenTelemetry, used where only some settings are given
+const (
+	defaultExportTimeout        = 10 * time.Second
+	defaultRetryInitialInterval = 5 * time.Second
+	defaultRetryMaxInterval     = 30 * time.Second
+	defaultRetryMaxElapsedTime  = time.Minute
+)
+
+// validateExport checks the exporter settings of the configuration
+func (c Config) validateExport() error {
+	if c.ExportTimeout < 0 {
+		return fmt.Errorf("export timeout must not be negative")
+	}
+	if r := c.Retry; r != nil {
+		if r.InitialInterval < 0 || r.MaxInterval < 0 || r.MaxElapsedTime < 0 {
+			return fmt.Errorf("retry intervals must not be negative")
+		}
+		if r.InitialInterval > 0 && r.MaxInterval > 0 && r.MaxInterval < r.InitialInterval {
+			return fmt.Errorf("retry max interval %s is less than initial interval %s", r.MaxInterval, r.InitialInterval)
+		}
+	}
+	if c.HTTPClient != nil && c.Transport != nil {
+		return fmt.Errorf("HTTPClient and Transport are mutually exclusive")
+	}
+	if (c.HTTPClient != nil || c.Transport != nil) && (c.TLSConfig != nil || c.Proxy != nil) {
+		return fmt.Errorf("TLSConfig and Proxy cannot be combined with HTTPClient or Transport; configure them on the client or transport instead")
+	}
+	for key := range c.Headers {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("header names must not be empty")
+		}
+		if strings.EqualFold(key, "Authorization") {
+			return fmt.Errorf("the Authorization header cannot be overridden, it is set from the public and secret key")
+		}
+	}
+	return nil
+}
+
+// exportOptions converts the exporter settings of the configuration into
+// OTLP exporter options
+func (c Config) exportOptions() []otlptracehttp.Option {
+	var options []otlptracehttp.Option
+	if c.ExportTimeout > 0 {
+		options = append(options, otlptracehttp.WithTimeout(c.ExportTimeout))
+	}
+	if r := c.Retry; r != nil {
+		retry := otlptracehttp.RetryConfig{
+			Enabled:         !r.Disabled,
+			InitialInterval: r.InitialInterval,
+			MaxInterval:     r.MaxInterval,
+			MaxElapsedTime:  r.MaxElapsedTime,
+		}
+		if retry.InitialInterval == 0 {
+			retry.InitialInterval = defaultRetryInitialInterval
+		}
+		if retry.MaxInterval == 0 {
+			retry.MaxInterval = max(defaultRetryMaxInterval, retry.InitialInterval)
+		}
+		if retry.MaxElapsedTime == 0 {
+			retry.MaxElapsedTime = defaultRetryMaxElapsedTime
+		}
+		options = append(options, otlptracehttp.WithRetry(retry))
+	}
+	if c.Gzip {
+		options = append(options, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	}
+	if c.TLSConfig != nil {
+		options = append(options, otlptracehttp.WithTLSClientConfig(c.TLSConfig))
+	}
+	if c.Proxy != nil {
+		options = append(options, otlptracehttp.WithProxy(c.Proxy))
+	}
+	if client := c.exportHTTPClient(); client != nil {
+		options = append(options, otlptracehttp.WithHTTPClient(client))
+	}
+	return options
+}
+
+// exportHTTPClient returns the HTTP client for exports if one is configured.
+// ExportTimeout overrides the timeout of a custom client.
+func (c Config) exportHTTPClient() *http.Client {
+	timeout := c.ExportTimeout
+	switch {
+	case c.HTTPClient != nil:
+		client := *c.HTTPClient
+		if timeout > 0 {
+			client.Timeout = timeout
+		}
+		return &client
+	case c.Transport != nil:
+		if timeout == 0 {
+			timeout = defaultExportTimeout
+		}
+		return &http.Client{Transport: c.Transport, Timeout: timeout}
+	}
+	return nil
+}
+
+// mediaHTTPClient returns the HTTP client for media uploads, which goes
+// through the same client, transport, TLS configuration and proxy as exports
+func (c Config) mediaHTTPClient() *http.Client {
+	const timeout = defaultMediaUploadTimeout
+	switch {
+	case c.HTTPClient != nil:
+		return c.HTTPClient
+	case c.Transport != nil:
+		return &http.Client{Transport: c.Transport, Timeout: timeout}
+	case c.TLSConfig != nil || c.Proxy != nil:
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if c.TLSConfig != nil {
+			transport.TLSClientConfig = c.TLSConfig
+		}
+		if c.Proxy != nil {
+			transport.Proxy = c.Proxy
+		}
+		return &http.Client{Transport: transport, Timeout: timeout}
+	}
+	return &http.Client{Timeout: timeout}
+}
@@ -0,0 +1,389 @@
+package langfuse
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	collectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// exportRequest is an export request received by a fake Langfuse server
+type exportRequest struct {
+	header http.Header
+	spans  []string
+}
+
+// fakeLangfuse records export requests. Requests are answered by respond,
+// which defaults to 200 OK.
+type fakeLangfuse struct {
+	respond func(w http.ResponseWriter, attempt int)
+
+	mu       sync.Mutex
+	requests []exportRequest
+}
+
+func (f *fakeLangfuse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/public/otel/v1/traces" {
+		http.NotFound(w, r)
+		return
+	}
+	body := io.Reader(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = gz
+	}
+	data, err := io.ReadAll(body)
+	var export collectortracepb.ExportTraceServiceRequest
+	if err != nil || proto.Unmarshal(data, &export) != nil {
+		http.Error(w, "malformed export", http.StatusBadRequest)
+		return
+	}
+
+	req := exportRequest{header: r.Header.Clone()}
+	for _, rs := range export.GetResourceSpans() {
+		for _, ss := range rs.GetScopeSpans() {
+			for _, span := range ss.GetSpans() {
+				req.spans = append(req.spans, span.GetName())
+			}
+		}
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	attempt := len(f.requests)
+	f.mu.Unlock()
+
+	if f.respond != nil {
+		f.respond(w, attempt)
+	}
+}
+
+// received returns the export requests received so far
+func (f *fakeLangfuse) received() []exportRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]exportRequest(nil), f.requests...)
+}
+
+// exportTrace exports a single trace with a client created from config and
+// returns the error of closing the client
+func exportTrace(t *testing.T, config Config) error {
+	t.Helper()
+	config.PublicKey, config.SecretKey = "pk-lf-test", "sk-lf-test"
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	client.CreateTrace(context.Background(), "export").End()
+	return client.Close(context.Background())
+}
+
+func TestExportHeaders(t *testing.T) {
+	fake := &fakeLangfuse{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	err := exportTrace(t, Config{
+		BaseURL: server.URL,
+		Headers: map[string]string{"X-Tenant": "acme", "X-Request-Source": "batch"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := fake.received()
+	if len(requests) != 1 || len(requests[0].spans) != 1 || requests[0].spans[0] != "export" {
+		t.Fatalf("got requests %+v, want one with the trace", requests)
+	}
+	header := requests[0].header
+	want := map[string]string{
+		"Authorization":    "Basic " + encodeBasicAuth("pk-lf-test", "sk-lf-test"),
+		"X-Tenant":         "acme",
+		"X-Request-Source": "batch",
+	}
+	for key, value := range want {
+		if got := header.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if header.Get("Content-Encoding") != "" {
+		t.Errorf("Content-Encoding = %q without Gzip", header.Get("Content-Encoding"))
+	}
+}
+
+func TestExportGzip(t *testing.T) {
+	fake := &fakeLangfuse{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	if err := exportTrace(t, Config{BaseURL: server.URL, Gzip: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := fake.received()
+	if len(requests) != 1 || requests[0].header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("got requests %+v, want one gzip-compressed export", requests)
+	}
+	if len(requests[0].spans) != 1 {
+		t.Errorf("got spans %v from the compressed body", requests[0].spans)
+	}
+}
+
+// renamingExporter renames spans before passing them to the wrapped exporter
+type renamingExporter struct {
+	sdktrace.SpanExporter
+}
+
+func (e renamingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	renamed := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, span := range spans {
+		renamed[i] = renamedSpan{span}
+	}
+	return e.SpanExporter.ExportSpans(ctx, renamed)
+}
+
+type renamedSpan struct {
+	sdktrace.ReadOnlySpan
+}
+
+func (s renamedSpan) Name() string {
+	return "wrapped-" + s.ReadOnlySpan.Name()
+}
+
+func TestExportWrapExporter(t *testing.T) {
+	fake := &fakeLangfuse{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	err := exportTrace(t, Config{
+		BaseURL: server.URL,
+		WrapExporter: func(next sdktrace.SpanExporter) sdktrace.SpanExporter {
+			return renamingExporter{next}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := fake.received()
+	if len(requests) != 1 || len(requests[0].spans) != 1 || requests[0].spans[0] != "wrapped-export" {
+		t.Errorf("got requests %+v, want the span passed through the wrapper", requests)
+	}
+}
+
+func TestExportTLS(t *testing.T) {
+	fake := &fakeLangfuse{}
+	server := httptest.NewTLSServer(fake)
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	tests := []struct {
+		name      string
+		tlsConfig *tls.Config
+		exported  int
+	}{
+		{"untrusted certificate", nil, 0},
+		{"private root CA", &tls.Config{RootCAs: roots}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(fake.received())
+			_ = exportTrace(t, Config{
+				BaseURL:   server.URL,
+				TLSConfig: tt.tlsConfig,
+				Retry:     &RetryConfig{Disabled: true},
+			})
+			if got := len(fake.received()) - before; got != tt.exported {
+				t.Errorf("got %d exports, want %d", got, tt.exported)
+			}
+		})
+	}
+}
+
+func TestExportProxy(t *testing.T) {
+	fake := &fakeLangfuse{}
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A proxied request carries the absolute URL of the target
+		proxied.Store(r.URL.String())
+		fake.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	err := exportTrace(t, Config{
+		BaseURL: "http://langfuse.internal:3000",
+		Proxy:   http.ProxyURL(proxyURL),
+		Retry:   &RetryConfig{Disabled: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := proxied.Load().(string); got != "http://langfuse.internal:3000/api/public/otel/v1/traces" {
+		t.Errorf("proxy received %q", got)
+	}
+	if len(fake.received()) != 1 {
+		t.Errorf("got %d exports through the proxy, want 1", len(fake.received()))
+	}
+}
+
+func TestExportRetry(t *testing.T) {
+	fake := &fakeLangfuse{respond: func(w http.ResponseWriter, attempt int) {
+		if attempt == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		retry    *RetryConfig
+		attempts int
+	}{
+		{"disabled", &RetryConfig{Disabled: true}, 1},
+		{"enabled", &RetryConfig{InitialInterval: time.Millisecond, MaxElapsedTime: 5 * time.Second}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.mu.Lock()
+			fake.requests = nil
+			fake.mu.Unlock()
+
+			_ = exportTrace(t, Config{BaseURL: server.URL, Retry: tt.retry})
+			if got := len(fake.received()); got != tt.attempts {
+				t.Errorf("got %d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestExportTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	start := time.Now()
+	_ = exportTrace(t, Config{
+		BaseURL:       server.URL,
+		ExportTimeout: 50 * time.Millisecond,
+		Retry:         &RetryConfig{Disabled: true},
+	})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("export took %s despite a 50ms timeout", elapsed)
+	}
+}
+
+func TestExportTransport(t *testing.T) {
+	var requests atomic.Int64
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/x-protobuf"}},
+			Body:       io.NopCloser(strings.NewReader("")),
+			Request:    req,
+		}, nil
+	})
+
+	if err := exportTrace(t, Config{BaseURL: "http://langfuse.internal", Transport: transport}); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("got %d requests through the transport, want 1", requests.Load())
+	}
+}
+
+func TestValidateExport(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{name: "defaults", config: Config{}},
+		{name: "all settings", config: Config{
+			ExportTimeout: time.Second,
+			Retry:         &RetryConfig{InitialInterval: time.Second, MaxInterval: time.Minute},
+			Gzip:          true,
+			TLSConfig:     &tls.Config{},
+			Proxy:         http.ProxyFromEnvironment,
+			Headers:       map[string]string{"X-Tenant": "acme"},
+		}},
+		{name: "negative timeout", config: Config{ExportTimeout: -time.Second}, wantErr: "export timeout must not be negative"},
+		{name: "negative retry interval", config: Config{Retry: &RetryConfig{MaxElapsedTime: -time.Second}}, wantErr: "retry intervals must not be negative"},
+		{name: "max below initial interval", config: Config{Retry: &RetryConfig{InitialInterval: time.Minute, MaxInterval: time.Second}}, wantErr: "less than initial interval"},
+		{name: "client and transport", config: Config{HTTPClient: &http.Client{}, Transport: http.DefaultTransport}, wantErr: "mutually exclusive"},
+		{name: "client and TLS", config: Config{HTTPClient: &http.Client{}, TLSConfig: &tls.Config{}}, wantErr: "cannot be combined"},
+		{name: "transport and proxy", config: Config{Transport: http.DefaultTransport, Proxy: http.ProxyFromEnvironment}, wantErr: "cannot be combined"},
+		{name: "empty header name", config: Config{Headers: map[string]string{" ": "x"}}, wantErr: "must not be empty"},
+		{name: "authorization header", config: Config{Headers: map[string]string{"authorization": "Bearer x"}}, wantErr: "cannot be overridden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validateExport()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExportHTTPClient(t *testing.T) {
+	custom := &http.Client{Timeout: time.Minute}
+	tests := []struct {
+		name    string
+		config  Config
+		want    bool
+		timeout time.Duration
+	}{
+		{"default", Config{}, false, 0},
+		{"client", Config{HTTPClient: custom}, true, time.Minute},
+		{"client with export timeout", Config{HTTPClient: custom, ExportTimeout: time.Second}, true, time.Second},
+		{"transport", Config{Transport: http.DefaultTransport}, true, defaultExportTimeout},
+		{"transport with export timeout", Config{Transport: http.DefaultTransport, ExportTimeout: time.Second}, true, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := tt.config.exportHTTPClient()
+			if (client != nil) != tt.want {
+				t.Fatalf("got client %v, want one: %v", client, tt.want)
+			}
+			if client != nil && client.Timeout != tt.timeout {
+				t.Errorf("timeout = %s, want %s", client.Timeout, tt.timeout)
+			}
+		})
+	}
+	if custom.Timeout != time.Minute {
+		t.Error("the configured HTTP client was modified")
+	}
+}
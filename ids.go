@@ -0,0 +1,107 @@
+package langfuse
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// TraceIDFromSeed derives a valid 32 character hex trace ID from an external
+// identifier such as a request ID. The same seed always yields the same ID, so
+// other services can reference the trace without passing IDs around.
+func TraceIDFromSeed(seed string) string {
+	hash := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(hash[:16])
+}
+
+// traceIDOption starts a trace with a given trace ID
+type traceIDOption struct {
+	traceID oteltrace.TraceID
+	err     error
+}
+
+func (o traceIDOption) applyStart(c *startConfig) {
+	if o.err == nil {
+		c.traceID = o.traceID
+	}
+}
+
+func (o traceIDOption) applyTrace(t *Trace) {
+	if o.err != nil {
+		t.span.RecordError(o.err)
+	}
+}
+
+// WithTraceID starts the trace with the given 32 character hex trace ID
+// instead of a random one, e.g. one returned by TraceIDFromSeed. The trace is
+// started as a new root even if ctx carries a span. Invalid IDs are ignored
+// and recorded as an error on the trace.
+func WithTraceID(traceID string) TraceOption {
+	id, err := oteltrace.TraceIDFromHex(traceID)
+	if err != nil {
+		err = fmt.Errorf("invalid trace ID %q: %w", traceID, err)
+	}
+	return traceIDOption{traceID: id, err: err}
+}
+
+// ID returns the trace ID
+func (t *Trace) ID() string {
+	return t.traceID
+}
+
+// ID returns the observation ID of the span
+func (s *Span) ID() string {
+	return s.span.SpanContext().SpanID().String()
+}
+
+// ID returns the observation ID of the generation
+func (g *Generation) ID() string {
+	return g.span.SpanContext().SpanID().String()
+}
+
+// ID returns the observation ID of the event
+func (e *Event) ID() string {
+	return e.span.SpanContext().SpanID().String()
+}
+
+// traceIDContextKey is the context key under which a requested trace ID is
+// passed to the ID generator
+type traceIDContextKey struct{}
+
+// idGenerator generates random span and trace IDs, using the trace ID
+// requested through the context for new root spans
+type idGenerator struct{}
+
+// NewIDs returns a trace ID and span ID for a new root span
+func (idGenerator) NewIDs(ctx context.Context) (oteltrace.TraceID, oteltrace.SpanID) {
+	traceID, _ := ctx.Value(traceIDContextKey{}).(oteltrace.TraceID)
+	for !traceID.IsValid() {
+		traceID = randomTraceID()
+	}
+	return traceID, randomSpanID()
+}
+
+// NewSpanID returns a span ID for a span in an existing trace
+func (idGenerator) NewSpanID(ctx context.Context, traceID oteltrace.TraceID) oteltrace.SpanID {
+	return randomSpanID()
+}
+
+func randomTraceID() oteltrace.TraceID {
+	var id oteltrace.TraceID
+	binary.LittleEndian.PutUint64(id[:8], rand.Uint64())
+	binary.LittleEndian.PutUint64(id[8:], rand.Uint64())
+	return id
+}
+
+func randomSpanID() oteltrace.SpanID {
+	var id oteltrace.SpanID
+	for !id.IsValid() {
+		binary.LittleEndian.PutUint64(id[:], rand.Uint64())
+	}
+	return id
+}
@@ -0,0 +1,81 @@
+package langfuse
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTraceIDFromSeed(t *testing.T) {
+	a, b := TraceIDFromSeed("request-1"), TraceIDFromSeed("request-1")
+	if a != b {
+		t.Errorf("same seed gave %s and %s", a, b)
+	}
+	if a == TraceIDFromSeed("request-2") {
+		t.Error("different seeds gave the same ID")
+	}
+	if len(a) != 32 {
+		t.Errorf("ID %s has length %d, want 32", a, len(a))
+	}
+}
+
+func TestWithTraceID(t *testing.T) {
+	seeded := TraceIDFromSeed("request-1")
+	tests := []struct {
+		name    string
+		traceID string
+		want    string
+		errors  int
+	}{
+		{name: "seeded", traceID: seeded, want: seeded},
+		{name: "explicit", traceID: "0123456789abcdef0123456789abcdef", want: "0123456789abcdef0123456789abcdef"},
+		{name: "invalid", traceID: "not-hex", errors: 1},
+		{name: "all zero", traceID: "00000000000000000000000000000000", errors: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, exporter := newTestClient(t, Config{})
+
+			// a valid trace ID starts a new root even below a parent span
+			parent := client.CreateTrace(context.Background(), "parent")
+			defer parent.End()
+			trace := client.CreateTrace(parent.Context(), tt.name, WithTraceID(tt.traceID))
+			span := trace.CreateSpan("child")
+			span.End()
+			trace.End()
+
+			recorded := findSpan(t, exporter, tt.name)
+			if tt.want != "" && trace.ID() != tt.want {
+				t.Errorf("ID() = %s, want %s", trace.ID(), tt.want)
+			}
+			if got := recorded.SpanContext.TraceID().String(); got != trace.ID() {
+				t.Errorf("exported trace ID %s, ID() %s", got, trace.ID())
+			}
+			if tt.want != "" && recorded.Parent.IsValid() {
+				t.Errorf("trace has parent %s, want a new root", recorded.Parent.SpanID())
+			}
+			if len(recorded.Events) != tt.errors {
+				t.Errorf("got %d recorded errors, want %d", len(recorded.Events), tt.errors)
+			}
+			if got := findSpan(t, exporter, "child").SpanContext.SpanID().String(); got != span.ID() {
+				t.Errorf("span ID() = %s, exported %s", span.ID(), got)
+			}
+		})
+	}
+}
+
+func TestObservationIDs(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	trace := client.CreateTrace(context.Background(), "ids")
+	span := trace.CreateSpan("span")
+	generation := trace.CreateGeneration("generation")
+	event := trace.CreateEvent("event")
+	span.End()
+	generation.End()
+	trace.End()
+
+	for name, id := range map[string]string{"span": span.ID(), "generation": generation.ID(), "event": event.ID()} {
+		if got := findSpan(t, exporter, name).SpanContext.SpanID().String(); got != id {
+			t.Errorf("%s ID() = %s, exported %s", name, id, got)
+		}
+	}
+}
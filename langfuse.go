@@ -3,16 +3,22 @@ package langfuse
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
+	"reflect"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
@@ -30,6 +36,9 @@ type Client struct {
 	release      string
 	environment  string
 	isPublic     bool
+	media        *mediaUploader
+	propagate    bool
+	spool        *spoolClient
 }
 
 // Config holds configuration for Langfuse client
@@ -40,6 +49,36 @@ type Config struct {
 	Release     string // Optional
 	Environment string // Optional
 	IsPublic    bool   // Optional, defaults to false
+
+	// PropagateTraceAttributes copies user ID, session ID, tags, metadata,
+	// release and environment of a trace to every observation created under it
+	PropagateTraceAttributes bool // Optional, defaults to false
+
+	// WrapExporter wraps the span exporter, e.g. to translate spans created
+	// by other OpenTelemetry instrumentation into Langfuse observations
+	WrapExporter func(trace.SpanExporter) trace.SpanExporter // Optional
+
+	// Spool writes spans to disk before they are exported and replays them
+	// if Langfuse cannot be reached, so spans survive outages and restarts.
+	// Every export then costs a disk write, plus an fsync of the segment and
+	// the directory with SpoolSyncAlways; SpoolSyncNever avoids the fsyncs.
+	Spool *SpoolConfig // Optional, defaults to no spool
+
+	// Exporter settings, e.g. for networks behind a proxy with a private CA.
+	// HTTPClient and Transport replace the exporter's HTTP client; TLSConfig
+	// and Proxy apply to the default one. Media uploads use the same settings
+	// and are bounded by ExportTimeout, or 30 seconds if it is not set.
+	ExportTimeout time.Duration                         // Optional, defaults to 10 seconds per export request
+	Retry         *RetryConfig                          // Optional, defaults to OpenTelemetry's retry policy
+	Gzip          bool                                  // Optional, compresses export requests with gzip
+	HTTPClient    *http.Client                          // Optional
+	Transport     http.RoundTripper                     // Optional
+	TLSConfig     *tls.Config                           // Optional, e.g. with a private root CA
+	Proxy         func(*http.Request) (*url.URL, error) // Optional, defaults to http.ProxyFromEnvironment
+	Headers       map[string]string                     // Optional, sent with every export request
+
+	// Batch tunes the export queue and what happens when it is full
+	Batch *BatchConfig // Optional, defaults to OpenTelemetry's batch processor settings
 }
 
 // Usage represents token usage information
@@ -56,15 +95,76 @@ type Cost struct {
 	Output float64 `json:"output,omitempty"`
 }
 
-// GenerationParams represents parameters for LLM generation
+// GenerationParams represents parameters for LLM generation. Provider-specific
+// parameters without a typed field can be passed in Other; they are merged into
+// the emitted parameters and must not repeat a typed field.
 type GenerationParams struct {
-	Temperature      *float64           `json:"temperature,omitempty"`
-	MaxTokens        *int               `json:"max_tokens,omitempty"`
-	TopP             *float64           `json:"top_p,omitempty"`
-	FrequencyPenalty *float64           `json:"frequency_penalty,omitempty"`
-	PresencePenalty  *float64           `json:"presence_penalty,omitempty"`
-	Stop             []string           `json:"stop,omitempty"`
-	Other            map[string]interface{} `json:"-"`
+	Temperature         *float64               `json:"temperature,omitempty"`
+	MaxTokens           *int                   `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int                   `json:"max_completion_tokens,omitempty"`
+	TopP                *float64               `json:"top_p,omitempty"`
+	TopK                *int                   `json:"top_k,omitempty"`
+	FrequencyPenalty    *float64               `json:"frequency_penalty,omitempty"`
+	PresencePenalty     *float64               `json:"presence_penalty,omitempty"`
+	Stop                []string               `json:"stop,omitempty"`
+	Seed                *int                   `json:"seed,omitempty"`
+	N                   *int                   `json:"n,omitempty"`
+	ResponseFormat      interface{}            `json:"response_format,omitempty"`
+	ReasoningEffort     string                 `json:"reasoning_effort,omitempty"`
+	ToolChoice          interface{}            `json:"tool_choice,omitempty"`
+	ParallelToolCalls   *bool                  `json:"parallel_tool_calls,omitempty"`
+	Other               map[string]interface{} `json:"-"`
+}
+
+// generationParamNames holds the JSON names of the typed GenerationParams fields
+var generationParamNames = func() map[string]bool {
+	names := make(map[string]bool)
+	t := reflect.TypeOf(GenerationParams{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}()
+
+// Validate reports whether any key in Other collides with a typed field
+func (p GenerationParams) Validate() error {
+	for key := range p.Other {
+		if generationParamNames[key] {
+			return fmt.Errorf("generation parameter %q in Other collides with a typed field", key)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON serializes the typed parameters merged with Other
+func (p GenerationParams) MarshalJSON() ([]byte, error) {
+	// typedParams drops the MarshalJSON method to avoid recursion
+	type typedParams GenerationParams
+	data, err := json.Marshal(typedParams(p))
+	if err != nil || len(p.Other) == 0 {
+		return data, err
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Merging raw values keeps numbers exact, e.g. 64-bit seeds
+	merged := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range p.Other {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		merged[key] = raw
+	}
+	return json.Marshal(merged)
 }
 
 // ObservationType represents the type of observation
@@ -74,6 +174,13 @@ const (
 	ObservationTypeSpan       ObservationType = "span"
 	ObservationTypeGeneration ObservationType = "generation"
 	ObservationTypeEvent      ObservationType = "event"
+	ObservationTypeAgent      ObservationType = "agent"
+	ObservationTypeTool       ObservationType = "tool"
+	ObservationTypeChain      ObservationType = "chain"
+	ObservationTypeRetriever  ObservationType = "retriever"
+	ObservationTypeEvaluator  ObservationType = "evaluator"
+	ObservationTypeEmbedding  ObservationType = "embedding"
+	ObservationTypeGuardrail  ObservationType = "guardrail"
 )
 
 // LogLevel represents the severity level of an observation
@@ -96,6 +203,22 @@ func NewClient(config Config) (*Client, error) {
 		config.BaseURL = "https://cloud.langfuse.com"
 	}
 
+	if config.Environment != "" {
+		if err := validateEnvironment(config.Environment); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.validateExport(); err != nil {
+		return nil, err
+	}
+
+	if config.Batch != nil {
+		if err := config.Batch.validate(); err != nil {
+			return nil, fmt.Errorf("invalid batch configuration: %w", err)
+		}
+	}
+
 	// Create OTLP exporter with proper URL handling
 	baseURL := config.BaseURL
 	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
@@ -113,22 +236,39 @@ func NewClient(config Config) (*Client, error) {
 	authHeader := fmt.Sprintf("Basic %s", encodeBasicAuth(config.PublicKey, config.SecretKey))
 
 	// Build options slice for cleaner conditional logic
+	headers := map[string]string{
+		"Authorization": authHeader,
+	}
+	for key, value := range config.Headers {
+		headers[key] = value
+	}
 	options := []otlptracehttp.Option{
 		otlptracehttp.WithEndpoint(endpoint),
 		otlptracehttp.WithURLPath("/api/public/otel/v1/traces"),
-		otlptracehttp.WithHeaders(map[string]string{
-			"Authorization": authHeader,
-		}),
+		otlptracehttp.WithHeaders(headers),
 	}
+	options = append(options, config.exportOptions()...)
 
 	// Add scheme-specific options
 	if u.Scheme == "http" {
 		options = append(options, otlptracehttp.WithInsecure())
 	}
 
-	// Create exporter with all options
-	exporter, err := otlptracehttp.New(context.Background(), options...)
+	// Create exporter with all options, spooling batches to disk if configured
+	otlpClient := otlptracehttp.NewClient(options...)
+	var spool *spoolClient
+	if config.Spool != nil {
+		spool, err = newSpoolClient(otlpClient, *config.Spool)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up spool: %w", err)
+		}
+		otlpClient = spool
+	}
+	exporter, err := otlptrace.New(context.Background(), otlpClient)
 	if err != nil {
+		if spool != nil {
+			spool.unlock()
+		}
 		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
 	}
 
@@ -138,14 +278,22 @@ func NewClient(config Config) (*Client, error) {
 		semconv.ServiceName("langfuse-go-sdk"),
 	)
 
+	var spanExporter trace.SpanExporter = exporter
+	if config.WrapExporter != nil {
+		spanExporter = config.WrapExporter(spanExporter)
+	}
+
 	// Create trace provider
 	provider := trace.NewTracerProvider(
-		trace.WithBatcher(exporter),
+		trace.WithSpanProcessor(newBatchProcessor(spanExporter, config.Batch)),
 		trace.WithResource(res),
+		trace.WithIDGenerator(idGenerator{}),
 	)
 
 	otel.SetTracerProvider(provider)
 
+	apiURL := u.Scheme + "://" + u.Host
+
 	client := &Client{
 		tracer:      provider.Tracer("langfuse-go-sdk"),
 		provider:    provider,
@@ -155,13 +303,19 @@ func NewClient(config Config) (*Client, error) {
 		release:     config.Release,
 		environment: config.Environment,
 		isPublic:    config.IsPublic,
+		media:       newMediaUploader(config.mediaHTTPClient(), apiURL, authHeader, config.ExportTimeout),
+		propagate:   config.PropagateTraceAttributes,
+		spool:       spool,
 	}
 
 	return client, nil
 }
 
-// Close gracefully shuts down the client
+// Close gracefully shuts down the client, waiting for pending media uploads
 func (c *Client) Close(ctx context.Context) error {
+	if err := c.media.wait(ctx); err != nil {
+		return fmt.Errorf("failed to finish media uploads: %w", err)
+	}
 	return c.provider.Shutdown(ctx)
 }
 
@@ -171,11 +325,23 @@ type Trace struct {
 	ctx     context.Context
 	span    oteltrace.Span
 	traceID string
+
+	startTime time.Time
+
+	mu         sync.Mutex
+	propagated []attribute.KeyValue
 }
 
 // CreateTrace creates a new trace
 func (c *Client) CreateTrace(ctx context.Context, name string, opts ...TraceOption) *Trace {
-	spanCtx, span := c.tracer.Start(ctx, name)
+	cfg := newStartConfig(opts)
+	startCtx := ctx
+	if cfg.traceID.IsValid() {
+		// The ID generator picks up the requested trace ID for the new root span
+		startCtx = context.WithValue(ctx, traceIDContextKey{}, cfg.traceID)
+	}
+	_, span := c.tracer.Start(startCtx, name, cfg.spanStartOptions()...)
+	spanCtx := oteltrace.ContextWithSpan(ctx, span)
 
 	// Set trace-level attributes
 	attrs := []attribute.KeyValue{}
@@ -186,75 +352,129 @@ func (c *Client) CreateTrace(ctx context.Context, name string, opts ...TraceOpti
 		attrs = append(attrs, attribute.String("langfuse.environment", c.environment))
 	}
 	if c.isPublic {
-		attrs = append(attrs, attribute.Bool("langfuse.trace.public", c.isPublic))
+		span.SetAttributes(attribute.Bool("langfuse.trace.public", c.isPublic))
 	}
 
-	span.SetAttributes(attrs...)
-
 	trace := &Trace{
-		client:  c,
-		ctx:     spanCtx,
-		span:    span,
-		traceID: span.SpanContext().TraceID().String(),
+		client:    c,
+		span:      span,
+		traceID:   span.SpanContext().TraceID().String(),
+		startTime: cfg.startTimeOrNow(),
 	}
+	trace.ctx = contextWithTrace(spanCtx, trace)
+
+	trace.setTraceAttributes(attrs...)
 
 	// Apply options
 	for _, opt := range opts {
-		opt(trace)
+		opt.applyTrace(trace)
 	}
 
 	return trace
 }
 
 // TraceOption defines options for trace creation
-type TraceOption func(*Trace)
+type TraceOption interface {
+	applyTrace(*Trace)
+}
+
+// TraceOptionFunc adapts an ordinary function to a TraceOption, so callers
+// can define their own options
+type TraceOptionFunc func(*Trace)
+
+func (f TraceOptionFunc) applyTrace(t *Trace) {
+	f(t)
+}
 
 // WithTraceUserID sets the user ID for the trace
 func WithTraceUserID(userID string) TraceOption {
-	return func(t *Trace) {
-		t.span.SetAttributes(attribute.String("langfuse.user.id", userID))
-	}
+	return TraceOptionFunc(func(t *Trace) {
+		t.setTraceAttributes(attribute.String("langfuse.user.id", userID))
+	})
 }
 
 // WithTraceSessionID sets the session ID for the trace
 func WithTraceSessionID(sessionID string) TraceOption {
-	return func(t *Trace) {
-		t.span.SetAttributes(attribute.String("langfuse.session.id", sessionID))
-	}
+	return TraceOptionFunc(func(t *Trace) {
+		t.setTraceAttributes(attribute.String("langfuse.session.id", sessionID))
+	})
 }
 
 // WithTraceTags sets tags for the trace
 func WithTraceTags(tags []string) TraceOption {
-	return func(t *Trace) {
+	return TraceOptionFunc(func(t *Trace) {
 		tagsJSON, _ := json.Marshal(tags)
-		t.span.SetAttributes(attribute.String("langfuse.trace.tags", string(tagsJSON)))
-	}
+		t.setTraceAttributes(attribute.String("langfuse.trace.tags", string(tagsJSON)))
+	})
 }
 
 // WithTraceMetadata sets metadata for the trace
 func WithTraceMetadata(metadata map[string]interface{}) TraceOption {
-	return func(t *Trace) {
+	return TraceOptionFunc(func(t *Trace) {
 		for key, value := range metadata {
 			if str, ok := value.(string); ok {
-				t.span.SetAttributes(attribute.String(fmt.Sprintf("langfuse.trace.metadata.%s", key), str))
+				t.setTraceAttributes(attribute.String(fmt.Sprintf("langfuse.trace.metadata.%s", key), str))
 			}
 		}
-	}
+	})
+}
+
+// WithTraceEnvironment overrides the client environment for the trace. Invalid
+// environment names are rejected and recorded as an error on the trace.
+func WithTraceEnvironment(environment string) TraceOption {
+	return TraceOptionFunc(func(t *Trace) {
+		if err := validateEnvironment(environment); err != nil {
+			t.span.RecordError(err)
+			return
+		}
+		t.setTraceAttributes(attribute.String("langfuse.environment", environment))
+	})
+}
+
+// WithTraceRelease overrides the client release for the trace
+func WithTraceRelease(release string) TraceOption {
+	return TraceOptionFunc(func(t *Trace) {
+		t.setTraceAttributes(attribute.String("langfuse.release", release))
+	})
+}
+
+// WithTraceVersion sets the version for the trace
+func WithTraceVersion(version string) TraceOption {
+	return TraceOptionFunc(func(t *Trace) {
+		t.span.SetAttributes(attribute.String("langfuse.version", version))
+	})
+}
+
+// WithTracePublic overrides the client public flag, controlling whether the
+// trace can be shared via link
+func WithTracePublic(public bool) TraceOption {
+	return TraceOptionFunc(func(t *Trace) {
+		t.span.SetAttributes(attribute.Bool("langfuse.trace.public", public))
+	})
 }
 
 // WithTraceInput sets the input for the trace
 func WithTraceInput(input interface{}) TraceOption {
-	return func(t *Trace) {
-		inputJSON, _ := json.Marshal(input)
-		t.span.SetAttributes(attribute.String("langfuse.trace.input", string(inputJSON)))
-	}
+	return TraceOptionFunc(func(t *Trace) {
+		inputJSON := t.client.serializePayload(input, t.traceID, "", "input")
+		t.span.SetAttributes(attribute.String("langfuse.trace.input", inputJSON))
+	})
 }
 
 // WithTraceOutput sets the output for the trace
 func WithTraceOutput(output interface{}) TraceOption {
-	return func(t *Trace) {
-		outputJSON, _ := json.Marshal(output)
-		t.span.SetAttributes(attribute.String("langfuse.trace.output", string(outputJSON)))
+	return TraceOptionFunc(func(t *Trace) {
+		outputJSON := t.client.serializePayload(output, t.traceID, "", "output")
+		t.span.SetAttributes(attribute.String("langfuse.trace.output", outputJSON))
+	})
+}
+
+// Update applies options to the trace after creation, e.g. to set its output.
+// Options that configure how the trace starts, such as WithStartTime, have no
+// effect.
+func (t *Trace) Update(opts ...TraceOption) {
+	for _, opt := range opts {
+		opt.applyTrace(t)
 	}
 }
 
@@ -263,46 +483,121 @@ func (t *Trace) End() {
 	t.span.End()
 }
 
+// EndAt ends the trace at the given time, e.g. when backfilling historical
+// data. It returns an error and leaves the trace open if endTime is before
+// the trace start time.
+func (t *Trace) EndAt(endTime time.Time) error {
+	if err := validateEndTime(t.startTime, endTime); err != nil {
+		return err
+	}
+	t.span.End(oteltrace.WithTimestamp(endTime))
+	return nil
+}
+
+// setTraceAttributes sets trace-level attributes on the root span and records
+// them for propagation to observations created afterwards
+func (t *Trace) setTraceAttributes(attrs ...attribute.KeyValue) {
+	t.span.SetAttributes(attrs...)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, attr := range attrs {
+		replaced := false
+		for i, existing := range t.propagated {
+			if existing.Key == attr.Key {
+				t.propagated[i] = attr
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			t.propagated = append(t.propagated, attr)
+		}
+	}
+}
+
+// propagatedAttributes returns the trace-level attributes to copy onto a new
+// observation, or nil if propagation is disabled
+func (t *Trace) propagatedAttributes() []attribute.KeyValue {
+	if !t.client.propagate {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	attrs := make([]attribute.KeyValue, len(t.propagated))
+	copy(attrs, t.propagated)
+	return attrs
+}
+
+// serializePayload serializes an observation payload, uploading any media it
+// contains on behalf of the given observation span
+func (t *Trace) serializePayload(span oteltrace.Span, value interface{}, field string) string {
+	return t.client.serializePayload(value, t.traceID, span.SpanContext().SpanID().String(), field)
+}
+
 // Span represents a Langfuse span observation
 type Span struct {
-	trace *Trace
-	span  oteltrace.Span
-	ctx   context.Context
+	trace     *Trace
+	span      oteltrace.Span
+	ctx       context.Context
+	startTime time.Time
+
+	// implicitTrace is set when the trace was created for this observation
+	// and ends with it
+	implicitTrace bool
 }
 
 // SpanOption defines options for span creation
-type SpanOption func(*Span)
+type SpanOption interface {
+	applySpan(*Span)
+}
+
+// SpanOptionFunc adapts an ordinary function to a SpanOption, so callers
+// can define their own options
+type SpanOptionFunc func(*Span)
+
+func (f SpanOptionFunc) applySpan(s *Span) {
+	f(s)
+}
 
 // WithSpanMetadata sets metadata for the span
 func WithSpanMetadata(metadata map[string]interface{}) SpanOption {
-	return func(s *Span) {
+	return SpanOptionFunc(func(s *Span) {
 		for key, value := range metadata {
 			if str, ok := value.(string); ok {
 				s.span.SetAttributes(attribute.String(fmt.Sprintf("langfuse.observation.metadata.%s", key), str))
 			}
 		}
-	}
+	})
 }
 
 // WithSpanInput sets the input for the span
 func WithSpanInput(input interface{}) SpanOption {
-	return func(s *Span) {
-		inputJSON, _ := json.Marshal(input)
-		s.span.SetAttributes(attribute.String("langfuse.observation.input", string(inputJSON)))
-	}
+	return SpanOptionFunc(func(s *Span) {
+		inputJSON := s.trace.serializePayload(s.span, input, "input")
+		s.span.SetAttributes(attribute.String("langfuse.observation.input", inputJSON))
+	})
 }
 
 // WithSpanOutput sets the output for the span
 func WithSpanOutput(output interface{}) SpanOption {
-	return func(s *Span) {
-		outputJSON, _ := json.Marshal(output)
-		s.span.SetAttributes(attribute.String("langfuse.observation.output", string(outputJSON)))
-	}
+	return SpanOptionFunc(func(s *Span) {
+		outputJSON := s.trace.serializePayload(s.span, output, "output")
+		s.span.SetAttributes(attribute.String("langfuse.observation.output", outputJSON))
+	})
+}
+
+// WithSpanVersion sets the version for the span
+func WithSpanVersion(version string) SpanOption {
+	return SpanOptionFunc(func(s *Span) {
+		s.span.SetAttributes(attribute.String("langfuse.version", version))
+	})
 }
 
 // WithSpanLevel sets the log level for the span
 func WithSpanLevel(level LogLevel) SpanOption {
-	return func(s *Span) {
+	return SpanOptionFunc(func(s *Span) {
 		s.span.SetAttributes(attribute.String("langfuse.observation.level", string(level)))
 		
 		// Also set OpenTelemetry status based on level
@@ -314,133 +609,341 @@ func WithSpanLevel(level LogLevel) SpanOption {
 		default:
 			s.span.SetStatus(codes.Ok, "")
 		}
-	}
+	})
+}
+
+// WithSpanStatusMessage sets the status message for the span, e.g. the error
+// that made it fail
+func WithSpanStatusMessage(message string) SpanOption {
+	return SpanOptionFunc(func(s *Span) {
+		s.span.SetAttributes(attribute.String("langfuse.observation.status_message", message))
+	})
 }
 
 // CreateSpan creates a new span within the trace
 func (t *Trace) CreateSpan(name string, opts ...SpanOption) *Span {
-	ctx, span := t.client.tracer.Start(t.ctx, name)
+	return t.startSpan(t.ctx, name, ObservationTypeSpan, opts)
+}
+
+// CreateSpan creates a new span nested under the span
+func (s *Span) CreateSpan(name string, opts ...SpanOption) *Span {
+	return s.trace.startSpan(s.ctx, name, ObservationTypeSpan, opts)
+}
+
+// CreateGeneration creates a new generation nested under the span
+func (s *Span) CreateGeneration(name string, opts ...GenerationOption) *Generation {
+	return s.trace.startGeneration(s.ctx, name, ObservationTypeGeneration, opts)
+}
+
+// CreateEvent creates a new event nested under the span
+func (s *Span) CreateEvent(name string, opts ...EventOption) *Event {
+	return s.trace.startEvent(s.ctx, name, opts)
+}
+
+// startSpan starts a span-like observation of the given type under parent
+func (t *Trace) startSpan(parent context.Context, name string, obsType ObservationType, opts []SpanOption) *Span {
+	cfg := newStartConfig(opts)
+	ctx, span := t.client.tracer.Start(parent, name, cfg.spanStartOptions()...)
 	
 	// Set span type
-	span.SetAttributes(attribute.String("langfuse.observation.type", string(ObservationTypeSpan)))
+	span.SetAttributes(attribute.String("langfuse.observation.type", string(obsType)))
+	span.SetAttributes(t.propagatedAttributes()...)
 
 	s := &Span{
-		trace: t,
-		span:  span,
-		ctx:   ctx,
+		trace:     t,
+		span:      span,
+		startTime: cfg.startTimeOrNow(),
 	}
+	s.ctx = context.WithValue(ctx, spanContextKey{}, s)
 
 	// Apply options
 	for _, opt := range opts {
-		opt(s)
+		opt.applySpan(s)
 	}
 
 	return s
 }
 
+// Update applies options to the span after creation, e.g. to set its output.
+// Options that configure how the span starts have no effect.
+func (s *Span) Update(opts ...SpanOption) {
+	for _, opt := range opts {
+		opt.applySpan(s)
+	}
+}
+
 // End ends the span
 func (s *Span) End() {
 	s.span.End()
+	if s.implicitTrace {
+		s.trace.End()
+	}
+}
+
+// EndAt ends the span at the given time, e.g. when backfilling historical
+// data. It returns an error and leaves the span open if endTime is before
+// the span start time, or before the start of a trace created for it.
+func (s *Span) EndAt(endTime time.Time) error {
+	if err := validateEndTime(s.startTime, endTime); err != nil {
+		return err
+	}
+	if s.implicitTrace {
+		if err := validateEndTime(s.trace.startTime, endTime); err != nil {
+			return err
+		}
+	}
+	s.span.End(oteltrace.WithTimestamp(endTime))
+	if s.implicitTrace {
+		return s.trace.EndAt(endTime)
+	}
+	return nil
 }
 
 // Generation represents a Langfuse generation observation
 type Generation struct {
-	trace *Trace
-	span  oteltrace.Span
-	ctx   context.Context
+	trace     *Trace
+	span      oteltrace.Span
+	ctx       context.Context
+	startTime time.Time
+
+	// implicitTrace is set when the trace was created for this observation
+	// and ends with it
+	implicitTrace bool
 }
 
 // GenerationOption defines options for generation creation
-type GenerationOption func(*Generation)
+type GenerationOption interface {
+	applyGeneration(*Generation)
+}
+
+// GenerationOptionFunc adapts an ordinary function to a GenerationOption, so
+// callers can define their own options
+type GenerationOptionFunc func(*Generation)
+
+func (f GenerationOptionFunc) applyGeneration(g *Generation) {
+	f(g)
+}
 
 // WithGenerationModel sets the model for the generation
 func WithGenerationModel(model string) GenerationOption {
-	return func(g *Generation) {
+	return GenerationOptionFunc(func(g *Generation) {
 		g.span.SetAttributes(attribute.String("langfuse.observation.model.name", model))
-	}
+	})
 }
 
 // WithGenerationUsage sets the usage for the generation
 func WithGenerationUsage(usage Usage) GenerationOption {
-	return func(g *Generation) {
+	return GenerationOptionFunc(func(g *Generation) {
 		usageJSON, _ := json.Marshal(usage)
 		g.span.SetAttributes(attribute.String("langfuse.observation.usage_details", string(usageJSON)))
+	})
+}
+
+// WithGenerationUsageDetails sets provider-specific usage details for the
+// generation, e.g. "input", "output", "total" and "input_cached_tokens"
+func WithGenerationUsageDetails(details map[string]int) GenerationOption {
+	return GenerationOptionFunc(func(g *Generation) {
+		detailsJSON, _ := json.Marshal(details)
+		g.span.SetAttributes(attribute.String("langfuse.observation.usage_details", string(detailsJSON)))
+	})
+}
+
+// NewUsageDetails builds usage details for WithGenerationUsageDetails from
+// provider token counts whose breakdown is included in the input and output
+// counts, such as OpenAI's cached and reasoning tokens. Langfuse sums all
+// usage types, so breakdown keys starting with "input_" are subtracted from
+// input and those starting with "output_" from output. Zero breakdown counts
+// are left out, and a zero total is computed from input and output.
+func NewUsageDetails(input, output, total int, breakdown map[string]int) map[string]int {
+	if total <= 0 {
+		total = input + output
 	}
+	details := map[string]int{"total": total}
+	for key, count := range breakdown {
+		if count <= 0 {
+			continue
+		}
+		details[key] = count
+		switch {
+		case strings.HasPrefix(key, "input_"):
+			input -= count
+		case strings.HasPrefix(key, "output_"):
+			output -= count
+		}
+	}
+	details["input"] = max(input, 0)
+	details["output"] = max(output, 0)
+	return details
+}
+
+// WithGenerationMetadata sets metadata for the generation
+func WithGenerationMetadata(metadata map[string]interface{}) GenerationOption {
+	return GenerationOptionFunc(func(g *Generation) {
+		for key, value := range metadata {
+			if str, ok := value.(string); ok {
+				g.span.SetAttributes(attribute.String(fmt.Sprintf("langfuse.observation.metadata.%s", key), str))
+			}
+		}
+	})
 }
 
 // WithGenerationCost sets the cost for the generation
 func WithGenerationCost(cost Cost) GenerationOption {
-	return func(g *Generation) {
+	return GenerationOptionFunc(func(g *Generation) {
 		costJSON, _ := json.Marshal(cost)
 		g.span.SetAttributes(attribute.String("langfuse.observation.cost_details", string(costJSON)))
-	}
+	})
 }
 
-// WithGenerationParams sets the parameters for the generation
+// WithGenerationParams sets the parameters for the generation. Parameters in
+// Other that collide with typed fields are dropped and recorded as an error;
+// the remaining parameters are kept.
 func WithGenerationParams(params GenerationParams) GenerationOption {
-	return func(g *Generation) {
+	return GenerationOptionFunc(func(g *Generation) {
+		if err := params.Validate(); err != nil {
+			// Keep the typed parameters and surface the rejected ones on the span
+			g.span.RecordError(err)
+			other := make(map[string]interface{}, len(params.Other))
+			for key, value := range params.Other {
+				if !generationParamNames[key] {
+					other[key] = value
+				}
+			}
+			params.Other = other
+		}
 		paramsJSON, _ := json.Marshal(params)
 		g.span.SetAttributes(attribute.String("langfuse.observation.model.parameters", string(paramsJSON)))
-	}
+	})
 }
 
 // WithGenerationInput sets the input for the generation
 func WithGenerationInput(input interface{}) GenerationOption {
-	return func(g *Generation) {
-		inputJSON, _ := json.Marshal(input)
-		g.span.SetAttributes(attribute.String("langfuse.observation.input", string(inputJSON)))
-	}
+	return GenerationOptionFunc(func(g *Generation) {
+		inputJSON := g.trace.serializePayload(g.span, input, "input")
+		g.span.SetAttributes(attribute.String("langfuse.observation.input", inputJSON))
+	})
 }
 
 // WithGenerationOutput sets the output for the generation
 func WithGenerationOutput(output interface{}) GenerationOption {
-	return func(g *Generation) {
-		outputJSON, _ := json.Marshal(output)
-		g.span.SetAttributes(attribute.String("langfuse.observation.output", string(outputJSON)))
-	}
+	return GenerationOptionFunc(func(g *Generation) {
+		outputJSON := g.trace.serializePayload(g.span, output, "output")
+		g.span.SetAttributes(attribute.String("langfuse.observation.output", outputJSON))
+	})
 }
 
-// WithGenerationStartTime sets the completion start time for the generation
+// WithGenerationStartTime sets the completion start time for the generation,
+// i.e. when the first token was received. Use WithStartTime to set when the
+// generation itself started.
 func WithGenerationStartTime(startTime time.Time) GenerationOption {
-	return func(g *Generation) {
-		g.span.SetAttributes(attribute.String("langfuse.observation.completion_start_time", startTime.Format(time.RFC3339)))
-	}
+	return GenerationOptionFunc(func(g *Generation) {
+		g.span.SetAttributes(attribute.String("langfuse.observation.completion_start_time", startTime.Format(time.RFC3339Nano)))
+	})
+}
+
+// WithGenerationLevel sets the log level for the generation
+func WithGenerationLevel(level LogLevel) GenerationOption {
+	return GenerationOptionFunc(func(g *Generation) {
+		g.span.SetAttributes(attribute.String("langfuse.observation.level", string(level)))
+
+		// Also set OpenTelemetry status based on level
+		switch level {
+		case LogLevelError, LogLevelWarning:
+			g.span.SetStatus(codes.Error, "")
+		default:
+			g.span.SetStatus(codes.Ok, "")
+		}
+	})
+}
+
+// WithGenerationStatusMessage sets the status message for the generation,
+// e.g. the error returned by the model provider
+func WithGenerationStatusMessage(message string) GenerationOption {
+	return GenerationOptionFunc(func(g *Generation) {
+		g.span.SetAttributes(attribute.String("langfuse.observation.status_message", message))
+	})
+}
+
+// WithGenerationVersion sets the version for the generation
+func WithGenerationVersion(version string) GenerationOption {
+	return GenerationOptionFunc(func(g *Generation) {
+		g.span.SetAttributes(attribute.String("langfuse.version", version))
+	})
 }
 
 // WithGenerationPrompt sets the prompt name and version for the generation
 func WithGenerationPrompt(name string, version int) GenerationOption {
-	return func(g *Generation) {
+	return GenerationOptionFunc(func(g *Generation) {
 		g.span.SetAttributes(
 			attribute.String("langfuse.observation.prompt.name", name),
 			attribute.Int("langfuse.observation.prompt.version", version),
 		)
-	}
+	})
 }
 
 // CreateGeneration creates a new generation within the trace
 func (t *Trace) CreateGeneration(name string, opts ...GenerationOption) *Generation {
-	ctx, span := t.client.tracer.Start(t.ctx, name)
+	return t.startGeneration(t.ctx, name, ObservationTypeGeneration, opts)
+}
+
+// startGeneration starts a generation-like observation of the given type under parent
+func (t *Trace) startGeneration(parent context.Context, name string, obsType ObservationType, opts []GenerationOption) *Generation {
+	cfg := newStartConfig(opts)
+	ctx, span := t.client.tracer.Start(parent, name, cfg.spanStartOptions()...)
 	
 	// Set generation type
-	span.SetAttributes(attribute.String("langfuse.observation.type", string(ObservationTypeGeneration)))
+	span.SetAttributes(attribute.String("langfuse.observation.type", string(obsType)))
+	span.SetAttributes(t.propagatedAttributes()...)
 
 	g := &Generation{
-		trace: t,
-		span:  span,
-		ctx:   ctx,
+		trace:     t,
+		span:      span,
+		ctx:       ctx,
+		startTime: cfg.startTimeOrNow(),
 	}
 
 	// Apply options
 	for _, opt := range opts {
-		opt(g)
+		opt.applyGeneration(g)
 	}
 
 	return g
 }
 
+// Update applies options to the generation after creation, e.g. to set its
+// output and usage once the model responded. Options that configure how the
+// generation starts have no effect.
+func (g *Generation) Update(opts ...GenerationOption) {
+	for _, opt := range opts {
+		opt.applyGeneration(g)
+	}
+}
+
 // End ends the generation
 func (g *Generation) End() {
 	g.span.End()
+	if g.implicitTrace {
+		g.trace.End()
+	}
+}
+
+// EndAt ends the generation at the given time, e.g. when backfilling historical
+// data. It returns an error and leaves the generation open if endTime is before
+// the generation start time, or before the start of a trace created for it.
+func (g *Generation) EndAt(endTime time.Time) error {
+	if err := validateEndTime(g.startTime, endTime); err != nil {
+		return err
+	}
+	if g.implicitTrace {
+		if err := validateEndTime(g.trace.startTime, endTime); err != nil {
+			return err
+		}
+	}
+	g.span.End(oteltrace.WithTimestamp(endTime))
+	if g.implicitTrace {
+		return g.trace.EndAt(endTime)
+	}
+	return nil
 }
 
 // Event represents a Langfuse event observation
@@ -450,30 +953,55 @@ type Event struct {
 }
 
 // EventOption defines options for event creation
-type EventOption func(*Event)
+type EventOption interface {
+	applyEvent(*Event)
+}
+
+// EventOptionFunc adapts an ordinary function to an EventOption, so callers
+// can define their own options
+type EventOptionFunc func(*Event)
+
+func (f EventOptionFunc) applyEvent(e *Event) {
+	f(e)
+}
 
 // WithEventMetadata sets metadata for the event
 func WithEventMetadata(metadata map[string]interface{}) EventOption {
-	return func(e *Event) {
+	return EventOptionFunc(func(e *Event) {
 		for key, value := range metadata {
 			if str, ok := value.(string); ok {
 				e.span.SetAttributes(attribute.String(fmt.Sprintf("langfuse.observation.metadata.%s", key), str))
 			}
 		}
-	}
+	})
 }
 
 // WithEventInput sets the input for the event
 func WithEventInput(input interface{}) EventOption {
-	return func(e *Event) {
-		inputJSON, _ := json.Marshal(input)
-		e.span.SetAttributes(attribute.String("langfuse.observation.input", string(inputJSON)))
-	}
+	return EventOptionFunc(func(e *Event) {
+		inputJSON := e.trace.serializePayload(e.span, input, "input")
+		e.span.SetAttributes(attribute.String("langfuse.observation.input", inputJSON))
+	})
+}
+
+// WithEventOutput sets the output for the event
+func WithEventOutput(output interface{}) EventOption {
+	return EventOptionFunc(func(e *Event) {
+		outputJSON := e.trace.serializePayload(e.span, output, "output")
+		e.span.SetAttributes(attribute.String("langfuse.observation.output", outputJSON))
+	})
+}
+
+// WithEventVersion sets the version for the event
+func WithEventVersion(version string) EventOption {
+	return EventOptionFunc(func(e *Event) {
+		e.span.SetAttributes(attribute.String("langfuse.version", version))
+	})
 }
 
 // WithEventLevel sets the log level for the event
 func WithEventLevel(level LogLevel) EventOption {
-	return func(e *Event) {
+	return EventOptionFunc(func(e *Event) {
 		e.span.SetAttributes(attribute.String("langfuse.observation.level", string(level)))
 		
 		// Also set OpenTelemetry status based on level
@@ -485,15 +1013,22 @@ func WithEventLevel(level LogLevel) EventOption {
 		default:
 			e.span.SetStatus(codes.Ok, "")
 		}
-	}
+	})
 }
 
 // CreateEvent creates a new event within the trace
 func (t *Trace) CreateEvent(name string, opts ...EventOption) *Event {
-	_, span := t.client.tracer.Start(t.ctx, name)
+	return t.startEvent(t.ctx, name, opts)
+}
+
+// startEvent records an event under parent
+func (t *Trace) startEvent(parent context.Context, name string, opts []EventOption) *Event {
+	cfg := newStartConfig(opts)
+	_, span := t.client.tracer.Start(parent, name, cfg.spanStartOptions()...)
 	
 	// Set event type and immediately end it (events are instantaneous)
 	span.SetAttributes(attribute.String("langfuse.observation.type", string(ObservationTypeEvent)))
+	span.SetAttributes(t.propagatedAttributes()...)
 
 	e := &Event{
 		trace: t,
@@ -502,15 +1037,116 @@ func (t *Trace) CreateEvent(name string, opts ...EventOption) *Event {
 
 	// Apply options
 	for _, opt := range opts {
-		opt(e)
+		opt.applyEvent(e)
 	}
 
 	// Events are instantaneous, so we end them immediately
-	span.End()
+	span.End(oteltrace.WithTimestamp(cfg.startTimeOrNow()))
 
 	return e
 }
 
+// environmentPattern matches environment names accepted by Langfuse
+var environmentPattern = regexp.MustCompile(`^[a-z0-9_-]{1,40}$`)
+
+// validateEnvironment checks an environment name against Langfuse's naming
+// rules: lowercase letters, digits, hyphens and underscores, at most 40
+// characters, and no "langfuse" prefix
+func validateEnvironment(environment string) error {
+	if !environmentPattern.MatchString(environment) {
+		return fmt.Errorf("invalid environment %q: must be 1-40 lowercase letters, digits, hyphens or underscores", environment)
+	}
+	if strings.HasPrefix(environment, "langfuse") {
+		return fmt.Errorf("invalid environment %q: the \"langfuse\" prefix is reserved", environment)
+	}
+	return nil
+}
+
+// startConfig holds settings that must be known before an observation's span
+// is started
+type startConfig struct {
+	startTime time.Time
+	traceID   oteltrace.TraceID
+	links     []oteltrace.Link
+
+	// linkedTraces holds the IDs of linked traces without an observation
+	linkedTraces []string
+}
+
+// startOption is implemented by options that configure how a span is started
+type startOption interface {
+	applyStart(*startConfig)
+}
+
+// newStartConfig collects the start settings from a list of options
+func newStartConfig[O any](opts []O) startConfig {
+	var cfg startConfig
+	for _, opt := range opts {
+		if so, ok := any(opt).(startOption); ok {
+			so.applyStart(&cfg)
+		}
+	}
+	return cfg
+}
+
+// spanStartOptions converts the start settings to OpenTelemetry span options
+func (c startConfig) spanStartOptions() []oteltrace.SpanStartOption {
+	var opts []oteltrace.SpanStartOption
+	if !c.startTime.IsZero() {
+		opts = append(opts, oteltrace.WithTimestamp(c.startTime))
+	}
+	if c.traceID.IsValid() {
+		opts = append(opts, oteltrace.WithNewRoot())
+	}
+	if len(c.links) > 0 {
+		opts = append(opts, oteltrace.WithLinks(c.links...))
+	}
+	if len(c.linkedTraces) > 0 {
+		opts = append(opts, oteltrace.WithAttributes(attribute.StringSlice("langfuse.link.trace_ids", c.linkedTraces)))
+	}
+	return opts
+}
+
+// startTimeOrNow returns the configured start time, defaulting to now
+func (c startConfig) startTimeOrNow() time.Time {
+	if c.startTime.IsZero() {
+		return time.Now()
+	}
+	return c.startTime
+}
+
+// ObservationOption is an option accepted by traces and every observation type
+type ObservationOption interface {
+	TraceOption
+	SpanOption
+	GenerationOption
+	EventOption
+}
+
+// startTimeOption sets the start time of a trace or observation
+type startTimeOption time.Time
+
+func (o startTimeOption) applyStart(c *startConfig) { c.startTime = time.Time(o) }
+func (startTimeOption) applyTrace(*Trace)           {}
+func (startTimeOption) applySpan(*Span)             {}
+func (startTimeOption) applyGeneration(*Generation) {}
+func (startTimeOption) applyEvent(*Event)           {}
+
+// WithStartTime sets the start time of a trace or observation instead of now,
+// e.g. when backfilling historical data. For events it sets the event time.
+func WithStartTime(startTime time.Time) ObservationOption {
+	return startTimeOption(startTime)
+}
+
+// validateEndTime checks that an explicit end time does not precede the start time
+func validateEndTime(startTime, endTime time.Time) error {
+	if endTime.Before(startTime) {
+		return fmt.Errorf("end time %s is before start time %s",
+			endTime.Format(time.RFC3339Nano), startTime.Format(time.RFC3339Nano))
+	}
+	return nil
+}
+
 // encodeBasicAuth encodes basic auth credentials
 func encodeBasicAuth(username, password string) string {
 	auth := username + ":" + password
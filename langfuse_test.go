@@ -0,0 +1,372 @@
+package langfuse
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTestClient creates a client whose spans are recorded in memory instead
+// of being exported. Media uploads go to config.BaseURL.
+func newTestClient(t *testing.T, config Config) (*Client, *tracetest.InMemoryExporter) {
+	t.Helper()
+	if config.PublicKey == "" {
+		config.PublicKey, config.SecretKey = "pk-lf-test", "sk-lf-test"
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = "http://127.0.0.1:1"
+	}
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if err := client.provider.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutting down exporting provider: %v", err)
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	client.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithIDGenerator(idGenerator{}),
+	)
+	client.tracer = client.provider.Tracer("langfuse-go-sdk")
+	t.Cleanup(func() {
+		_ = client.Close(context.Background())
+	})
+	return client, exporter
+}
+
+// findSpan returns the ended span with the given name
+func findSpan(t *testing.T, exporter *tracetest.InMemoryExporter, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range exporter.GetSpans() {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("span %q not found", name)
+	return tracetest.SpanStub{}
+}
+
+// spanAttrs indexes the attributes of a span by key
+func spanAttrs(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value, len(span.Attributes))
+	for _, attr := range span.Attributes {
+		attrs[attr.Key] = attr.Value
+	}
+	return attrs
+}
+
+// stringAttr returns a string attribute of a span, or "" if it is not set
+func stringAttr(span tracetest.SpanStub, key string) string {
+	return spanAttrs(span)[attribute.Key(key)].AsString()
+}
+
+func TestGenerationParamsJSON(t *testing.T) {
+	temperature, maxTokens, seed := 0.2, 256, 1234567890123456789
+	tests := []struct {
+		name    string
+		params  GenerationParams
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "typed only",
+			params: GenerationParams{Temperature: &temperature, MaxTokens: &maxTokens},
+			want:   `{"temperature":0.2,"max_tokens":256}`,
+		},
+		{
+			name:   "merged with other",
+			params: GenerationParams{Temperature: &temperature, Other: map[string]interface{}{"top_a": 0.5, "safe_prompt": true}},
+			want:   `{"safe_prompt":true,"temperature":0.2,"top_a":0.5}`,
+		},
+		{
+			name:   "large seed with other",
+			params: GenerationParams{Seed: &seed, Other: map[string]interface{}{"top_a": 0.5}},
+			want:   `{"seed":1234567890123456789,"top_a":0.5}`,
+		},
+		{
+			name:    "other repeats a typed field",
+			params:  GenerationParams{Other: map[string]interface{}{"temperature": 1}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.params.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+			data, err := json.Marshal(tt.params)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("got %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithGenerationParamsDropsCollisions(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	temperature := 0.2
+	trace := client.CreateTrace(context.Background(), "params")
+	trace.CreateGeneration("llm", WithGenerationParams(GenerationParams{
+		Temperature: &temperature,
+		Other:       map[string]interface{}{"temperature": 1.0, "top_a": 0.5},
+	})).End()
+
+	span := findSpan(t, exporter, "llm")
+	if got := stringAttr(span, "langfuse.observation.model.parameters"); got != `{"temperature":0.2,"top_a":0.5}` {
+		t.Errorf("parameters = %s", got)
+	}
+	if len(span.Events) != 1 || span.Events[0].Name != "exception" {
+		t.Errorf("events = %+v, want the recorded collision", span.Events)
+	}
+}
+
+func TestValidateEnvironment(t *testing.T) {
+	tests := []struct {
+		environment string
+		valid       bool
+	}{
+		{environment: "production", valid: true},
+		{environment: "staging-eu_1", valid: true},
+		{environment: strings.Repeat("a", 40), valid: true},
+		{environment: ""},
+		{environment: strings.Repeat("a", 41)},
+		{environment: "Production"},
+		{environment: "prod env"},
+		{environment: "langfuse-internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.environment, func(t *testing.T) {
+			if err := validateEnvironment(tt.environment); (err == nil) != tt.valid {
+				t.Errorf("validateEnvironment(%q) = %v, want valid %v", tt.environment, err, tt.valid)
+			}
+		})
+	}
+
+	if _, err := NewClient(Config{PublicKey: "pk", SecretKey: "sk", Environment: "Prod"}); err == nil {
+		t.Error("NewClient accepted an invalid environment")
+	}
+}
+
+func TestTraceOverrides(t *testing.T) {
+	client, exporter := newTestClient(t, Config{Release: "v1", Environment: "production", IsPublic: true})
+
+	tests := []struct {
+		name   string
+		opts   []TraceOption
+		want   map[string]attribute.Value
+		errors int
+	}{
+		{
+			name: "client defaults",
+			want: map[string]attribute.Value{
+				"langfuse.release":      attribute.StringValue("v1"),
+				"langfuse.environment":  attribute.StringValue("production"),
+				"langfuse.trace.public": attribute.BoolValue(true),
+			},
+		},
+		{
+			name: "overrides",
+			opts: []TraceOption{
+				WithTraceRelease("v2"),
+				WithTraceEnvironment("canary"),
+				WithTraceVersion("prompt-7"),
+				WithTracePublic(false),
+			},
+			want: map[string]attribute.Value{
+				"langfuse.release":      attribute.StringValue("v2"),
+				"langfuse.environment":  attribute.StringValue("canary"),
+				"langfuse.version":      attribute.StringValue("prompt-7"),
+				"langfuse.trace.public": attribute.BoolValue(false),
+			},
+		},
+		{
+			name: "invalid environment",
+			opts: []TraceOption{WithTraceEnvironment("Canary")},
+			want: map[string]attribute.Value{
+				"langfuse.environment": attribute.StringValue("production"),
+			},
+			errors: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client.CreateTrace(context.Background(), tt.name, tt.opts...).End()
+			span := findSpan(t, exporter, tt.name)
+			attrs := spanAttrs(span)
+			for key, want := range tt.want {
+				if got := attrs[attribute.Key(key)]; got != want {
+					t.Errorf("%s = %s, want %s", key, got.Emit(), want.Emit())
+				}
+			}
+			if len(span.Events) != tt.errors {
+				t.Errorf("got %d recorded errors, want %d", len(span.Events), tt.errors)
+			}
+		})
+	}
+}
+
+func TestObservationVersions(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	trace := client.CreateTrace(context.Background(), "versions")
+	trace.CreateSpan("span", WithSpanVersion("s1")).End()
+	trace.CreateGeneration("generation", WithGenerationVersion("g1")).End()
+	trace.CreateEvent("event", WithEventVersion("e1"))
+	trace.End()
+
+	for name, want := range map[string]string{"span": "s1", "generation": "g1", "event": "e1"} {
+		if got := stringAttr(findSpan(t, exporter, name), "langfuse.version"); got != want {
+			t.Errorf("%s version = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestBackfillTimestamps(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	trace := client.CreateTrace(context.Background(), "trace", WithStartTime(at(0)))
+	span := trace.CreateSpan("span", WithStartTime(at(1)))
+	generation := span.CreateGeneration("generation", WithStartTime(at(2)), WithGenerationStartTime(at(3)))
+	trace.CreateEvent("event", WithStartTime(at(4)))
+	if err := generation.EndAt(at(5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := span.EndAt(at(6)); err != nil {
+		t.Fatal(err)
+	}
+	if err := trace.EndAt(at(7)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+	}{
+		{name: "trace", start: at(0), end: at(7)},
+		{name: "span", start: at(1), end: at(6)},
+		{name: "generation", start: at(2), end: at(5)},
+		{name: "event", start: at(4), end: at(4)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findSpan(t, exporter, tt.name)
+			if !got.StartTime.Equal(tt.start) || !got.EndTime.Equal(tt.end) {
+				t.Errorf("got %s - %s, want %s - %s", got.StartTime, got.EndTime, tt.start, tt.end)
+			}
+		})
+	}
+
+	completion := stringAttr(findSpan(t, exporter, "generation"), "langfuse.observation.completion_start_time")
+	if completion != at(3).Format(time.RFC3339Nano) {
+		t.Errorf("completion start time = %s", completion)
+	}
+}
+
+func TestEndAtBeforeStart(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	trace := client.CreateTrace(context.Background(), "trace", WithStartTime(start))
+	span := trace.CreateSpan("span", WithStartTime(start))
+	generation := trace.CreateGeneration("generation", WithStartTime(start))
+
+	ends := map[string]func(time.Time) error{
+		"trace":      trace.EndAt,
+		"span":       span.EndAt,
+		"generation": generation.EndAt,
+	}
+	for name, endAt := range ends {
+		if err := endAt(start.Add(-time.Second)); err == nil {
+			t.Errorf("%s accepted an end time before its start", name)
+		}
+	}
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Errorf("%d observations ended despite the error", len(spans))
+	}
+}
+
+func TestOptionFuncAdapters(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	var applied []string
+
+	trace := client.CreateTrace(context.Background(), "trace", TraceOptionFunc(func(t *Trace) {
+		applied = append(applied, "trace")
+	}))
+	trace.CreateSpan("span", SpanOptionFunc(func(s *Span) {
+		applied = append(applied, "span")
+	})).End()
+	trace.CreateGeneration("generation", GenerationOptionFunc(func(g *Generation) {
+		applied = append(applied, "generation")
+	})).End()
+	trace.CreateEvent("event", EventOptionFunc(func(e *Event) {
+		applied = append(applied, "event")
+	}))
+	trace.End()
+
+	if got := strings.Join(applied, ","); got != "trace,span,generation,event" {
+		t.Errorf("applied %s", got)
+	}
+	if spans := exporter.GetSpans(); len(spans) != 4 {
+		t.Errorf("exported %d spans, want 4", len(spans))
+	}
+}
+
+func TestNewUsageDetails(t *testing.T) {
+	tests := []struct {
+		name                 string
+		input, output, total int
+		breakdown            map[string]int
+		want                 map[string]int
+	}{
+		{
+			name:  "no breakdown",
+			input: 10, output: 5,
+			want: map[string]int{"input": 10, "output": 5, "total": 15},
+		},
+		{
+			name:  "cached and reasoning",
+			input: 100, output: 50, total: 150,
+			breakdown: map[string]int{"input_cached_tokens": 40, "output_reasoning_tokens": 20, "output_audio_tokens": 0},
+			want:      map[string]int{"input": 60, "output": 30, "total": 150, "input_cached_tokens": 40, "output_reasoning_tokens": 20},
+		},
+		{
+			name:  "breakdown exceeds count",
+			input: 10, output: 5, total: 15,
+			breakdown: map[string]int{"input_cached_tokens": 12},
+			want:      map[string]int{"input": 0, "output": 5, "total": 15, "input_cached_tokens": 12},
+		},
+		{
+			name:  "other keys",
+			input: 10, output: 5,
+			breakdown: map[string]int{"cache_read": 3},
+			want:      map[string]int{"input": 10, "output": 5, "total": 15, "cache_read": 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewUsageDetails(tt.input, tt.output, tt.total, tt.breakdown)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
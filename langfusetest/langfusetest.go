@@ -0,0 +1,122 @@
+// Package langfusetest provides a Langfuse client for tests that records the
+// spans it exports instead of sending them to Langfuse.
+package langfusetest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/qinrichard/langfuse"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Recorder is a span exporter that records the spans exported by a client
+// before handing them to the exporter it wraps
+type Recorder struct {
+	next trace.SpanExporter
+
+	mu    sync.Mutex
+	spans []trace.ReadOnlySpan
+}
+
+// NewClient creates a client that exports to a fake Langfuse server and
+// records the exported spans. Spans are recorded once they are exported, so
+// close the client before inspecting them. The client is closed and the
+// server stopped when the test ends.
+func NewClient(t testing.TB, config langfuse.Config) (*langfuse.Client, *Recorder) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	if config.PublicKey == "" {
+		config.PublicKey = "pk-lf-test"
+	}
+	if config.SecretKey == "" {
+		config.SecretKey = "sk-lf-test"
+	}
+	config.BaseURL = server.URL
+
+	recorder := &Recorder{}
+	wrap := config.WrapExporter
+	config.WrapExporter = func(next trace.SpanExporter) trace.SpanExporter {
+		if wrap != nil {
+			next = wrap(next)
+		}
+		return recorder.Wrap(next)
+	}
+
+	client, err := langfuse.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close(context.Background()) })
+	return client, recorder
+}
+
+// Wrap makes the recorder export spans to next. It can be used as
+// Config.WrapExporter.
+func (r *Recorder) Wrap(next trace.SpanExporter) trace.SpanExporter {
+	r.next = next
+	return r
+}
+
+// ExportSpans records spans and exports them to the wrapped exporter
+func (r *Recorder) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	r.mu.Lock()
+	r.spans = append(r.spans, spans...)
+	r.mu.Unlock()
+	if r.next == nil {
+		return nil
+	}
+	return r.next.ExportSpans(ctx, spans)
+}
+
+// Shutdown shuts down the wrapped exporter
+func (r *Recorder) Shutdown(ctx context.Context) error {
+	if r.next == nil {
+		return nil
+	}
+	return r.next.Shutdown(ctx)
+}
+
+// Spans returns the recorded spans in the order they were exported
+func (r *Recorder) Spans() []trace.ReadOnlySpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]trace.ReadOnlySpan(nil), r.spans...)
+}
+
+// Named returns the recorded spans with the given name
+func (r *Recorder) Named(name string) []trace.ReadOnlySpan {
+	var found []trace.ReadOnlySpan
+	for _, span := range r.Spans() {
+		if span.Name() == name {
+			found = append(found, span)
+		}
+	}
+	return found
+}
+
+// Find returns the first recorded span with the given name, failing the test
+// if there is none
+func (r *Recorder) Find(t testing.TB, name string) trace.ReadOnlySpan {
+	t.Helper()
+	spans := r.Named(name)
+	if len(spans) == 0 {
+		t.Fatalf("span %q not recorded", name)
+	}
+	return spans[0]
+}
+
+// Attrs indexes the attributes of a span by key, formatting their values
+// with attribute.Value.Emit
+func Attrs(span trace.ReadOnlySpan) map[string]string {
+	attrs := make(map[string]string)
+	for _, kv := range span.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	return attrs
+}
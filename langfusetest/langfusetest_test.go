@@ -0,0 +1,35 @@
+package langfusetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/qinrichard/langfuse"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestNewClient(t *testing.T) {
+	var wrapped bool
+	client, recorder := NewClient(t, langfuse.Config{
+		WrapExporter: func(next trace.SpanExporter) trace.SpanExporter {
+			wrapped = true
+			return next
+		},
+	})
+	lfTrace := client.CreateTrace(context.Background(), "request")
+	lfTrace.CreateSpan("step").End()
+	lfTrace.End()
+	if err := client.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !wrapped {
+		t.Error("the configured WrapExporter was not applied")
+	}
+	if got := len(recorder.Spans()); got != 2 {
+		t.Errorf("recorded %d spans, want 2", got)
+	}
+	if got := Attrs(recorder.Find(t, "step"))["langfuse.observation.type"]; got != "span" {
+		t.Errorf("observation type = %q, want span", got)
+	}
+}
@@ -0,0 +1,84 @@
+package langfuse
+
+import (
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Link references a related trace or an observation in it, e.g. the producer
+// of a message processed by a batch consumer or an earlier trace whose output
+// a generation consumes
+type Link struct {
+	TraceID       string // 32 character hex trace ID
+	ObservationID string // 16 character hex observation ID, empty to link the trace
+}
+
+// NewTraceLink returns a link to the root observation of a trace
+func NewTraceLink(t *Trace) Link {
+	return Link{TraceID: t.ID(), ObservationID: t.span.SpanContext().SpanID().String()}
+}
+
+// otelLink converts a link to an observation into an OpenTelemetry link. It
+// reports false if an ID is invalid.
+func (l Link) otelLink() (oteltrace.Link, bool) {
+	traceID, err := oteltrace.TraceIDFromHex(l.TraceID)
+	if err != nil {
+		return oteltrace.Link{}, false
+	}
+	spanID, err := oteltrace.SpanIDFromHex(l.ObservationID)
+	if err != nil {
+		return oteltrace.Link{}, false
+	}
+	return oteltrace.Link{SpanContext: oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: oteltrace.FlagsSampled,
+		Remote:     true,
+	})}, true
+}
+
+// linksOption links a trace or observation to related traces when it starts
+type linksOption []Link
+
+// A link to a whole trace has no span to point to, and an OpenTelemetry link
+// without span ID is invalid, so such links are recorded in the
+// langfuse.link.trace_ids attribute instead.
+func (o linksOption) applyStart(c *startConfig) {
+	for _, link := range o {
+		if link.ObservationID == "" {
+			if traceID, err := oteltrace.TraceIDFromHex(link.TraceID); err == nil {
+				c.linkedTraces = append(c.linkedTraces, traceID.String())
+			}
+			continue
+		}
+		if l, ok := link.otelLink(); ok {
+			c.links = append(c.links, l)
+		}
+	}
+}
+
+func (linksOption) applyTrace(*Trace)           {}
+func (linksOption) applySpan(*Span)             {}
+func (linksOption) applyGeneration(*Generation) {}
+
+// WithTraceLinks links the root observation of a trace to related traces or
+// observations. Links are set when the trace starts and links with invalid
+// IDs are ignored.
+func WithTraceLinks(links ...Link) TraceOption {
+	return linksOption(links)
+}
+
+// WithSpanLinks links a span to related traces or observations, e.g. a batch
+// consumer span to the producers of the messages it processes. Links are set
+// when the span starts and have no effect in Span.Update. Links with invalid
+// IDs are ignored.
+func WithSpanLinks(links ...Link) SpanOption {
+	return linksOption(links)
+}
+
+// WithGenerationLinks links a generation to related traces or observations,
+// e.g. a summarization to the traces whose outputs it consumes. Links are set
+// when the generation starts and have no effect in Generation.Update. Links
+// with invalid IDs are ignored.
+func WithGenerationLinks(links ...Link) GenerationOption {
+	return linksOption(links)
+}
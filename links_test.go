@@ -0,0 +1,112 @@
+package langfuse
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestLinks(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	upstream := client.CreateTrace(context.Background(), "upstream")
+	producer := upstream.CreateSpan("produce")
+	producer.End()
+	upstream.End()
+
+	traceLink := NewTraceLink(upstream)
+	spanLink := Link{TraceID: upstream.ID(), ObservationID: producer.ID()}
+	wholeTrace := Link{TraceID: upstream.ID()}
+	invalid := []Link{{TraceID: "xyz"}, {TraceID: upstream.ID(), ObservationID: "xyz"}}
+
+	tests := []struct {
+		name  string
+		start func(*Trace)
+		want  []Link
+	}{
+		{
+			name: "trace",
+			start: func(*Trace) {
+				client.CreateTrace(context.Background(), "trace", WithTraceLinks(append(invalid, traceLink)...)).End()
+			},
+			want: []Link{traceLink},
+		},
+		{
+			name: "span",
+			start: func(trace *Trace) {
+				span := trace.CreateSpan("span", WithSpanLinks(spanLink, wholeTrace))
+				span.Update(WithSpanLinks(traceLink))
+				span.End()
+			},
+			want: []Link{spanLink, wholeTrace},
+		},
+		{
+			name: "generation",
+			start: func(trace *Trace) {
+				trace.CreateGeneration("generation", WithGenerationLinks(invalid[1], spanLink)).End()
+			},
+			want: []Link{spanLink},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trace := client.CreateTrace(context.Background(), "downstream "+tt.name)
+			tt.start(trace)
+			trace.End()
+
+			got := spanLinks(findSpan(t, exporter, tt.name))
+			if len(got) != len(tt.want) {
+				t.Fatalf("links = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("link %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTraceLinkAttribute(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	const traceID = "0af7651916cd43dd8448eb211c80319c"
+	const otherID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	client.CreateTrace(context.Background(), "summary",
+		WithTraceLinks(Link{TraceID: traceID}),
+		WithTraceLinks(Link{TraceID: otherID}),
+	).End()
+
+	span := findSpan(t, exporter, "summary")
+	if len(span.Links) != 0 {
+		t.Errorf("got links %+v, want links to traces recorded as an attribute", span.Links)
+	}
+	want := attribute.StringSlice("langfuse.link.trace_ids", []string{traceID, otherID})
+	for _, kv := range span.Attributes {
+		if kv.Key == want.Key {
+			if kv.Value.Emit() != want.Value.Emit() {
+				t.Errorf("%s = %s, want %s", kv.Key, kv.Value.Emit(), want.Value.Emit())
+			}
+			return
+		}
+	}
+	t.Errorf("%s not set", want.Key)
+}
+
+// spanLinks converts the links and linked trace IDs of a recorded span back
+// to Links
+func spanLinks(span tracetest.SpanStub) []Link {
+	links := make([]Link, 0, len(span.Links))
+	for _, l := range span.Links {
+		links = append(links, Link{TraceID: l.SpanContext.TraceID().String(), ObservationID: l.SpanContext.SpanID().String()})
+	}
+	for _, kv := range span.Attributes {
+		if kv.Key == "langfuse.link.trace_ids" {
+			for _, traceID := range kv.Value.AsStringSlice() {
+				links = append(links, Link{TraceID: traceID})
+			}
+		}
+	}
+	return links
+}
@@ -0,0 +1,441 @@
+package langfuse
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	mediaReferencePrefix = "@@@langfuseMedia:"
+	mediaReferenceSuffix = "@@@"
+
+	// maxConcurrentMediaUploads bounds the number of uploads in flight per client
+	maxConcurrentMediaUploads = 4
+
+	// defaultMediaUploadTimeout bounds an upload when Config.ExportTimeout is
+	// not set
+	defaultMediaUploadTimeout = 30 * time.Second
+)
+
+// MediaSource describes where the content of a Media value came from
+type MediaSource string
+
+const (
+	MediaSourceBytes         MediaSource = "bytes"
+	MediaSourceFile          MediaSource = "file"
+	MediaSourceBase64DataURI MediaSource = "base64_data_uri"
+)
+
+// Media represents binary content (images, audio, PDFs, ...) attached to an
+// observation input, output or metadata. It is uploaded through the Langfuse
+// media API and serialized as a @@@langfuseMedia:...@@@ reference string.
+type Media struct {
+	contentType string
+	content     []byte
+	source      MediaSource
+	sha256Hash  string
+	id          string
+}
+
+// NewMediaFromBytes creates a media value from raw bytes
+func NewMediaFromBytes(content []byte, contentType string) *Media {
+	return newMedia(content, contentType, MediaSourceBytes)
+}
+
+// NewMediaFromFile creates a media value from a file on disk. If contentType
+// is empty it is derived from the file extension or the file content.
+func NewMediaFromFile(path string, contentType string) (*Media, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read media file: %w", err)
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(path))
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+	return newMedia(content, contentType, MediaSourceFile), nil
+}
+
+// NewMediaFromReader creates a media value by reading r to EOF. If
+// contentType is empty it is derived from the content.
+func NewMediaFromReader(r io.Reader, contentType string) (*Media, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read media content: %w", err)
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+	return newMedia(content, contentType, MediaSourceBytes), nil
+}
+
+// NewMediaFromDataURI creates a media value from a base64 data URI such as
+// "data:image/png;base64,iVBORw0..."
+func NewMediaFromDataURI(uri string) (*Media, error) {
+	contentType, content, ok := parseDataURI(uri)
+	if !ok {
+		return nil, fmt.Errorf("invalid base64 data URI")
+	}
+	return newMedia(content, contentType, MediaSourceBase64DataURI), nil
+}
+
+func newMedia(content []byte, contentType string, source MediaSource) *Media {
+	// Strip parameters such as "; charset=utf-8" which Langfuse does not accept
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = strings.TrimSpace(contentType[:i])
+	}
+
+	hash := sha256.Sum256(content)
+
+	return &Media{
+		contentType: contentType,
+		content:     content,
+		source:      source,
+		sha256Hash:  base64.StdEncoding.EncodeToString(hash[:]),
+		// Media IDs are derived from the content hash so identical content
+		// always maps to the same media object
+		id: base64.URLEncoding.EncodeToString(hash[:])[:22],
+	}
+}
+
+// ID returns the content-derived Langfuse media ID
+func (m *Media) ID() string {
+	return m.id
+}
+
+// ContentType returns the MIME type of the media
+func (m *Media) ContentType() string {
+	return m.contentType
+}
+
+// Reference returns the reference string that replaces the media content in
+// exported payloads
+func (m *Media) Reference() string {
+	return fmt.Sprintf("%stype=%s|id=%s|source=%s%s",
+		mediaReferencePrefix, m.contentType, m.id, m.source, mediaReferenceSuffix)
+}
+
+// MarshalJSON serializes the media as its reference string
+func (m *Media) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Reference())
+}
+
+// parseDataURI decodes a base64 data URI into its content type and content
+func parseDataURI(s string) (string, []byte, bool) {
+	if !strings.HasPrefix(s, "data:") {
+		return "", nil, false
+	}
+	header, data, ok := strings.Cut(s[len("data:"):], ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return "", nil, false
+	}
+	contentType := strings.TrimSuffix(header, ";base64")
+	if contentType == "" {
+		return "", nil, false
+	}
+	content, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", nil, false
+	}
+	return contentType, content, true
+}
+
+// mediaUploader uploads media content through the Langfuse media API
+type mediaUploader struct {
+	httpClient *http.Client
+	apiURL     string
+	authHeader string
+	timeout    time.Duration
+
+	mu      sync.Mutex
+	pending map[string]bool
+	wg      sync.WaitGroup
+	sem     chan struct{}
+}
+
+func newMediaUploader(httpClient *http.Client, apiURL, authHeader string, timeout time.Duration) *mediaUploader {
+	if timeout <= 0 {
+		timeout = defaultMediaUploadTimeout
+	}
+	return &mediaUploader{
+		httpClient: httpClient,
+		apiURL:     apiURL,
+		authHeader: authHeader,
+		timeout:    timeout,
+		pending:    make(map[string]bool),
+		sem:        make(chan struct{}, maxConcurrentMediaUploads),
+	}
+}
+
+// upload schedules an asynchronous upload of the media for the given field
+func (u *mediaUploader) upload(m *Media, traceID, observationID, field string) {
+	// Deduplicate identical content referenced from the same field while its
+	// upload is in flight
+	key := strings.Join([]string{m.id, traceID, observationID, field}, "|")
+
+	u.mu.Lock()
+	if u.pending[key] {
+		u.mu.Unlock()
+		return
+	}
+	u.pending[key] = true
+	u.mu.Unlock()
+
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		defer func() {
+			u.mu.Lock()
+			delete(u.pending, key)
+			u.mu.Unlock()
+		}()
+		u.sem <- struct{}{}
+		defer func() { <-u.sem }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), u.timeout)
+		defer cancel()
+
+		// Errors are not surfaced to the caller; the reference stays in the
+		// payload and Langfuse shows the media as missing
+		_ = u.uploadMedia(ctx, m, traceID, observationID, field)
+	}()
+}
+
+// wait blocks until all scheduled uploads have finished or ctx is done
+func (u *mediaUploader) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		u.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (u *mediaUploader) uploadMedia(ctx context.Context, m *Media, traceID, observationID, field string) error {
+	body := map[string]interface{}{
+		"traceId":       traceID,
+		"contentType":   m.contentType,
+		"contentLength": len(m.content),
+		"sha256Hash":    m.sha256Hash,
+		"field":         field,
+	}
+	if observationID != "" {
+		body["observationId"] = observationID
+	}
+
+	var uploadResp struct {
+		UploadURL *string `json:"uploadUrl"`
+		MediaID   string  `json:"mediaId"`
+	}
+	if err := u.doJSON(ctx, http.MethodPost, u.apiURL+"/api/public/media", body, &uploadResp); err != nil {
+		return fmt.Errorf("failed to get media upload URL: %w", err)
+	}
+
+	// A missing upload URL means Langfuse already stores content with this hash
+	if uploadResp.UploadURL == nil || *uploadResp.UploadURL == "" {
+		return nil
+	}
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, *uploadResp.UploadURL, bytes.NewReader(m.content))
+	if err != nil {
+		return fmt.Errorf("failed to create media upload request: %w", err)
+	}
+	req.Header.Set("Content-Type", m.contentType)
+	req.Header.Set("x-amz-checksum-sha256", m.sha256Hash)
+
+	status := map[string]interface{}{}
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		status["uploadHttpStatus"] = 0
+		status["uploadHttpError"] = err.Error()
+	} else {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		status["uploadHttpStatus"] = resp.StatusCode
+		if resp.StatusCode >= 300 {
+			status["uploadHttpError"] = string(respBody)
+		}
+	}
+	status["uploadedAt"] = time.Now().UTC().Format(time.RFC3339Nano)
+	status["uploadTimeMs"] = time.Since(start).Milliseconds()
+
+	mediaID := uploadResp.MediaID
+	if mediaID == "" {
+		mediaID = m.id
+	}
+	if err := u.doJSON(ctx, http.MethodPatch, u.apiURL+"/api/public/media/"+mediaID, status, nil); err != nil {
+		return fmt.Errorf("failed to report media upload status: %w", err)
+	}
+
+	return nil
+}
+
+func (u *mediaUploader) doJSON(ctx context.Context, method, url string, body interface{}, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", u.authHeader)
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// serializePayload marshals an input, output or metadata value to JSON,
+// replacing Media values and base64 data URIs with media references and
+// scheduling their upload
+func (c *Client) serializePayload(value interface{}, traceID, observationID, field string) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+
+	hasReferences := bytes.Contains(data, []byte(mediaReferencePrefix))
+	hasDataURIs := bytes.Contains(data, []byte(`"data:`))
+	if !hasReferences && !hasDataURIs {
+		return string(data)
+	}
+
+	media := make(map[string]*Media)
+	if hasReferences {
+		collectMedia(reflect.ValueOf(value), media, 0)
+	}
+	if hasDataURIs {
+		if replaced, ok := replaceDataURIs(data, media); ok {
+			data = replaced
+		}
+	}
+
+	for _, m := range media {
+		c.media.upload(m, traceID, observationID, field)
+	}
+
+	return string(data)
+}
+
+// collectMedia walks value and records every Media it contains
+func collectMedia(v reflect.Value, out map[string]*Media, depth int) {
+	if !v.IsValid() || depth > 32 {
+		return
+	}
+
+	if v.Type() == reflect.TypeOf(&Media{}) {
+		if !v.IsNil() {
+			m := v.Interface().(*Media)
+			out[m.id] = m
+		}
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			collectMedia(v.Elem(), out, depth+1)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				collectMedia(v.Field(i), out, depth+1)
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			collectMedia(iter.Value(), out, depth+1)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			collectMedia(v.Index(i), out, depth+1)
+		}
+	}
+}
+
+// replaceDataURIs rewrites every base64 data URI string in the JSON document
+// to a media reference
+func replaceDataURIs(data []byte, out map[string]*Media) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, false
+	}
+
+	changed := false
+	doc = walkDataURIs(doc, out, &changed)
+	if !changed {
+		return nil, false
+	}
+
+	replaced, err := json.Marshal(doc)
+	if err != nil {
+		return nil, false
+	}
+	return replaced, true
+}
+
+func walkDataURIs(v interface{}, out map[string]*Media, changed *bool) interface{} {
+	switch val := v.(type) {
+	case string:
+		m, err := NewMediaFromDataURI(val)
+		if err != nil {
+			return val
+		}
+		out[m.id] = m
+		*changed = true
+		return m.Reference()
+	case []interface{}:
+		for i, item := range val {
+			val[i] = walkDataURIs(item, out, changed)
+		}
+	case map[string]interface{}:
+		for key, item := range val {
+			val[key] = walkDataURIs(item, out, changed)
+		}
+	}
+	return v
+}
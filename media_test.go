@@ -0,0 +1,245 @@
+package langfuse
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseDataURI(t *testing.T) {
+	png := base64.StdEncoding.EncodeToString([]byte("\x89PNG"))
+	tests := []struct {
+		name        string
+		uri         string
+		contentType string
+		content     string
+		ok          bool
+	}{
+		{name: "png", uri: "data:image/png;base64," + png, contentType: "image/png", content: "\x89PNG", ok: true},
+		{name: "empty content", uri: "data:text/plain;base64,", contentType: "text/plain", content: "", ok: true},
+		{name: "not a data URI", uri: "https://example.com/a.png"},
+		{name: "not base64", uri: "data:text/plain,hello"},
+		{name: "missing content type", uri: "data:;base64," + png},
+		{name: "missing comma", uri: "data:image/png;base64"},
+		{name: "invalid base64", uri: "data:image/png;base64,!!!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, content, ok := parseDataURI(tt.uri)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if contentType != tt.contentType || string(content) != tt.content {
+				t.Errorf("got %q %q, want %q %q", contentType, content, tt.contentType, tt.content)
+			}
+		})
+	}
+}
+
+func TestNewMedia(t *testing.T) {
+	tests := []struct {
+		name        string
+		media       func() (*Media, error)
+		contentType string
+		source      MediaSource
+	}{
+		{
+			name:        "bytes strip parameters",
+			media:       func() (*Media, error) { return NewMediaFromBytes([]byte("hi"), "text/plain; charset=utf-8"), nil },
+			contentType: "text/plain",
+			source:      MediaSourceBytes,
+		},
+		{
+			name:        "reader detects content type",
+			media:       func() (*Media, error) { return NewMediaFromReader(strings.NewReader("%PDF-1.7"), "") },
+			contentType: "application/pdf",
+			source:      MediaSourceBytes,
+		},
+		{
+			name:        "data URI",
+			media:       func() (*Media, error) { return NewMediaFromDataURI("data:audio/wav;base64,UklGRg==") },
+			contentType: "audio/wav",
+			source:      MediaSourceBase64DataURI,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := tt.media()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.ContentType() != tt.contentType {
+				t.Errorf("content type = %q, want %q", m.ContentType(), tt.contentType)
+			}
+			if len(m.ID()) != 22 {
+				t.Errorf("ID %q has length %d, want 22", m.ID(), len(m.ID()))
+			}
+			want := "@@@langfuseMedia:type=" + tt.contentType + "|id=" + m.ID() + "|source=" + string(tt.source) + "@@@"
+			if m.Reference() != want {
+				t.Errorf("reference = %q, want %q", m.Reference(), want)
+			}
+		})
+	}
+
+	a := NewMediaFromBytes([]byte("same"), "text/plain")
+	b := NewMediaFromBytes([]byte("same"), "text/plain")
+	if a.ID() != b.ID() {
+		t.Errorf("identical content has IDs %q and %q", a.ID(), b.ID())
+	}
+}
+
+// mediaServer fakes the Langfuse media API and the upload target
+type mediaServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []string
+	fields   []string
+	uploads  [][]byte
+	statuses []map[string]interface{}
+}
+
+func newMediaServer(t *testing.T) *mediaServer {
+	s := &mediaServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/public/media":
+			var req map[string]interface{}
+			_ = json.Unmarshal(body, &req)
+			s.fields = append(s.fields, req["field"].(string))
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"uploadUrl": s.URL + "/upload",
+				"mediaId":   "media-id",
+			})
+		case r.Method == http.MethodPut && r.URL.Path == "/upload":
+			s.uploads = append(s.uploads, body)
+		case r.Method == http.MethodPatch && r.URL.Path == "/api/public/media/media-id":
+			var status map[string]interface{}
+			_ = json.Unmarshal(body, &status)
+			s.statuses = append(s.statuses, status)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestSerializePayloadUploadsMedia(t *testing.T) {
+	server := newMediaServer(t)
+	client, exporter := newTestClient(t, Config{BaseURL: server.URL})
+
+	image := NewMediaFromBytes([]byte("image bytes"), "image/png")
+	trace := client.CreateTrace(context.Background(), "media")
+	span := trace.CreateSpan("describe",
+		WithSpanInput(map[string]interface{}{"image": image}),
+		WithSpanOutput([]string{"data:text/plain;base64," + base64.StdEncoding.EncodeToString([]byte("text bytes"))}),
+	)
+	span.End()
+	trace.End()
+	if err := client.media.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	recorded := findSpan(t, exporter, "describe")
+	if input := stringAttr(recorded, "langfuse.observation.input"); !strings.Contains(input, image.Reference()) {
+		t.Errorf("input %s does not reference the media", input)
+	}
+	if output := stringAttr(recorded, "langfuse.observation.output"); strings.Contains(output, "data:") || !strings.Contains(output, mediaReferencePrefix) {
+		t.Errorf("output %s still contains the data URI", output)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.uploads) != 2 || len(server.statuses) != 2 {
+		t.Fatalf("got %d uploads and %d status reports, want 2 each: %v", len(server.uploads), len(server.statuses), server.requests)
+	}
+	uploaded := map[string]bool{string(server.uploads[0]): true, string(server.uploads[1]): true}
+	if !uploaded["image bytes"] || !uploaded["text bytes"] {
+		t.Errorf("uploaded %q", server.uploads)
+	}
+	if fields := strings.Join(server.fields, ","); fields != "input,output" && fields != "output,input" {
+		t.Errorf("fields = %s", fields)
+	}
+	if status := server.statuses[0]["uploadHttpStatus"]; status != float64(http.StatusOK) {
+		t.Errorf("reported upload status %v", status)
+	}
+}
+
+func TestSerializePayloadWithoutMedia(t *testing.T) {
+	client, _ := newTestClient(t, Config{})
+	got := client.serializePayload(map[string]string{"text": "no media"}, "trace", "", "input")
+	if got != `{"text":"no media"}` {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestMediaUploaderForgetsFinishedUploads(t *testing.T) {
+	server := newMediaServer(t)
+	u := newMediaUploader(server.Client(), server.URL, "Basic test", 0)
+	m := NewMediaFromBytes([]byte("content"), "text/plain")
+
+	for i := 0; i < 2; i++ {
+		u.upload(m, "trace", "observation", "input")
+		if err := u.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u.mu.Lock()
+	pending := len(u.pending)
+	u.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d uploads still pending", pending)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.uploads) != 2 {
+		t.Errorf("got %d uploads, want one per finished upload", len(server.uploads))
+	}
+}
+
+func TestMediaUploaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	u := newMediaUploader(server.Client(), server.URL, "Basic test", 50*time.Millisecond)
+	u.upload(NewMediaFromBytes([]byte("content"), "text/plain"), "trace", "", "input")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := u.wait(ctx); err != nil {
+		t.Fatalf("upload was not bounded by the timeout: %v", err)
+	}
+}
+
+func TestMediaMarshalJSON(t *testing.T) {
+	m := NewMediaFromBytes([]byte("x"), "text/plain")
+	data, err := json.Marshal(map[string]*Media{"file": m})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(m.Reference())) {
+		t.Errorf("got %s", data)
+	}
+}
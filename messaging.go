@@ -0,0 +1,123 @@
+package langfuse
+
+import (
+	"context"
+	"slices"
+
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// MessageHeader is satisfied by Kafka-style message headers with byte keys
+// and values, e.g. sarama.RecordHeader. Headers with string keys, such as
+// kafka.Header of segmentio/kafka-go and confluent-kafka-go, do not satisfy
+// it; convert them to and from a map for the map variants instead.
+type MessageHeader interface {
+	~struct {
+		Key   []byte
+		Value []byte
+	}
+}
+
+// header is the underlying type of every MessageHeader
+type header = struct {
+	Key   []byte
+	Value []byte
+}
+
+// HeaderSliceCarrier adapts a slice of message headers to
+// propagation.TextMapCarrier. Set writes to the slice in place, replacing an
+// existing header of the same key, so wrap a copy if the headers are shared.
+type HeaderSliceCarrier[H MessageHeader] []H
+
+// Get returns the value of the first header with key
+func (c *HeaderSliceCarrier[H]) Get(key string) string {
+	for _, h := range *c {
+		if string(header(h).Key) == key {
+			return string(header(h).Value)
+		}
+	}
+	return ""
+}
+
+// Set stores a header, replacing the value of an existing header with key in
+// place or appending a new one
+func (c *HeaderSliceCarrier[H]) Set(key, value string) {
+	for i, h := range *c {
+		if string(header(h).Key) == key {
+			(*c)[i] = H(header{Key: header(h).Key, Value: []byte(value)})
+			return
+		}
+	}
+	*c = append(*c, H(header{Key: []byte(key), Value: []byte(value)}))
+}
+
+// Keys lists the header keys
+func (c *HeaderSliceCarrier[H]) Keys() []string {
+	keys := make([]string, 0, len(*c))
+	for _, h := range *c {
+		keys = append(keys, string(header(h).Key))
+	}
+	return keys
+}
+
+// InjectIntoHeaders writes the trace context of the current observation in
+// ctx, with the trace's user ID, session ID and tags, into the headers of an
+// outgoing message. A consumer continues the trace with ContinueFromHeaders.
+func InjectIntoHeaders(ctx context.Context, headers map[string]string) {
+	injectContext(ctx, propagation.MapCarrier(headers))
+}
+
+// InjectIntoHeaderSlice is InjectIntoHeaders for Kafka-style headers. It
+// returns a copy of the headers with the trace context added and leaves the
+// given slice unchanged.
+func InjectIntoHeaderSlice[H MessageHeader](ctx context.Context, headers []H) []H {
+	carrier := HeaderSliceCarrier[H](slices.Clone(headers))
+	injectContext(ctx, &carrier)
+	return carrier
+}
+
+// injectContext writes the trace context of ctx into carrier, including the
+// trace's baggage if ctx carries a Langfuse trace
+func injectContext(ctx context.Context, carrier propagation.TextMapCarrier) {
+	if t := TraceFromContext(ctx); t != nil {
+		t.inject(ctx, carrier)
+		return
+	}
+	propagator.Inject(ctx, carrier)
+}
+
+// ContinueFromHeaders continues the trace of the producer of a message from
+// its headers, as Client.ContinueTrace does for requests. Without trace
+// context in the headers it starts a new trace.
+func ContinueFromHeaders(ctx context.Context, client *Client, headers map[string]string, name string, opts ...TraceOption) *Trace {
+	return client.ContinueTrace(ctx, propagation.MapCarrier(headers), name, opts...)
+}
+
+// ContinueFromHeaderSlice is ContinueFromHeaders for Kafka-style headers
+func ContinueFromHeaderSlice[H MessageHeader](ctx context.Context, client *Client, headers []H, name string, opts ...TraceOption) *Trace {
+	carrier := HeaderSliceCarrier[H](headers)
+	return client.ContinueTrace(ctx, &carrier, name, opts...)
+}
+
+// LinkFromHeaders returns a link to the observation that produced a message,
+// read from its headers. It reports false if the headers carry no trace
+// context. Batch consumers pass the links of all messages to WithSpanLinks.
+func LinkFromHeaders(headers map[string]string) (Link, bool) {
+	return linkFromCarrier(propagation.MapCarrier(headers))
+}
+
+// LinkFromHeaderSlice is LinkFromHeaders for Kafka-style headers
+func LinkFromHeaderSlice[H MessageHeader](headers []H) (Link, bool) {
+	carrier := HeaderSliceCarrier[H](headers)
+	return linkFromCarrier(&carrier)
+}
+
+// linkFromCarrier extracts the upstream span context from carrier
+func linkFromCarrier(carrier propagation.TextMapCarrier) (Link, bool) {
+	sc := oteltrace.SpanContextFromContext(propagator.Extract(context.Background(), carrier))
+	if !sc.IsValid() {
+		return Link{}, false
+	}
+	return Link{TraceID: sc.TraceID().String(), ObservationID: sc.SpanID().String()}, true
+}
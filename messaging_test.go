@@ -0,0 +1,162 @@
+package langfuse
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// recordHeader mirrors sarama.RecordHeader
+type recordHeader struct {
+	Key   []byte
+	Value []byte
+}
+
+func TestInjectIntoHeaders(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	producer := client.CreateTrace(context.Background(), "produce", WithTraceUserID("user-1"))
+	send := producer.CreateSpan("send")
+
+	headers := map[string]string{"content-type": "application/json"}
+	InjectIntoHeaders(send.Context(), headers)
+	if headers["traceparent"] == "" {
+		t.Fatal("no traceparent injected")
+	}
+	if !strings.Contains(headers["baggage"], "langfuse_user_id=user-1") {
+		t.Errorf("baggage = %q", headers["baggage"])
+	}
+
+	ContinueFromHeaders(context.Background(), client, headers, "consume").End()
+	send.End()
+	producer.End()
+
+	consume, parent := findSpan(t, exporter, "consume"), findSpan(t, exporter, "send")
+	if consume.Parent.SpanID() != parent.SpanContext.SpanID() {
+		t.Error("consumer trace is not a child of the producing span")
+	}
+	if got := stringAttr(consume, "langfuse.user.id"); got != "user-1" {
+		t.Errorf("user ID = %q, want user-1", got)
+	}
+}
+
+func TestInjectIntoHeaderSlice(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	producer := client.CreateTrace(context.Background(), "produce")
+
+	headers := []recordHeader{
+		{Key: []byte("traceparent"), Value: []byte("stale")},
+		{Key: []byte("content-type"), Value: []byte("application/json")},
+	}
+	injected := InjectIntoHeaderSlice(producer.Context(), headers)
+
+	if string(headers[0].Value) != "stale" || len(headers) != 2 {
+		t.Errorf("the given headers changed to %q", headers)
+	}
+	carrier := HeaderSliceCarrier[recordHeader](injected)
+	if got := carrier.Get("traceparent"); got == "stale" || !strings.Contains(got, producer.ID()) {
+		t.Errorf("traceparent = %q, want the producer's trace", got)
+	}
+	if got := carrier.Get("content-type"); got != "application/json" {
+		t.Errorf("content-type = %q, want it kept", got)
+	}
+	if n := strings.Count(strings.Join(carrier.Keys(), ","), "traceparent"); n != 1 {
+		t.Errorf("got %d traceparent headers, want the existing one replaced", n)
+	}
+
+	ContinueFromHeaderSlice(context.Background(), client, injected, "consume").End()
+	producer.End()
+
+	consume, parent := findSpan(t, exporter, "consume"), findSpan(t, exporter, "produce")
+	if consume.Parent.SpanID() != parent.SpanContext.SpanID() {
+		t.Error("consumer trace is not a child of the producer")
+	}
+}
+
+func TestInjectIntoHeadersWithoutTrace(t *testing.T) {
+	sc := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    oteltrace.TraceID{1},
+		SpanID:     oteltrace.SpanID{2},
+		TraceFlags: oteltrace.FlagsSampled,
+	})
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"no span", context.Background(), ""},
+		{"other tracer", oteltrace.ContextWithSpanContext(context.Background(), sc), "00-" + sc.TraceID().String() + "-" + sc.SpanID().String() + "-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			InjectIntoHeaders(tt.ctx, headers)
+			if headers["traceparent"] != tt.want {
+				t.Errorf("traceparent = %q, want %q", headers["traceparent"], tt.want)
+			}
+		})
+	}
+}
+
+func TestHeaderSliceCarrier(t *testing.T) {
+	carrier := HeaderSliceCarrier[recordHeader]{
+		{Key: []byte("a"), Value: []byte("1")},
+		{Key: []byte("a"), Value: []byte("2")},
+	}
+	carrier.Set("a", "3")
+	carrier.Set("b", "4")
+
+	want := HeaderSliceCarrier[recordHeader]{
+		{Key: []byte("a"), Value: []byte("3")},
+		{Key: []byte("a"), Value: []byte("2")},
+		{Key: []byte("b"), Value: []byte("4")},
+	}
+	if !reflect.DeepEqual(carrier, want) {
+		t.Errorf("headers = %q, want %q", carrier, want)
+	}
+	if got := carrier.Get("a"); got != "3" {
+		t.Errorf("Get(a) = %q, want the first value", got)
+	}
+	if got := carrier.Get("c"); got != "" {
+		t.Errorf("Get(c) = %q, want empty", got)
+	}
+	if keys := carrier.Keys(); !reflect.DeepEqual(keys, []string{"a", "a", "b"}) {
+		t.Errorf("Keys() = %q", keys)
+	}
+}
+
+func TestLinkFromHeaders(t *testing.T) {
+	const traceparent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	want := Link{TraceID: "0af7651916cd43dd8448eb211c80319c", ObservationID: "b7ad6b7169203331"}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    Link
+		ok      bool
+	}{
+		{"traceparent", map[string]string{"traceparent": traceparent}, want, true},
+		{"no trace context", map[string]string{"content-type": "application/json"}, Link{}, false},
+		{"malformed", map[string]string{"traceparent": "00-xyz"}, Link{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, ok := LinkFromHeaders(tt.headers)
+			if link != tt.want || ok != tt.ok {
+				t.Errorf("LinkFromHeaders = %+v, %v, want %+v, %v", link, ok, tt.want, tt.ok)
+			}
+
+			var slice []recordHeader
+			for key, value := range tt.headers {
+				slice = append(slice, recordHeader{Key: []byte(key), Value: []byte(value)})
+			}
+			link, ok = LinkFromHeaderSlice(slice)
+			if link != tt.want || ok != tt.ok {
+				t.Errorf("LinkFromHeaderSlice = %+v, %v, want %+v, %v", link, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package langfuse
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// defaultMaxBodySize is the default number of body bytes captured per request
+// or response
+const defaultMaxBodySize = 64 * 1024
+
+// HTTPMiddlewareOptions configures HTTPMiddleware. All fields are optional.
+type HTTPMiddlewareOptions struct {
+	// TraceName returns the trace name for a request. Defaults to the method
+	// and the ServeMux route pattern, or the URL path if no pattern matched.
+	TraceName func(r *http.Request) string
+
+	// UserID and SessionID extract the Langfuse user and session IDs from a
+	// request, e.g. from a header or an authenticated principal
+	UserID    func(r *http.Request) string
+	SessionID func(r *http.Request) string
+
+	// TraceOptions returns additional options for the trace of a request
+	TraceOptions func(r *http.Request) []TraceOption
+
+	// TrustBaggage records the user ID, session ID and tags that the caller
+	// sent as baggage, as ContinueTrace does. Only enable it when every caller
+	// is trusted, e.g. behind a gateway that strips the baggage header from
+	// external requests. By default only the W3C trace context is continued.
+	TrustBaggage bool
+
+	// CaptureRequestBody and CaptureResponseBody record the bodies as trace
+	// input and output, up to MaxBodySize bytes (default 64 KiB)
+	CaptureRequestBody  bool
+	CaptureResponseBody bool
+	MaxBodySize         int
+
+	// MaskBody redacts sensitive data from captured bodies before they are
+	// recorded
+	MaskBody func(body []byte, contentType string) []byte
+
+	// Skip excludes requests, e.g. health checks, from tracing
+	Skip func(r *http.Request) bool
+}
+
+// HTTPMiddleware returns net/http middleware that creates a trace per request.
+// Incoming W3C trace context is continued, Langfuse baggage only with
+// TrustBaggage, the trace is available to handlers
+// via TraceFromContext(r.Context()), and response status codes are recorded
+// as levels: 5xx as ERROR, 4xx as WARNING.
+func HTTPMiddleware(client *Client, opts HTTPMiddlewareOptions) func(http.Handler) http.Handler {
+	maxBodySize := opts.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultMaxBodySize
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if opts.Skip != nil && opts.Skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			name := r.Method + " " + r.URL.Path
+			if opts.TraceName != nil {
+				name = opts.TraceName(r)
+			}
+
+			var traceOpts []TraceOption
+			if opts.UserID != nil {
+				if userID := opts.UserID(r); userID != "" {
+					traceOpts = append(traceOpts, WithTraceUserID(userID))
+				}
+			}
+			if opts.SessionID != nil {
+				if sessionID := opts.SessionID(r); sessionID != "" {
+					traceOpts = append(traceOpts, WithTraceSessionID(sessionID))
+				}
+			}
+			if opts.TraceOptions != nil {
+				traceOpts = append(traceOpts, opts.TraceOptions(r)...)
+			}
+
+			trace := client.continueTrace(r.Context(), propagation.HeaderCarrier(r.Header), name, opts.TrustBaggage, traceOpts)
+			trace.span.SetAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+			)
+
+			var reqBody *bodyCapture
+			if opts.CaptureRequestBody && r.Body != nil && r.Body != http.NoBody {
+				reqBody = &bodyCapture{ReadCloser: r.Body, limit: maxBodySize}
+				r.Body = reqBody
+			}
+
+			rw := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			if opts.CaptureResponseBody {
+				rw.body = &bodyCapture{limit: maxBodySize}
+			}
+
+			r = r.WithContext(trace.Context())
+
+			defer func() {
+				recovered := recover()
+				if recovered != nil {
+					rw.status = http.StatusInternalServerError
+				}
+
+				// ServeMux stores the matched pattern on the request it serves
+				if r.Pattern != "" {
+					trace.span.SetAttributes(attribute.String("http.route", r.Pattern))
+					if opts.TraceName == nil {
+						trace.span.SetName(routeName(r.Method, r.Pattern))
+					}
+				}
+
+				input := map[string]interface{}{
+					"method": r.Method,
+					"url":    r.URL.RequestURI(),
+				}
+				if reqBody != nil {
+					input["body"] = capturedBody(reqBody, r.Header.Get("Content-Type"), opts.MaskBody)
+				}
+				traceUpdates := []TraceOption{WithTraceInput(input)}
+				if rw.body != nil {
+					traceUpdates = append(traceUpdates, WithTraceOutput(map[string]interface{}{
+						"status": rw.status,
+						"body":   capturedBody(rw.body, rw.Header().Get("Content-Type"), opts.MaskBody),
+					}))
+				}
+				trace.Update(traceUpdates...)
+
+				trace.span.SetAttributes(attribute.Int("http.response.status_code", rw.status))
+				setStatusLevel(trace, rw.status, recovered)
+				trace.End()
+
+				if recovered != nil {
+					panic(recovered)
+				}
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// routeName returns the trace name for a ServeMux pattern, which may already
+// start with the method, e.g. "GET /items/{id}"
+func routeName(method, pattern string) string {
+	if strings.Contains(pattern, " ") {
+		return pattern
+	}
+	return method + " " + pattern
+}
+
+// setStatusLevel records an HTTP status code as the level of the trace's root
+// observation
+func setStatusLevel(trace *Trace, status int, recovered interface{}) {
+	level := LogLevelDefault
+	message := ""
+	switch {
+	case recovered != nil:
+		level = LogLevelError
+		message = fmt.Sprintf("panic: %v", recovered)
+	case status >= 500:
+		level = LogLevelError
+		message = http.StatusText(status)
+	case status >= 400:
+		level = LogLevelWarning
+		message = http.StatusText(status)
+	}
+
+	trace.span.SetAttributes(attribute.String("langfuse.observation.level", string(level)))
+	if message != "" {
+		trace.span.SetAttributes(attribute.String("langfuse.observation.status_message", message))
+	}
+	if level == LogLevelError {
+		trace.span.SetStatus(codes.Error, message)
+	}
+}
+
+// capturedBody converts a captured body into a payload value: JSON bodies are
+// embedded as JSON, other bodies as text
+func capturedBody(capture *bodyCapture, contentType string, mask func([]byte, string) []byte) interface{} {
+	data := capture.buf.Bytes()
+	if mask != nil {
+		data = mask(data, contentType)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	isJSON := mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+	if isJSON && !capture.truncated && json.Valid(data) {
+		return json.RawMessage(data)
+	}
+
+	text := string(data)
+	if capture.truncated {
+		text += "...[truncated]"
+	}
+	return text
+}
+
+// bodyCapture records up to limit bytes of a body as it is read or written
+type bodyCapture struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (c *bodyCapture) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.record(p[:n])
+	return n, err
+}
+
+func (c *bodyCapture) record(p []byte) {
+	remaining := c.limit - c.buf.Len()
+	if len(p) > remaining {
+		p = p[:remaining]
+		c.truncated = true
+	}
+	c.buf.Write(p)
+}
+
+// responseRecorder records the status code and, optionally, the body of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        *bodyCapture
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	if w.body != nil {
+		w.body.record(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush supports streaming handlers such as server-sent events
+func (w *responseRecorder) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack supports connection upgrades such as websockets. The response is
+// recorded with status 101 once the connection is taken over.
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && !w.wroteHeader {
+		w.status = http.StatusSwitchingProtocols
+		w.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
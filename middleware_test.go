@@ -0,0 +1,266 @@
+package langfuse
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestHTTPMiddlewareStatusLevels(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		level   LogLevel
+		message string
+	}{
+		{
+			name:    "ok",
+			handler: func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "ok") },
+			status:  http.StatusOK,
+			level:   LogLevelDefault,
+		},
+		{
+			name:    "not found",
+			handler: http.NotFound,
+			status:  http.StatusNotFound,
+			level:   LogLevelWarning,
+			message: "Not Found",
+		},
+		{
+			name:    "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadGateway) },
+			status:  http.StatusBadGateway,
+			level:   LogLevelError,
+			message: "Bad Gateway",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, exporter := newTestClient(t, Config{})
+			handler := HTTPMiddleware(client, HTTPMiddlewareOptions{})(tt.handler)
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items", nil))
+
+			span := findSpan(t, exporter, "GET /items")
+			if got := spanAttrs(span)["http.response.status_code"].AsInt64(); got != int64(tt.status) {
+				t.Errorf("status = %d, want %d", got, tt.status)
+			}
+			if got := stringAttr(span, "langfuse.observation.level"); got != string(tt.level) {
+				t.Errorf("level = %s, want %s", got, tt.level)
+			}
+			if got := stringAttr(span, "langfuse.observation.status_message"); got != tt.message {
+				t.Errorf("status message = %q, want %q", got, tt.message)
+			}
+			if (span.Status.Code == codes.Error) != (tt.level == LogLevelError) {
+				t.Errorf("span status = %v", span.Status.Code)
+			}
+		})
+	}
+}
+
+func TestHTTPMiddlewarePanic(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	handler := HTTPMiddleware(client, HTTPMiddlewareOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic was swallowed")
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+
+	span := findSpan(t, exporter, "GET /")
+	if got := stringAttr(span, "langfuse.observation.status_message"); got != "panic: boom" {
+		t.Errorf("status message = %q", got)
+	}
+}
+
+func TestHTTPMiddlewareBodies(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		w.Write(body)
+	})
+	tests := []struct {
+		name        string
+		opts        HTTPMiddlewareOptions
+		contentType string
+		body        string
+		input       string
+		output      string
+	}{
+		{
+			name:        "json",
+			opts:        HTTPMiddlewareOptions{CaptureRequestBody: true, CaptureResponseBody: true},
+			contentType: "application/json",
+			body:        `{"q":"hi"}`,
+			input:       `{"body":{"q":"hi"},"method":"POST","url":"/echo"}`,
+			output:      `{"body":{"q":"hi"},"status":200}`,
+		},
+		{
+			name:        "truncated",
+			opts:        HTTPMiddlewareOptions{CaptureRequestBody: true, MaxBodySize: 4},
+			contentType: "text/plain",
+			body:        "hello world",
+			input:       `{"body":"hell...[truncated]","method":"POST","url":"/echo"}`,
+		},
+		{
+			name: "masked",
+			opts: HTTPMiddlewareOptions{CaptureResponseBody: true, MaskBody: func(body []byte, contentType string) []byte {
+				return []byte(strings.ReplaceAll(string(body), "secret", "***"))
+			}},
+			contentType: "text/plain",
+			body:        "my secret",
+			input:       `{"method":"POST","url":"/echo"}`,
+			output:      `{"body":"my ***","status":200}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, exporter := newTestClient(t, Config{})
+			req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			HTTPMiddleware(client, tt.opts)(echo).ServeHTTP(rec, req)
+
+			if rec.Body.String() != tt.body {
+				t.Errorf("handler response = %q, want it unchanged", rec.Body.String())
+			}
+			span := findSpan(t, exporter, "POST /echo")
+			if got := stringAttr(span, "langfuse.trace.input"); got != tt.input {
+				t.Errorf("input = %s, want %s", got, tt.input)
+			}
+			if got := stringAttr(span, "langfuse.trace.output"); got != tt.output {
+				t.Errorf("output = %s, want %s", got, tt.output)
+			}
+		})
+	}
+}
+
+func TestHTTPMiddlewareRouteAndSkip(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {})
+	handler := HTTPMiddleware(client, HTTPMiddlewareOptions{
+		Skip: func(r *http.Request) bool { return r.URL.Path == "/healthz" },
+	})(mux)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/42", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d traces, want the skipped request left out", len(spans))
+	}
+	if spans[0].Name != "GET /items/{id}" || stringAttr(spans[0], "http.route") != "GET /items/{id}" {
+		t.Errorf("trace %q has route %q", spans[0].Name, stringAttr(spans[0], "http.route"))
+	}
+}
+
+func TestHTTPMiddlewareHijack(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	served := make(chan struct{})
+	upgrade := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\nhello")
+		rw.Flush()
+	})
+	middleware := HTTPMiddleware(client, HTTPMiddlewareOptions{})(upgrade)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(served)
+		middleware.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not return")
+	}
+	span := findSpan(t, exporter, "GET /ws")
+	if got := spanAttrs(span)["http.response.status_code"].AsInt64(); got != http.StatusSwitchingProtocols {
+		t.Errorf("recorded status %d, want 101", got)
+	}
+}
+
+func TestHTTPMiddlewareContinuesTrace(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	upstream := client.CreateTrace(context.Background(), "upstream")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	upstream.Inject(propagation.HeaderCarrier(req.Header))
+
+	var inHandler *Trace
+	HTTPMiddleware(client, HTTPMiddlewareOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inHandler = TraceFromContext(r.Context())
+	})).ServeHTTP(httptest.NewRecorder(), req)
+	upstream.End()
+
+	if inHandler == nil {
+		t.Fatal("handler context carries no trace")
+	}
+	if got := findSpan(t, exporter, "GET /").Parent.SpanID(); got != findSpan(t, exporter, "upstream").SpanContext.SpanID() {
+		t.Errorf("request trace parent = %s, want the upstream trace", got)
+	}
+}
+
+func TestHTTPMiddlewareBaggage(t *testing.T) {
+	for _, trust := range []bool{false, true} {
+		t.Run(fmt.Sprintf("trust %v", trust), func(t *testing.T) {
+			client, exporter := newTestClient(t, Config{})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("baggage", "langfuse_user_id=admin,langfuse_session_id=s-1,other=kept")
+
+			var forwarded http.Header
+			HTTPMiddleware(client, HTTPMiddlewareOptions{TrustBaggage: trust})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				forwarded = http.Header{}
+				TraceFromContext(r.Context()).Inject(propagation.HeaderCarrier(forwarded))
+			})).ServeHTTP(httptest.NewRecorder(), req)
+
+			attrs := spanAttrs(findSpan(t, exporter, "GET /"))
+			if got := attrs["langfuse.user.id"].AsString(); (got == "admin") != trust {
+				t.Errorf("user ID = %q with TrustBaggage %v", got, trust)
+			}
+			bag := forwarded.Get("baggage")
+			if strings.Contains(bag, "langfuse_user_id") != trust {
+				t.Errorf("forwarded baggage = %q with TrustBaggage %v", bag, trust)
+			}
+			if !strings.Contains(bag, "other=kept") {
+				t.Errorf("forwarded baggage = %q, want other members kept", bag)
+			}
+		})
+	}
+}
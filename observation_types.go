@@ -0,0 +1,155 @@
+package langfuse
+
+import (
+	"encoding/json"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RetrievedDocument represents a document returned by a retriever observation
+type RetrievedDocument struct {
+	ID       string                 `json:"id,omitempty"`
+	Content  string                 `json:"content"`
+	Score    *float64               `json:"score,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// CreateAgent creates a new agent observation within the trace
+func (t *Trace) CreateAgent(name string, opts ...SpanOption) *Span {
+	return t.startSpan(t.ctx, name, ObservationTypeAgent, opts)
+}
+
+// CreateTool creates a new tool observation within the trace
+func (t *Trace) CreateTool(name string, opts ...SpanOption) *Span {
+	return t.startSpan(t.ctx, name, ObservationTypeTool, opts)
+}
+
+// CreateChain creates a new chain observation within the trace
+func (t *Trace) CreateChain(name string, opts ...SpanOption) *Span {
+	return t.startSpan(t.ctx, name, ObservationTypeChain, opts)
+}
+
+// CreateRetriever creates a new retriever observation within the trace
+func (t *Trace) CreateRetriever(name string, opts ...SpanOption) *Span {
+	return t.startSpan(t.ctx, name, ObservationTypeRetriever, opts)
+}
+
+// CreateEvaluator creates a new evaluator observation within the trace
+func (t *Trace) CreateEvaluator(name string, opts ...SpanOption) *Span {
+	return t.startSpan(t.ctx, name, ObservationTypeEvaluator, opts)
+}
+
+// CreateGuardrail creates a new guardrail observation within the trace
+func (t *Trace) CreateGuardrail(name string, opts ...SpanOption) *Span {
+	return t.startSpan(t.ctx, name, ObservationTypeGuardrail, opts)
+}
+
+// CreateEmbedding creates a new embedding observation within the trace.
+// Embeddings are generation-like and accept model, usage and cost options.
+func (t *Trace) CreateEmbedding(name string, opts ...GenerationOption) *Generation {
+	return t.startGeneration(t.ctx, name, ObservationTypeEmbedding, opts)
+}
+
+// CreateAgent creates a new agent observation nested under the span
+func (s *Span) CreateAgent(name string, opts ...SpanOption) *Span {
+	return s.trace.startSpan(s.ctx, name, ObservationTypeAgent, opts)
+}
+
+// CreateTool creates a new tool observation nested under the span
+func (s *Span) CreateTool(name string, opts ...SpanOption) *Span {
+	return s.trace.startSpan(s.ctx, name, ObservationTypeTool, opts)
+}
+
+// CreateChain creates a new chain observation nested under the span
+func (s *Span) CreateChain(name string, opts ...SpanOption) *Span {
+	return s.trace.startSpan(s.ctx, name, ObservationTypeChain, opts)
+}
+
+// CreateRetriever creates a new retriever observation nested under the span
+func (s *Span) CreateRetriever(name string, opts ...SpanOption) *Span {
+	return s.trace.startSpan(s.ctx, name, ObservationTypeRetriever, opts)
+}
+
+// CreateEvaluator creates a new evaluator observation nested under the span
+func (s *Span) CreateEvaluator(name string, opts ...SpanOption) *Span {
+	return s.trace.startSpan(s.ctx, name, ObservationTypeEvaluator, opts)
+}
+
+// CreateGuardrail creates a new guardrail observation nested under the span
+func (s *Span) CreateGuardrail(name string, opts ...SpanOption) *Span {
+	return s.trace.startSpan(s.ctx, name, ObservationTypeGuardrail, opts)
+}
+
+// CreateEmbedding creates a new embedding observation nested under the span
+func (s *Span) CreateEmbedding(name string, opts ...GenerationOption) *Generation {
+	return s.trace.startGeneration(s.ctx, name, ObservationTypeEmbedding, opts)
+}
+
+// WithToolName sets the name of the invoked tool when it differs from the
+// observation name
+func WithToolName(toolName string) SpanOption {
+	return SpanOptionFunc(func(s *Span) {
+		s.span.SetAttributes(attribute.String("langfuse.observation.metadata.tool_name", toolName))
+	})
+}
+
+// WithToolCallID sets the ID of the model tool call that triggered the tool
+func WithToolCallID(toolCallID string) SpanOption {
+	return SpanOptionFunc(func(s *Span) {
+		s.span.SetAttributes(attribute.String("langfuse.observation.metadata.tool_call_id", toolCallID))
+	})
+}
+
+// WithToolArguments sets the arguments the tool was called with as the
+// observation input
+func WithToolArguments(arguments interface{}) SpanOption {
+	return WithSpanInput(arguments)
+}
+
+// WithToolResult sets the result returned by the tool as the observation output
+func WithToolResult(result interface{}) SpanOption {
+	return WithSpanOutput(result)
+}
+
+// WithRetrieverQuery sets the retrieval query as the observation input
+func WithRetrieverQuery(query interface{}) SpanOption {
+	return WithSpanInput(query)
+}
+
+// WithRetrievedDocuments sets the retrieved documents and their scores as
+// the observation output
+func WithRetrievedDocuments(documents []RetrievedDocument) SpanOption {
+	return SpanOptionFunc(func(s *Span) {
+		outputJSON := s.trace.serializePayload(s.span, map[string]interface{}{
+			"documents": documents,
+		}, "output")
+		s.span.SetAttributes(
+			attribute.String("langfuse.observation.output", outputJSON),
+			attribute.Int("langfuse.observation.metadata.document_count", len(documents)),
+		)
+	})
+}
+
+// WithEmbeddingModel sets the embedding model and its output dimensions
+func WithEmbeddingModel(model string, dimensions int) GenerationOption {
+	return GenerationOptionFunc(func(g *Generation) {
+		attrs := []attribute.KeyValue{
+			attribute.String("langfuse.observation.model.name", model),
+		}
+		if dimensions > 0 {
+			attrs = append(attrs, attribute.Int("langfuse.observation.metadata.dimensions", dimensions))
+		}
+		g.span.SetAttributes(attrs...)
+	})
+}
+
+// WithEmbeddingInputs sets the texts that were embedded as the observation input
+func WithEmbeddingInputs(inputs []string) GenerationOption {
+	return GenerationOptionFunc(func(g *Generation) {
+		inputJSON, _ := json.Marshal(inputs)
+		g.span.SetAttributes(
+			attribute.String("langfuse.observation.input", string(inputJSON)),
+			attribute.Int("langfuse.observation.metadata.input_count", len(inputs)),
+		)
+	})
+}
@@ -0,0 +1,114 @@
+package langfuse
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestObservationTypes(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	trace := client.CreateTrace(context.Background(), "types")
+	parent := trace.CreateSpan("parent")
+
+	tests := []struct {
+		name   string
+		create func(name string)
+		want   ObservationType
+	}{
+		{name: "trace agent", create: func(n string) { trace.CreateAgent(n).End() }, want: ObservationTypeAgent},
+		{name: "trace tool", create: func(n string) { trace.CreateTool(n).End() }, want: ObservationTypeTool},
+		{name: "trace chain", create: func(n string) { trace.CreateChain(n).End() }, want: ObservationTypeChain},
+		{name: "trace retriever", create: func(n string) { trace.CreateRetriever(n).End() }, want: ObservationTypeRetriever},
+		{name: "trace evaluator", create: func(n string) { trace.CreateEvaluator(n).End() }, want: ObservationTypeEvaluator},
+		{name: "trace guardrail", create: func(n string) { trace.CreateGuardrail(n).End() }, want: ObservationTypeGuardrail},
+		{name: "trace embedding", create: func(n string) { trace.CreateEmbedding(n).End() }, want: ObservationTypeEmbedding},
+		{name: "span agent", create: func(n string) { parent.CreateAgent(n).End() }, want: ObservationTypeAgent},
+		{name: "span tool", create: func(n string) { parent.CreateTool(n).End() }, want: ObservationTypeTool},
+		{name: "span chain", create: func(n string) { parent.CreateChain(n).End() }, want: ObservationTypeChain},
+		{name: "span retriever", create: func(n string) { parent.CreateRetriever(n).End() }, want: ObservationTypeRetriever},
+		{name: "span evaluator", create: func(n string) { parent.CreateEvaluator(n).End() }, want: ObservationTypeEvaluator},
+		{name: "span guardrail", create: func(n string) { parent.CreateGuardrail(n).End() }, want: ObservationTypeGuardrail},
+		{name: "span embedding", create: func(n string) { parent.CreateEmbedding(n).End() }, want: ObservationTypeEmbedding},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.create(tt.name)
+			span := findSpan(t, exporter, tt.name)
+			if got := stringAttr(span, "langfuse.observation.type"); got != string(tt.want) {
+				t.Errorf("type = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObservationTypeOptions(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	trace := client.CreateTrace(context.Background(), "options")
+	score := 0.9
+
+	tests := []struct {
+		name   string
+		create func(name string)
+		want   map[string]attribute.Value
+	}{
+		{
+			name: "tool",
+			create: func(n string) {
+				trace.CreateTool(n,
+					WithToolName("get_weather"),
+					WithToolCallID("call_1"),
+					WithToolArguments(map[string]string{"city": "Paris"}),
+					WithToolResult("sunny"),
+				).End()
+			},
+			want: map[string]attribute.Value{
+				"langfuse.observation.metadata.tool_name":    attribute.StringValue("get_weather"),
+				"langfuse.observation.metadata.tool_call_id": attribute.StringValue("call_1"),
+				"langfuse.observation.input":                 attribute.StringValue(`{"city":"Paris"}`),
+				"langfuse.observation.output":                attribute.StringValue(`"sunny"`),
+			},
+		},
+		{
+			name: "retriever",
+			create: func(n string) {
+				trace.CreateRetriever(n,
+					WithRetrieverQuery("capital of France"),
+					WithRetrievedDocuments([]RetrievedDocument{{ID: "doc-1", Content: "Paris", Score: &score}}),
+				).End()
+			},
+			want: map[string]attribute.Value{
+				"langfuse.observation.input":                   attribute.StringValue(`"capital of France"`),
+				"langfuse.observation.output":                  attribute.StringValue(`{"documents":[{"id":"doc-1","content":"Paris","score":0.9}]}`),
+				"langfuse.observation.metadata.document_count": attribute.IntValue(1),
+			},
+		},
+		{
+			name: "embedding",
+			create: func(n string) {
+				trace.CreateEmbedding(n,
+					WithEmbeddingModel("text-embedding-3-small", 1536),
+					WithEmbeddingInputs([]string{"a", "b"}),
+				).End()
+			},
+			want: map[string]attribute.Value{
+				"langfuse.observation.model.name":           attribute.StringValue("text-embedding-3-small"),
+				"langfuse.observation.metadata.dimensions":  attribute.IntValue(1536),
+				"langfuse.observation.input":                attribute.StringValue(`["a","b"]`),
+				"langfuse.observation.metadata.input_count": attribute.IntValue(2),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.create(tt.name)
+			attrs := spanAttrs(findSpan(t, exporter, tt.name))
+			for key, want := range tt.want {
+				if got := attrs[attribute.Key(key)]; got != want {
+					t.Errorf("%s = %v, want %v", key, got.Emit(), want.Emit())
+				}
+			}
+		})
+	}
+}
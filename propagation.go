@@ -0,0 +1,150 @@
+package langfuse
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Baggage members carrying trace-level attributes across service boundaries
+const (
+	baggageUserID    = "langfuse_user_id"
+	baggageSessionID = "langfuse_session_id"
+	baggageTags      = "langfuse_tags"
+)
+
+// baggageAttributes maps baggage members to the trace attributes they carry
+var baggageAttributes = map[string]attribute.Key{
+	baggageUserID:    "langfuse.user.id",
+	baggageSessionID: "langfuse.session.id",
+	baggageTags:      "langfuse.trace.tags",
+}
+
+// propagator propagates W3C trace context and baggage
+var propagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// Inject writes the trace context (traceparent, tracestate) and the trace's
+// user ID, session ID and tags (baggage) into carrier, e.g.
+// propagation.HeaderCarrier(req.Header). A downstream service continues the
+// trace with Client.ContinueTrace.
+func (t *Trace) Inject(carrier propagation.TextMapCarrier) {
+	t.inject(t.ctx, carrier)
+}
+
+// Inject writes the trace context with the span as parent into carrier
+func (s *Span) Inject(carrier propagation.TextMapCarrier) {
+	s.trace.inject(s.ctx, carrier)
+}
+
+// Inject writes the trace context with the generation as parent into carrier
+func (g *Generation) Inject(carrier propagation.TextMapCarrier) {
+	g.trace.inject(g.ctx, carrier)
+}
+
+// inject writes the span context of ctx and the trace's baggage into carrier
+func (t *Trace) inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	bag := baggage.FromContext(ctx)
+
+	t.mu.Lock()
+	for _, attr := range t.propagated {
+		for name, key := range baggageAttributes {
+			if attr.Key != key {
+				continue
+			}
+			if member, err := baggage.NewMemberRaw(name, attr.Value.Emit()); err == nil {
+				if updated, err := bag.SetMember(member); err == nil {
+					bag = updated
+				}
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	propagator.Inject(baggage.ContextWithBaggage(ctx, bag), carrier)
+}
+
+// ContinueTrace continues a trace started in another service. It reads the
+// trace context and baggage written by Inject from carrier and creates a trace
+// whose root span is a child of the upstream observation, carrying over the
+// upstream user ID, session ID and tags. Without upstream trace context it
+// behaves like CreateTrace.
+func (c *Client) ContinueTrace(ctx context.Context, carrier propagation.TextMapCarrier, name string, opts ...TraceOption) *Trace {
+	return c.continueTrace(ctx, carrier, name, true, opts)
+}
+
+// continueTrace continues a trace from carrier. Unless trustBaggage is set,
+// the upstream user ID, session ID and tags are removed from the baggage
+// instead of being recorded, so they are not forwarded by Inject either.
+func (c *Client) continueTrace(ctx context.Context, carrier propagation.TextMapCarrier, name string, trustBaggage bool, opts []TraceOption) *Trace {
+	ctx = propagator.Extract(ctx, carrier)
+	if !trustBaggage {
+		bag := baggage.FromContext(ctx)
+		for member := range baggageAttributes {
+			bag = bag.DeleteMember(member)
+		}
+		ctx = baggage.ContextWithBaggage(ctx, bag)
+	}
+
+	var attrs []attribute.KeyValue
+	for _, member := range baggage.FromContext(ctx).Members() {
+		if key, ok := baggageAttributes[member.Key()]; ok {
+			attrs = append(attrs, attribute.String(string(key), member.Value()))
+		}
+	}
+
+	// Upstream attributes go first so explicit options can override them
+	opts = append([]TraceOption{TraceOptionFunc(func(t *Trace) {
+		t.setTraceAttributes(attrs...)
+	})}, opts...)
+
+	return c.CreateTrace(ctx, name, opts...)
+}
+
+// ContinueSpan continues a trace started in another service like
+// ContinueTrace, but records the work in this service as a single span
+// rather than a trace root with the span below it. Trace-level settings are
+// applied with TraceFromContext(span.Context()).Update.
+func (c *Client) ContinueSpan(ctx context.Context, carrier propagation.TextMapCarrier, name string, opts ...SpanOption) *Span {
+	return c.continueSpan(ctx, carrier, name, ObservationTypeSpan, opts)
+}
+
+// ContinueTool is like ContinueSpan but records a tool observation, e.g. for
+// a tool executed on behalf of a remote agent
+func (c *Client) ContinueTool(ctx context.Context, carrier propagation.TextMapCarrier, name string, opts ...SpanOption) *Span {
+	return c.continueSpan(ctx, carrier, name, ObservationTypeTool, opts)
+}
+
+// continueSpan continues a trace with a span-like observation of the given
+// type that is also the root span of the trace
+func (c *Client) continueSpan(ctx context.Context, carrier propagation.TextMapCarrier, name string, obsType ObservationType, opts []SpanOption) *Span {
+	// Options that configure how the span starts apply to the root span
+	var startOpts []TraceOption
+	for _, opt := range opts {
+		if so, ok := opt.(interface {
+			startOption
+			TraceOption
+		}); ok {
+			startOpts = append(startOpts, so)
+		}
+	}
+
+	t := c.ContinueTrace(ctx, carrier, name, startOpts...)
+	t.span.SetAttributes(attribute.String("langfuse.observation.type", string(obsType)))
+
+	s := &Span{
+		trace:     t,
+		span:      t.span,
+		startTime: t.startTime,
+	}
+	s.ctx = context.WithValue(t.ctx, spanContextKey{}, s)
+
+	for _, opt := range opts {
+		opt.applySpan(s)
+	}
+	return s
+}
@@ -0,0 +1,117 @@
+package langfuse
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestInjectContinueTrace(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	upstream := client.CreateTrace(context.Background(), "upstream",
+		WithTraceUserID("user-1"),
+		WithTraceSessionID("session-1"),
+		WithTraceTags([]string{"beta"}),
+	)
+	span := upstream.CreateSpan("call")
+
+	header := http.Header{}
+	span.Inject(propagation.HeaderCarrier(header))
+	if header.Get("traceparent") == "" {
+		t.Fatal("no traceparent injected")
+	}
+	if bag := header.Get("baggage"); !strings.Contains(bag, "langfuse_user_id=user-1") {
+		t.Errorf("baggage = %q", bag)
+	}
+
+	downstream := client.ContinueTrace(context.Background(), propagation.HeaderCarrier(header), "downstream",
+		WithTraceSessionID("session-2"),
+	)
+	downstream.End()
+	span.End()
+	upstream.End()
+
+	recorded := findSpan(t, exporter, "downstream")
+	parent := findSpan(t, exporter, "call")
+	if recorded.SpanContext.TraceID() != parent.SpanContext.TraceID() || recorded.Parent.SpanID() != parent.SpanContext.SpanID() {
+		t.Errorf("downstream is not a child of the injected span")
+	}
+	want := map[string]string{
+		"langfuse.user.id":    "user-1",
+		"langfuse.session.id": "session-2",
+		"langfuse.trace.tags": `["beta"]`,
+	}
+	for key, value := range want {
+		if got := stringAttr(recorded, key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestContinueTraceWithoutContext(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	client.ContinueTrace(context.Background(), propagation.MapCarrier{}, "fresh").End()
+
+	if recorded := findSpan(t, exporter, "fresh"); recorded.Parent.IsValid() {
+		t.Errorf("trace has parent %s, want a new root", recorded.Parent.SpanID())
+	}
+}
+
+func TestContinueSpan(t *testing.T) {
+	tests := []struct {
+		name  string
+		start func(*Client, propagation.TextMapCarrier) *Span
+		want  ObservationType
+	}{
+		{
+			name: "span",
+			start: func(c *Client, carrier propagation.TextMapCarrier) *Span {
+				return c.ContinueSpan(context.Background(), carrier, "remote", WithSpanInput("in"))
+			},
+			want: ObservationTypeSpan,
+		},
+		{
+			name: "tool",
+			start: func(c *Client, carrier propagation.TextMapCarrier) *Span {
+				return c.ContinueTool(context.Background(), carrier, "remote", WithSpanInput("in"))
+			},
+			want: ObservationTypeTool,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, exporter := newTestClient(t, Config{})
+			upstream := client.CreateTrace(context.Background(), "upstream", WithTraceUserID("user-1"))
+			carrier := propagation.MapCarrier{}
+			upstream.Inject(carrier)
+
+			span := tt.start(client, carrier)
+			if TraceFromContext(span.Context()) == nil {
+				t.Fatal("span context carries no trace")
+			}
+			span.End()
+			upstream.End()
+
+			if got := len(exporter.GetSpans()); got != 2 {
+				t.Fatalf("got %d spans, want the upstream trace and a single remote observation", got)
+			}
+			recorded := findSpan(t, exporter, "remote")
+			if recorded.Parent.SpanID() != findSpan(t, exporter, "upstream").SpanContext.SpanID() {
+				t.Error("remote observation is not a child of the upstream trace")
+			}
+			checks := map[string]string{
+				"langfuse.observation.type":  string(tt.want),
+				"langfuse.observation.input": `"in"`,
+				"langfuse.user.id":           "user-1",
+			}
+			for key, want := range checks {
+				if got := stringAttr(recorded, key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
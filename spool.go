@@ -0,0 +1,509 @@
+package langfuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// SpoolSyncPolicy controls when spool segments are flushed to stable storage
+type SpoolSyncPolicy int
+
+const (
+	// SpoolSyncAlways fsyncs every segment before it is exported, so spans
+	// survive a crash of the machine
+	SpoolSyncAlways SpoolSyncPolicy = iota
+	// SpoolSyncNever leaves flushing to the operating system, so spans
+	// survive a crash of the process but not of the machine
+	SpoolSyncNever
+)
+
+// SpoolConfig configures a durable export queue on disk. Spans are written to
+// segment files in Dir before they are exported and deleted once Langfuse
+// accepts them. Segments whose export fails are replayed periodically,
+// when exports succeed again and when a client is created with the same Dir.
+// A client locks Dir until it is closed, so a second client with the same
+// Dir fails to start.
+type SpoolConfig struct {
+	Dir            string          // Required, created if missing
+	MaxBytes       int64           // Optional, defaults to 100 MiB; oldest segments are dropped beyond it
+	MaxAge         time.Duration   // Optional, defaults to 24 hours; older segments are dropped
+	Sync           SpoolSyncPolicy // Optional, defaults to SpoolSyncAlways
+	ReplayInterval time.Duration   // Optional, defaults to 30 seconds
+}
+
+// SpoolStats counts spans that went through the spool since the client was
+// created
+type SpoolStats struct {
+	Spooled  int64 // Spans kept on disk after their export failed
+	Replayed int64 // Spooled spans exported later
+	Dropped  int64 // Spooled spans deleted because of MaxBytes, MaxAge, corruption or rejection by Langfuse
+
+	PendingSpans int64 // Spans on disk waiting to be exported
+	PendingBytes int64 // Size of the segments waiting to be exported
+}
+
+// Spool defaults
+const (
+	defaultSpoolMaxBytes       = 100 << 20
+	defaultSpoolMaxAge         = 24 * time.Hour
+	defaultSpoolReplayInterval = 30 * time.Second
+)
+
+// spoolSegmentExt is the file extension of spool segments
+const spoolSegmentExt = ".otlp"
+
+// spoolLockFile is locked by the client that owns a spool directory
+const spoolLockFile = "lock"
+
+// validate checks the spool configuration and fills in defaults
+func (c *SpoolConfig) validate() error {
+	if c.Dir == "" {
+		return fmt.Errorf("spool directory is required")
+	}
+	if c.MaxBytes < 0 || c.MaxAge < 0 || c.ReplayInterval < 0 {
+		return fmt.Errorf("spool limits must not be negative")
+	}
+	if c.Sync != SpoolSyncAlways && c.Sync != SpoolSyncNever {
+		return fmt.Errorf("invalid spool sync policy %d", c.Sync)
+	}
+	if c.MaxBytes == 0 {
+		c.MaxBytes = defaultSpoolMaxBytes
+	}
+	if c.MaxAge == 0 {
+		c.MaxAge = defaultSpoolMaxAge
+	}
+	if c.ReplayInterval == 0 {
+		c.ReplayInterval = defaultSpoolReplayInterval
+	}
+	return nil
+}
+
+// spoolSegment is a batch of spans on disk. Its file name records when it was
+// written and how many spans it holds, e.g. 1729260000000000000-000001-128.otlp.
+type spoolSegment struct {
+	path    string
+	created time.Time
+	spans   int64
+	size    int64
+}
+
+// spoolClient is an otlptrace.Client that writes batches to disk before
+// uploading them with the wrapped client
+type spoolClient struct {
+	otlptrace.Client
+	config SpoolConfig
+	lock   *os.File
+
+	mu       sync.Mutex
+	segments []spoolSegment // pending segments, oldest first
+	seq      uint64
+
+	spooled  atomic.Int64
+	replayed atomic.Int64
+	dropped  atomic.Int64
+
+	replay chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newSpoolClient creates and locks the spool directory and loads segments
+// left by a previous client
+func newSpoolClient(client otlptrace.Client, config SpoolConfig) (*spoolClient, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(config.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	lock, err := lockSpoolDir(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &spoolClient{
+		Client: client,
+		config: config,
+		lock:   lock,
+		replay: make(chan struct{}, 1),
+	}
+	if err := s.load(); err != nil {
+		s.unlock()
+		return nil, err
+	}
+	return s, nil
+}
+
+// unlock releases the spool directory for other clients
+func (s *spoolClient) unlock() {
+	_ = s.lock.Close()
+}
+
+// load scans the spool directory for segments. Unfinished writes are removed.
+func (s *spoolClient) load() error {
+	entries, err := os.ReadDir(s.config.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to read spool directory: %w", err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(s.config.Dir, entry.Name())
+		if strings.HasSuffix(entry.Name(), spoolSegmentExt+".tmp") {
+			_ = os.Remove(path)
+			continue
+		}
+		segment, ok := parseSegmentName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		segment.path, segment.size = path, info.Size()
+		s.segments = append(s.segments, segment)
+	}
+	sortSegments(s.segments)
+	return nil
+}
+
+// sortSegments orders segments oldest first by creation time and, for
+// segments created at the same time, by the sequence number in their name
+func sortSegments(segments []spoolSegment) {
+	sort.SliceStable(segments, func(i, j int) bool {
+		if !segments[i].created.Equal(segments[j].created) {
+			return segments[i].created.Before(segments[j].created)
+		}
+		return segments[i].path < segments[j].path
+	})
+}
+
+// parseSegmentName reads the creation time and span count from a segment
+// file name
+func parseSegmentName(name string) (spoolSegment, bool) {
+	base, ok := strings.CutSuffix(name, spoolSegmentExt)
+	if !ok {
+		return spoolSegment{}, false
+	}
+	parts := strings.Split(base, "-")
+	if len(parts) != 3 {
+		return spoolSegment{}, false
+	}
+	nanos, err1 := strconv.ParseInt(parts[0], 10, 64)
+	spans, err2 := strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil {
+		return spoolSegment{}, false
+	}
+	return spoolSegment{created: time.Unix(0, nanos), spans: spans}, true
+}
+
+// Start starts the wrapped client and replays pending segments in the
+// background
+func (s *spoolClient) Start(ctx context.Context) error {
+	if err := s.Client.Start(ctx); err != nil {
+		return err
+	}
+	loopCtx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go s.replayLoop(loopCtx)
+	s.triggerReplay()
+	return nil
+}
+
+// Stop stops replaying and the wrapped client and releases the spool
+// directory. Pending segments stay on disk for the next client.
+func (s *spoolClient) Stop(ctx context.Context) error {
+	// The directory is released and the wrapped client stopped even if the
+	// replay loop does not finish in time
+	defer s.unlock()
+	var err error
+	if s.cancel != nil {
+		s.cancel()
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	return errors.Join(err, s.Client.Stop(ctx))
+}
+
+// UploadTraces writes the spans to a segment and uploads them. A failed upload
+// leaves the segment on disk for replay and is not reported as an error, as
+// the spans are not lost. Spans rejected by Langfuse are not spooled, as a
+// replay would be rejected as well.
+func (s *spoolClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	segment, err := s.write(protoSpans)
+	if err != nil {
+		// Without a segment the spans can only be exported directly
+		return s.Client.UploadTraces(ctx, protoSpans)
+	}
+
+	if err := s.Client.UploadTraces(ctx, protoSpans); err != nil {
+		if rejectedUpload(err) {
+			_ = os.Remove(segment.path)
+			return err
+		}
+		s.mu.Lock()
+		s.segments = append(s.segments, segment)
+		s.mu.Unlock()
+		s.spooled.Add(segment.spans)
+		s.enforceLimits()
+		return nil
+	}
+
+	_ = os.Remove(segment.path)
+	if s.pending() > 0 {
+		s.triggerReplay()
+	}
+	return nil
+}
+
+// write stores spans in a new segment. The segment is only added to the
+// pending segments once its upload fails, so it is not replayed meanwhile.
+func (s *spoolClient) write(protoSpans []*tracepb.ResourceSpans) (spoolSegment, error) {
+	data, err := proto.Marshal(&tracepb.TracesData{ResourceSpans: protoSpans})
+	if err != nil {
+		return spoolSegment{}, err
+	}
+
+	var spans int64
+	for _, rs := range protoSpans {
+		for _, ss := range rs.GetScopeSpans() {
+			spans += int64(len(ss.GetSpans()))
+		}
+	}
+
+	s.mu.Lock()
+	s.seq++
+	seq := s.seq
+	s.mu.Unlock()
+
+	created := time.Now()
+	name := fmt.Sprintf("%019d-%06d-%d%s", created.UnixNano(), seq%1000000, spans, spoolSegmentExt)
+	segment := spoolSegment{
+		path:    filepath.Join(s.config.Dir, name),
+		created: created,
+		spans:   spans,
+		size:    int64(len(data)),
+	}
+
+	// Segments are written under a temporary name and renamed once complete,
+	// so a crash never leaves a partial segment behind
+	tmp := segment.path + ".tmp"
+	if err := s.writeFile(tmp, data); err != nil {
+		_ = os.Remove(tmp)
+		return spoolSegment{}, err
+	}
+	if err := os.Rename(tmp, segment.path); err != nil {
+		_ = os.Remove(tmp)
+		return spoolSegment{}, err
+	}
+	if s.config.Sync == SpoolSyncAlways {
+		syncDir(s.config.Dir)
+	}
+	return segment, nil
+}
+
+// writeFile writes data to path, syncing it according to the sync policy
+func (s *spoolClient) writeFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if s.config.Sync == SpoolSyncAlways {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// syncDir flushes a directory, making renames within it durable. Errors are
+// ignored as not every platform supports syncing directories.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+}
+
+// remove deletes a pending segment. It reports false if the segment was
+// already removed.
+func (s *spoolClient) remove(segment spoolSegment) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, pending := range s.segments {
+		if pending.path == segment.path {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			_ = os.Remove(segment.path)
+			return true
+		}
+	}
+	return false
+}
+
+// drop deletes a pending segment whose spans will not be exported
+func (s *spoolClient) drop(segment spoolSegment) {
+	if s.remove(segment) {
+		s.dropped.Add(segment.spans)
+	}
+}
+
+// pending returns the number of segments waiting to be exported
+func (s *spoolClient) pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.segments)
+}
+
+// enforceLimits drops segments older than MaxAge and the oldest segments
+// while the spool exceeds MaxBytes. Failed uploads finish in any order, so the
+// pending segments are sorted before the oldest are picked.
+func (s *spoolClient) enforceLimits() {
+	s.mu.Lock()
+	sortSegments(s.segments)
+	var total int64
+	for _, segment := range s.segments {
+		total += segment.size
+	}
+	cutoff := time.Now().Add(-s.config.MaxAge)
+	var expired []spoolSegment
+	for _, segment := range s.segments {
+		if !segment.created.Before(cutoff) && total <= s.config.MaxBytes {
+			break
+		}
+		expired = append(expired, segment)
+		total -= segment.size
+	}
+	s.mu.Unlock()
+
+	for _, segment := range expired {
+		s.drop(segment)
+	}
+}
+
+// triggerReplay asks the replay loop to export pending segments now
+func (s *spoolClient) triggerReplay() {
+	select {
+	case s.replay <- struct{}{}:
+	default:
+	}
+}
+
+// replayLoop exports pending segments every ReplayInterval and on request
+func (s *spoolClient) replayLoop(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(s.config.ReplayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.replay:
+		}
+		s.enforceLimits()
+		s.replayPending(ctx)
+	}
+}
+
+// replayPending exports pending segments oldest first, stopping at the first
+// failed upload. Segments that cannot be read or are rejected by Langfuse are
+// dropped, so they do not hold up the segments behind them.
+func (s *spoolClient) replayPending(ctx context.Context) {
+	s.mu.Lock()
+	segments := append([]spoolSegment(nil), s.segments...)
+	s.mu.Unlock()
+
+	for _, segment := range segments {
+		if ctx.Err() != nil {
+			return
+		}
+		data, err := os.ReadFile(segment.path)
+		if errors.Is(err, os.ErrNotExist) {
+			// Removed by enforceLimits in the meantime
+			continue
+		}
+		var traces tracepb.TracesData
+		if err != nil || proto.Unmarshal(data, &traces) != nil {
+			s.drop(segment)
+			continue
+		}
+		if err := s.Client.UploadTraces(ctx, traces.GetResourceSpans()); err != nil {
+			if rejectedUpload(err) {
+				s.drop(segment)
+				continue
+			}
+			return
+		}
+		if s.remove(segment) {
+			s.replayed.Add(segment.spans)
+		}
+	}
+}
+
+// rejectedUpload reports whether an upload failed with a client error that
+// retrying the same spans cannot fix, such as 400 Bad Request. The OTLP
+// exporter only reports the status of such non-retryable responses in its
+// error message, as "failed to send to <url>: <status> (body: ...)".
+// Timeouts and throttling are retried like server and network errors.
+func rejectedUpload(err error) bool {
+	const prefix = "failed to send to "
+	msg := err.Error()
+	if !strings.HasPrefix(msg, prefix) {
+		return false
+	}
+	i := strings.Index(msg, ": ")
+	if i < 0 || len(msg) < i+5 {
+		return false
+	}
+	code, convErr := strconv.Atoi(msg[i+2 : i+5])
+	if convErr != nil {
+		return false
+	}
+	return code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+}
+
+// stats returns the spool counters and the pending segments
+func (s *spoolClient) stats() SpoolStats {
+	stats := SpoolStats{
+		Spooled:  s.spooled.Load(),
+		Replayed: s.replayed.Load(),
+		Dropped:  s.dropped.Load(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, segment := range s.segments {
+		stats.PendingSpans += segment.spans
+		stats.PendingBytes += segment.size
+	}
+	return stats
+}
+
+// SpoolStats returns the counters of the export spool. It returns zero stats
+// if Config.Spool is not set.
+func (c *Client) SpoolStats() SpoolStats {
+	if c.spool == nil {
+		return SpoolStats{}
+	}
+	return c.spool.stats()
+}
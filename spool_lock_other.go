@@ -0,0 +1,19 @@
+//go:build !unix
+
+package langfuse
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lockSpoolDir opens the lock file of a spool directory. File locks are only
+// taken on Unix, so elsewhere a shared directory is not detected.
+func lockSpoolDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, spoolLockFile), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool lock file: %w", err)
+	}
+	return f, nil
+}
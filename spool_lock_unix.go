@@ -0,0 +1,29 @@
+//go:build unix
+
+package langfuse
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockSpoolDir takes an exclusive lock on the lock file of a spool directory,
+// so two clients cannot replay and delete each other's segments. The lock is
+// released when the file is closed, including when the process dies.
+func lockSpoolDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, spoolLockFile), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool lock file: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("spool directory %s is in use by another client", dir)
+		}
+		return nil, fmt.Errorf("failed to lock spool directory: %w", err)
+	}
+	return f, nil
+}
@@ -0,0 +1,75 @@
+//go:build unix
+
+package langfuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpoolLock(t *testing.T) {
+	config := SpoolConfig{Dir: t.TempDir(), ReplayInterval: time.Hour}
+	first, err := newSpoolClient(&fakeOTLPClient{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newSpoolClient(&fakeOTLPClient{}, config); err == nil || !strings.Contains(err.Error(), "in use by another client") {
+		t.Fatalf("got error %v for a locked directory", err)
+	}
+	_, err = NewClient(Config{PublicKey: "pk-lf-test", SecretKey: "sk-lf-test", BaseURL: "http://127.0.0.1:1", Spool: &config})
+	if err == nil || !strings.Contains(err.Error(), "in use by another client") {
+		t.Fatalf("NewClient: got error %v for a locked directory", err)
+	}
+
+	if err := first.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	second, err := newSpoolClient(&fakeOTLPClient{}, config)
+	if err != nil {
+		t.Fatalf("directory still locked after Stop: %v", err)
+	}
+	second.unlock()
+}
+
+func TestSpoolStopTimeout(t *testing.T) {
+	config := SpoolConfig{Dir: t.TempDir(), ReplayInterval: time.Hour}
+	segment := fmt.Sprintf("%019d-000001-1%s", time.Now().UnixNano(), spoolSegmentExt)
+	if err := os.WriteFile(filepath.Join(config.Dir, segment), mustMarshalTraces(t, protoSpans("a")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	upstream := &fakeOTLPClient{block: make(chan struct{})}
+	defer close(upstream.block)
+	spool, err := newSpoolClient(upstream, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := spool.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "replay", func() bool { return upstream.calls.Load() > 0 })
+
+	// The replay loop is stuck in an upload, so Stop times out
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := spool.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Stop = %v, want the deadline error", err)
+	}
+	if !upstream.stopped.Load() {
+		t.Error("wrapped client not stopped")
+	}
+	second, err := newSpoolClient(&fakeOTLPClient{}, config)
+	if err != nil {
+		t.Fatalf("directory still locked after Stop: %v", err)
+	}
+	second.unlock()
+}
@@ -0,0 +1,472 @@
+package langfuse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeOTLPClient records uploaded span names and fails uploads while failing
+// is set. Uploads containing the span named by reject are rejected with a
+// client error. Uploads wait for block to be closed if it is set.
+type fakeOTLPClient struct {
+	failing atomic.Bool
+	stopped atomic.Bool
+	block   chan struct{}
+	calls   atomic.Int64
+	reject  string
+
+	mu       sync.Mutex
+	uploaded []string
+}
+
+func (c *fakeOTLPClient) Start(context.Context) error { return nil }
+
+func (c *fakeOTLPClient) Stop(context.Context) error {
+	c.stopped.Store(true)
+	return nil
+}
+
+func (c *fakeOTLPClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	c.calls.Add(1)
+	if c.block != nil {
+		<-c.block
+	}
+	if c.failing.Load() {
+		return errors.New("langfuse unavailable")
+	}
+	for _, rs := range protoSpans {
+		for _, ss := range rs.GetScopeSpans() {
+			for _, span := range ss.GetSpans() {
+				if c.reject != "" && span.GetName() == c.reject {
+					return errors.New("failed to send to https://cloud.langfuse.com/api/public/otel/v1/traces: 400 Bad Request (body: invalid span)")
+				}
+			}
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range protoSpans {
+		for _, ss := range rs.GetScopeSpans() {
+			for _, span := range ss.GetSpans() {
+				c.uploaded = append(c.uploaded, span.GetName())
+			}
+		}
+	}
+	return nil
+}
+
+func (c *fakeOTLPClient) names() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return strings.Join(c.uploaded, ",")
+}
+
+// protoSpans returns a batch of spans with the given names
+func protoSpans(names ...string) []*tracepb.ResourceSpans {
+	scope := &tracepb.ScopeSpans{}
+	for _, name := range names {
+		scope.Spans = append(scope.Spans, &tracepb.Span{Name: name})
+	}
+	return []*tracepb.ResourceSpans{{ScopeSpans: []*tracepb.ScopeSpans{scope}}}
+}
+
+// mustMarshalTraces returns the encoding of spans in a segment
+func mustMarshalTraces(t *testing.T, protoSpans []*tracepb.ResourceSpans) []byte {
+	t.Helper()
+	data, err := proto.Marshal(&tracepb.TracesData{ResourceSpans: protoSpans})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// segmentFiles lists the segment files in a spool directory
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// startSpool starts a spool client over upstream and stops it when the test
+// ends
+func startSpool(t *testing.T, upstream *fakeOTLPClient, config SpoolConfig) *spoolClient {
+	t.Helper()
+	spool, err := newSpoolClient(upstream, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := spool.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = spool.Stop(context.Background()) })
+	return spool
+}
+
+func TestSpoolConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  SpoolConfig
+		want    SpoolConfig
+		wantErr string
+	}{
+		{
+			name:   "defaults",
+			config: SpoolConfig{Dir: "spool"},
+			want:   SpoolConfig{Dir: "spool", MaxBytes: defaultSpoolMaxBytes, MaxAge: defaultSpoolMaxAge, ReplayInterval: defaultSpoolReplayInterval},
+		},
+		{
+			name:   "explicit",
+			config: SpoolConfig{Dir: "spool", MaxBytes: 1, MaxAge: time.Minute, Sync: SpoolSyncNever, ReplayInterval: time.Second},
+			want:   SpoolConfig{Dir: "spool", MaxBytes: 1, MaxAge: time.Minute, Sync: SpoolSyncNever, ReplayInterval: time.Second},
+		},
+		{name: "no directory", config: SpoolConfig{}, wantErr: "spool directory is required"},
+		{name: "negative limit", config: SpoolConfig{Dir: "spool", MaxAge: -time.Second}, wantErr: "must not be negative"},
+		{name: "unknown sync policy", config: SpoolConfig{Dir: "spool", Sync: 7}, wantErr: "invalid spool sync policy 7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			err := config.validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config != tt.want {
+				t.Errorf("config = %+v, want %+v", config, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSegmentName(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		spans int64
+		ok    bool
+	}{
+		{"segment", "1729260000000000000-000001-128.otlp", 128, true},
+		{"temporary", "1729260000000000000-000001-128.otlp.tmp", 0, false},
+		{"lock", spoolLockFile, 0, false},
+		{"missing part", "1729260000000000000-128.otlp", 0, false},
+		{"not a number", "yesterday-000001-128.otlp", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segment, ok := parseSegmentName(tt.file)
+			if ok != tt.ok || segment.spans != tt.spans {
+				t.Errorf("got %d spans, %v, want %d, %v", segment.spans, ok, tt.spans, tt.ok)
+			}
+			if ok && !segment.created.Equal(time.Unix(0, 1729260000000000000)) {
+				t.Errorf("created = %v", segment.created)
+			}
+		})
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+	policies := map[string]SpoolSyncPolicy{"sync always": SpoolSyncAlways, "sync never": SpoolSyncNever}
+	for name, sync := range policies {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			upstream := &fakeOTLPClient{}
+			upstream.failing.Store(true)
+			spool := startSpool(t, upstream, SpoolConfig{Dir: dir, Sync: sync, ReplayInterval: time.Hour})
+
+			if err := spool.UploadTraces(context.Background(), protoSpans("a", "b")); err != nil {
+				t.Fatalf("a failed upload was reported: %v", err)
+			}
+			if files := segmentFiles(t, dir); len(files) != 1 {
+				t.Fatalf("got %d segments on disk, want 1", len(files))
+			}
+			stats := spool.stats()
+			if stats.Spooled != 2 || stats.PendingSpans != 2 || stats.PendingBytes == 0 {
+				t.Errorf("stats = %+v", stats)
+			}
+
+			// The next successful export replays the pending segment
+			upstream.failing.Store(false)
+			if err := spool.UploadTraces(context.Background(), protoSpans("c")); err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, "replay", func() bool { return spool.pending() == 0 })
+
+			if got := upstream.names(); got != "c,a,b" {
+				t.Errorf("uploaded %s, want c,a,b", got)
+			}
+			if files := segmentFiles(t, dir); len(files) != 0 {
+				t.Errorf("segments left on disk: %v", files)
+			}
+			if stats := spool.stats(); stats.Replayed != 2 || stats.PendingSpans != 0 {
+				t.Errorf("stats = %+v", stats)
+			}
+		})
+	}
+}
+
+func TestSpoolReplaysAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	upstream := &fakeOTLPClient{}
+	upstream.failing.Store(true)
+
+	spool, err := newSpoolClient(upstream, SpoolConfig{Dir: dir, ReplayInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := spool.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := spool.UploadTraces(context.Background(), protoSpans("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := spool.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A write interrupted by a crash and unrelated files
+	tmp := filepath.Join(dir, "1729260000000000000-000009-1.otlp.tmp")
+	for _, name := range []string{tmp, filepath.Join(dir, "notes.txt")} {
+		if err := os.WriteFile(name, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	upstream.failing.Store(false)
+	restarted := startSpool(t, upstream, SpoolConfig{Dir: dir, ReplayInterval: time.Hour})
+	waitFor(t, "replay", func() bool { return restarted.pending() == 0 })
+
+	if got := upstream.names(); got != "a" {
+		t.Errorf("uploaded %s, want a", got)
+	}
+	if _, err := os.Stat(tmp); !errors.Is(err, os.ErrNotExist) {
+		t.Error("the unfinished segment was not removed")
+	}
+	if stats := restarted.stats(); stats.Replayed != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestSpoolLimits(t *testing.T) {
+	dir := t.TempDir()
+	upstream := &fakeOTLPClient{}
+	upstream.failing.Store(true)
+
+	// A segment left by a previous client beyond MaxAge
+	old := fmt.Sprintf("%019d-000001-3%s", time.Now().Add(-2*time.Hour).UnixNano(), spoolSegmentExt)
+	if err := os.WriteFile(filepath.Join(dir, old), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	segmentSize := int64(len(mustMarshalTraces(t, protoSpans("a"))))
+	spool := startSpool(t, upstream, SpoolConfig{Dir: dir, MaxAge: time.Hour, MaxBytes: 2 * segmentSize, ReplayInterval: time.Hour})
+	waitFor(t, "expired segment", func() bool { return spool.pending() == 0 })
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := spool.UploadTraces(context.Background(), protoSpans(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := spool.stats()
+	if stats.Dropped != 4 || stats.Spooled != 3 || stats.PendingSpans != 2 || stats.PendingBytes > 2*segmentSize {
+		t.Errorf("stats = %+v, want the old segment and the oldest span dropped", stats)
+	}
+	if files := segmentFiles(t, dir); len(files) != 2 {
+		t.Errorf("got %d segments on disk, want 2", len(files))
+	}
+
+	upstream.failing.Store(false)
+	spool.triggerReplay()
+	waitFor(t, "replay", func() bool { return spool.pending() == 0 })
+	if got := upstream.names(); got != "b,c" {
+		t.Errorf("uploaded %s, want b,c", got)
+	}
+}
+
+func TestSpoolLimitsDropOldestFirst(t *testing.T) {
+	segmentSize := int64(len(mustMarshalTraces(t, protoSpans("a"))))
+	spool, err := newSpoolClient(&fakeOTLPClient{}, SpoolConfig{Dir: t.TempDir(), MaxBytes: 2 * segmentSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.unlock()
+
+	var written []spoolSegment
+	for _, name := range []string{"a", "b", "c"} {
+		segment, err := spool.write(protoSpans(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		written = append(written, segment)
+	}
+	// Concurrent uploads fail in any order
+	spool.segments = []spoolSegment{written[2], written[0], written[1]}
+	spool.enforceLimits()
+
+	if len(spool.segments) != 2 || spool.segments[0].path != written[1].path || spool.segments[1].path != written[2].path {
+		t.Errorf("pending = %+v, want the oldest segment dropped", spool.segments)
+	}
+}
+
+func TestSpoolDropsCorruptSegments(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := fmt.Sprintf("%019d-000001-5%s", time.Now().UnixNano(), spoolSegmentExt)
+	if err := os.WriteFile(filepath.Join(dir, corrupt), []byte("not protobuf \xff\xff"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := &fakeOTLPClient{}
+	spool := startSpool(t, upstream, SpoolConfig{Dir: dir, ReplayInterval: time.Hour})
+	waitFor(t, "corrupt segment", func() bool { return spool.pending() == 0 })
+
+	if stats := spool.stats(); stats.Dropped != 5 || stats.Replayed != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if got := upstream.names(); got != "" {
+		t.Errorf("uploaded %s", got)
+	}
+}
+
+func TestSpoolDropsRejectedSegments(t *testing.T) {
+	dir := t.TempDir()
+	upstream := &fakeOTLPClient{reject: "bad"}
+	upstream.failing.Store(true)
+	spool := startSpool(t, upstream, SpoolConfig{Dir: dir, ReplayInterval: time.Hour})
+
+	for _, name := range []string{"bad", "good"} {
+		if err := spool.UploadTraces(context.Background(), protoSpans(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The rejected segment in front does not hold up the one behind it
+	upstream.failing.Store(false)
+	spool.triggerReplay()
+	waitFor(t, "replay", func() bool { return spool.pending() == 0 })
+
+	if got := upstream.names(); got != "good" {
+		t.Errorf("uploaded %s, want good", got)
+	}
+	if stats := spool.stats(); stats.Dropped != 1 || stats.Replayed != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if files := segmentFiles(t, dir); len(files) != 0 {
+		t.Errorf("segments left on disk: %v", files)
+	}
+
+	// A rejected upload is reported instead of spooled
+	if err := spool.UploadTraces(context.Background(), protoSpans("bad")); err == nil {
+		t.Error("a rejected upload was not reported")
+	}
+	if spool.pending() != 0 {
+		t.Error("a rejected upload was spooled")
+	}
+}
+
+func TestRejectedUpload(t *testing.T) {
+	url := "https://cloud.langfuse.com/api/public/otel/v1/traces"
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: fmt.Errorf("failed to send to %s: 400 Bad Request (body: invalid)", url), want: true},
+		{err: fmt.Errorf("failed to send to %s: 413 Request Entity Too Large (body: (empty))", url), want: true},
+		{err: fmt.Errorf("failed to send to %s: 429 Too Many Requests (body: (empty))", url)},
+		{err: fmt.Errorf("failed to send to %s: 500 Internal Server Error (body: (empty))", url)},
+		{err: errors.New("max retry time elapsed: retry-able request failure: body: (empty)")},
+		{err: errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if got := rejectedUpload(tt.err); got != tt.want {
+				t.Errorf("rejectedUpload = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientSpool(t *testing.T) {
+	var available atomic.Bool
+	var exported atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Server errors are not retried by the exporter, so they are spooled
+		// at once
+		if !available.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		exported.Add(1)
+	}))
+	defer server.Close()
+
+	config := Config{
+		PublicKey: "pk-lf-test",
+		SecretKey: "sk-lf-test",
+		BaseURL:   server.URL,
+		Spool:     &SpoolConfig{Dir: t.TempDir(), ReplayInterval: time.Hour},
+	}
+
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.CreateTrace(context.Background(), "during outage").End()
+	if err := client.Close(context.Background()); err != nil {
+		t.Fatalf("a spooled export was reported as failed: %v", err)
+	}
+	if stats := client.SpoolStats(); stats.Spooled != 1 || stats.PendingSpans != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	available.Store(true)
+	restarted, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close(context.Background())
+	waitFor(t, "replay", func() bool { return restarted.SpoolStats().Replayed == 1 })
+	if exported.Load() != 1 {
+		t.Errorf("got %d exports, want 1", exported.Load())
+	}
+}
+
+func TestSpoolStatsWithoutSpool(t *testing.T) {
+	client, _ := newTestClient(t, Config{})
+	if stats := client.SpoolStats(); stats != (SpoolStats{}) {
+		t.Errorf("stats = %+v, want zero", stats)
+	}
+}
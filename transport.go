@@ -0,0 +1,478 @@
+package langfuse
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxErrorBodySize bounds the part of an error response recorded as status message
+const maxErrorBodySize = 4 * 1024
+
+// Provider identifies an LLM API recognized by RoundTripper
+type Provider string
+
+const (
+	ProviderOpenAI    Provider = "openai"
+	ProviderAnthropic Provider = "anthropic"
+	ProviderGemini    Provider = "gemini"
+	ProviderOllama    Provider = "ollama"
+)
+
+// RoundTripper is an http.RoundTripper that records calls to LLM APIs as
+// generations under the observation carried by the request context. Requests
+// to other endpoints are passed through unchanged.
+//
+//	httpClient := &http.Client{Transport: langfuse.NewRoundTripper(client, nil)}
+//
+// By default only the public hosts of the supported APIs are recognized, so a
+// general-purpose HTTP client can be wrapped without recording unrelated
+// traffic. Use WithProviders for self-hosted or OpenAI-compatible endpoints.
+type RoundTripper struct {
+	client *Client
+	base   http.RoundTripper
+	apis   []llmAPI
+
+	// anyHost is set when the APIs are recognized on any host
+	anyHost bool
+
+	params ParamsFunc
+	cost   CostFunc
+}
+
+// ParamsFunc extracts the model parameters of a request from its body. It
+// reports false to keep the parameters parsed by the RoundTripper.
+type ParamsFunc func(req *http.Request, body []byte) (GenerationParams, bool)
+
+// CostFunc computes the cost of a call from the model and usage details
+// reported by the API. It reports false when the cost is unknown.
+type CostFunc func(model string, usage map[string]int) (Cost, bool)
+
+// RoundTripperOption defines options for RoundTripper creation
+type RoundTripperOption func(*RoundTripper)
+
+// WithProviders restricts the RoundTripper to the given APIs and recognizes
+// their endpoints on any host, e.g. Azure OpenAI deployments, vLLM, LiteLLM or
+// a remote Ollama server. By default all supported APIs are recognized on
+// their public hosts only: api.openai.com and *.openai.azure.com,
+// api.anthropic.com, generativelanguage.googleapis.com and Vertex AI, and
+// Ollama on its default port 11434.
+func WithProviders(providers ...Provider) RoundTripperOption {
+	return func(rt *RoundTripper) {
+		rt.anyHost = true
+		var apis []llmAPI
+		for _, api := range rt.apis {
+			for _, p := range providers {
+				if api.provider() == p {
+					apis = append(apis, api)
+				}
+			}
+		}
+		rt.apis = apis
+	}
+}
+
+// WithParams replaces the generic parameter parsing with fn, e.g. to decode
+// the request into the typed parameters of an SDK
+func WithParams(fn ParamsFunc) RoundTripperOption {
+	return func(rt *RoundTripper) {
+		rt.params = fn
+	}
+}
+
+// WithCost records the cost computed by fn on every generation with usage
+func WithCost(fn CostFunc) RoundTripperOption {
+	return func(rt *RoundTripper) {
+		rt.cost = fn
+	}
+}
+
+// NewRoundTripper wraps base, or http.DefaultTransport if base is nil, with
+// Langfuse instrumentation
+func NewRoundTripper(client *Client, base http.RoundTripper, opts ...RoundTripperOption) *RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	rt := &RoundTripper{
+		client: client,
+		base:   base,
+		apis: []llmAPI{
+			openAIAPI{},
+			anthropicAPI{},
+			geminiAPI{},
+			ollamaAPI{},
+		},
+	}
+
+	for _, opt := range opts {
+		opt(rt)
+	}
+
+	return rt
+}
+
+// llmAPI parses the requests and responses of one LLM API
+type llmAPI interface {
+	provider() Provider
+
+	// match reports whether the request targets the API and returns the endpoint
+	match(req *http.Request) (endpoint string, ok bool)
+
+	// knownHost reports whether u points to a public host of the API
+	knownHost(u *url.URL) bool
+
+	parseRequest(req *http.Request, endpoint string, body []byte) (llmCall, error)
+	parseResponse(endpoint string, body []byte) (llmResult, error)
+	newStream(endpoint string, call llmCall) llmStream
+}
+
+// llmCall holds what was parsed from an LLM API request
+type llmCall struct {
+	name     string
+	obsType  ObservationType
+	model    string
+	params   GenerationParams
+	input    interface{}
+	metadata map[string]string
+}
+
+// llmResult holds what was parsed from an LLM API response
+type llmResult struct {
+	model    string
+	output   interface{}
+	usage    map[string]int
+	metadata map[string]string
+}
+
+// llmStream accumulates a streaming response
+type llmStream interface {
+	// event handles one server-sent event or NDJSON line and reports whether
+	// it carried generated content
+	event(eventType string, data []byte) bool
+	result() llmResult
+}
+
+// RoundTrip implements http.RoundTripper
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rt.Middleware(req, rt.base.RoundTrip)
+}
+
+// Middleware records the request like RoundTrip but sends it with next
+// instead of the base transport. Its signature matches the request middleware
+// of the official OpenAI and Anthropic Go SDKs, e.g.
+//
+//	openai.NewClient(option.WithMiddleware(rt.Middleware))
+func (rt *RoundTripper) Middleware(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if req.Method != http.MethodPost || req.Body == nil {
+		return next(req)
+	}
+
+	var api llmAPI
+	var endpoint string
+	for _, candidate := range rt.apis {
+		if !rt.anyHost && !candidate.knownHost(req.URL) {
+			continue
+		}
+		if e, ok := candidate.match(req); ok {
+			api, endpoint = candidate, e
+			break
+		}
+	}
+	if api == nil {
+		return next(req)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// A RoundTripper must not modify the caller's request
+	outReq := req.Clone(req.Context())
+	outReq.Body = io.NopCloser(bytes.NewReader(body))
+	outReq.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	call, err := api.parseRequest(req, endpoint, body)
+	if err != nil {
+		return next(outReq)
+	}
+	if rt.params != nil {
+		if params, ok := rt.params(req, body); ok {
+			call.params = params
+		}
+	}
+
+	opts := []GenerationOption{
+		WithGenerationInput(call.input),
+		WithGenerationParams(call.params),
+		withGenerationMetadata(call.metadata),
+		withGenerationMetadata(map[string]string{"provider": string(api.provider()), "endpoint": endpoint}),
+	}
+	if call.model != "" {
+		opts = append(opts, WithGenerationModel(call.model))
+	}
+	generation := rt.client.startGeneration(req.Context(), call.name, call.obsType, opts)
+
+	resp, err := next(outReq)
+	if err != nil {
+		generation.Update(WithGenerationLevel(LogLevelError), WithGenerationStatusMessage(err.Error()))
+		generation.End()
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		respBody, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+		message := resp.Status
+		if readErr == nil && len(respBody) > 0 {
+			if len(respBody) > maxErrorBodySize {
+				respBody = respBody[:maxErrorBodySize]
+			}
+			message += ": " + string(respBody)
+		}
+		generation.Update(WithGenerationLevel(LogLevelError), WithGenerationStatusMessage(message))
+		generation.End()
+		return resp, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" || mediaType == "application/x-ndjson" {
+		resp.Body = &streamRecorder{
+			body:       resp.Body,
+			sse:        mediaType == "text/event-stream",
+			stream:     api.newStream(endpoint, call),
+			generation: generation,
+			rt:         rt,
+			call:       call,
+		}
+		return resp, nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	if err != nil {
+		generation.Update(WithGenerationLevel(LogLevelError), WithGenerationStatusMessage(err.Error()))
+		generation.End()
+		return resp, nil
+	}
+
+	if result, err := api.parseResponse(endpoint, respBody); err == nil {
+		generation.Update(rt.resultOptions(call, result)...)
+	}
+	generation.End()
+
+	return resp, nil
+}
+
+// options converts a parsed response into generation options
+func (r llmResult) options() []GenerationOption {
+	var opts []GenerationOption
+	if r.model != "" {
+		opts = append(opts, WithGenerationModel(r.model))
+	}
+	if r.output != nil {
+		opts = append(opts, WithGenerationOutput(r.output))
+	}
+	if len(r.usage) > 0 {
+		opts = append(opts, WithGenerationUsageDetails(r.usage))
+	}
+	if len(r.metadata) > 0 {
+		opts = append(opts, withGenerationMetadata(r.metadata))
+	}
+	return opts
+}
+
+// resultOptions converts a parsed response into generation options, adding
+// its cost when a CostFunc is configured
+func (rt *RoundTripper) resultOptions(call llmCall, result llmResult) []GenerationOption {
+	opts := result.options()
+	if rt.cost == nil || len(result.usage) == 0 {
+		return opts
+	}
+	model := result.model
+	if model == "" {
+		model = call.model
+	}
+	if cost, ok := rt.cost(model, result.usage); ok {
+		opts = append(opts, WithGenerationCost(cost))
+	}
+	return opts
+}
+
+// withGenerationMetadata sets string metadata on a generation
+func withGenerationMetadata(metadata map[string]string) GenerationOption {
+	return GenerationOptionFunc(func(g *Generation) {
+		for key, value := range metadata {
+			g.span.SetAttributes(attribute.String("langfuse.observation.metadata."+key, value))
+		}
+	})
+}
+
+// streamRecorder passes a streaming response through to the caller while
+// parsing it line by line, ending the generation when the stream is consumed
+// or closed
+type streamRecorder struct {
+	body       io.ReadCloser
+	sse        bool
+	stream     llmStream
+	generation *Generation
+	rt         *RoundTripper
+	call       llmCall
+
+	line      []byte
+	eventType string
+	data      [][]byte
+	firstAt   time.Time
+	once      sync.Once
+}
+
+func (s *streamRecorder) Read(p []byte) (int, error) {
+	n, err := s.body.Read(p)
+	s.consume(p[:n])
+	if err == io.EOF {
+		s.finish(nil)
+	} else if err != nil {
+		s.finish(err)
+	}
+	return n, err
+}
+
+func (s *streamRecorder) Close() error {
+	err := s.body.Close()
+	s.finish(nil)
+	return err
+}
+
+// consume splits the bytes read so far into lines
+func (s *streamRecorder) consume(p []byte) {
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			s.line = append(s.line, p...)
+			return
+		}
+		s.line = append(s.line, p[:i]...)
+		s.handleLine(bytes.TrimSuffix(s.line, []byte("\r")))
+		s.line = s.line[:0]
+		p = p[i+1:]
+	}
+}
+
+// handleLine interprets one line as NDJSON or as part of a server-sent event
+func (s *streamRecorder) handleLine(line []byte) {
+	if !s.sse {
+		if len(bytes.TrimSpace(line)) > 0 {
+			s.dispatch("", line)
+		}
+		return
+	}
+
+	switch {
+	case len(line) == 0:
+		if len(s.data) > 0 {
+			s.dispatch(s.eventType, bytes.Join(s.data, []byte("\n")))
+		}
+		s.eventType = ""
+		s.data = nil
+	case bytes.HasPrefix(line, []byte("data:")):
+		data := bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" "))
+		s.data = append(s.data, append([]byte(nil), data...))
+	case bytes.HasPrefix(line, []byte("event:")):
+		s.eventType = strings.TrimSpace(string(line[len("event:"):]))
+	}
+}
+
+func (s *streamRecorder) dispatch(eventType string, data []byte) {
+	if string(data) == "[DONE]" {
+		return
+	}
+	if s.stream.event(eventType, data) && s.firstAt.IsZero() {
+		s.firstAt = time.Now()
+	}
+}
+
+// finish records the accumulated result and ends the generation exactly once
+func (s *streamRecorder) finish(err error) {
+	s.once.Do(func() {
+		// Flush a trailing event or line without terminating newline
+		if len(s.line) > 0 {
+			s.handleLine(s.line)
+		}
+		if s.sse {
+			s.handleLine(nil)
+		}
+
+		opts := s.rt.resultOptions(s.call, s.stream.result())
+		if !s.firstAt.IsZero() {
+			opts = append(opts, WithGenerationStartTime(s.firstAt))
+		}
+		if err != nil {
+			opts = append(opts, WithGenerationLevel(LogLevelError), WithGenerationStatusMessage(err.Error()))
+		}
+		s.generation.Update(opts...)
+		s.generation.End()
+	})
+}
+
+// generationParamRenames maps provider parameter names to GenerationParams fields
+type generationParamRenames map[string]string
+
+// generationParamsFromJSON extracts model parameters from a decoded request
+// body, skipping the given non-parameter fields. Unknown parameters end up in
+// Other.
+func generationParamsFromJSON(fields map[string]json.RawMessage, skip []string, renames generationParamRenames) GenerationParams {
+	skipped := make(map[string]bool, len(skip))
+	for _, key := range skip {
+		skipped[key] = true
+	}
+
+	typed := make(map[string]json.RawMessage)
+	var params GenerationParams
+	for key, value := range fields {
+		if skipped[key] {
+			continue
+		}
+		name := key
+		if renamed, ok := renames[key]; ok {
+			name = renamed
+		}
+		if generationParamNames[name] {
+			// A single stop sequence may be given as a string
+			if name == "stop" && len(value) > 0 && value[0] == '"' {
+				value = json.RawMessage("[" + string(value) + "]")
+			}
+			typed[name] = value
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(value, &v); err == nil {
+			if params.Other == nil {
+				params.Other = make(map[string]interface{})
+			}
+			params.Other[key] = v
+		}
+	}
+
+	type typedParams GenerationParams
+	for name, value := range typed {
+		// Decode field by field so one malformed value does not drop the others
+		_ = json.Unmarshal([]byte(`{"`+name+`":`+string(value)+`}`), (*typedParams)(&params))
+	}
+
+	return params
+}
@@ -0,0 +1,241 @@
+package langfuse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// anthropicMessagesEndpoint is the Anthropic Messages API endpoint recognized
+// by RoundTripper
+const anthropicMessagesEndpoint = "/v1/messages"
+
+// anthropicRequestFields are request fields that are not model parameters
+var anthropicRequestFields = []string{
+	"model", "messages", "system", "tools", "stream", "metadata",
+}
+
+// anthropicParamRenames maps Anthropic parameter names to GenerationParams fields
+var anthropicParamRenames = generationParamRenames{
+	"stop_sequences": "stop",
+}
+
+// anthropicAPI parses the Anthropic Messages API
+type anthropicAPI struct{}
+
+func (anthropicAPI) provider() Provider {
+	return ProviderAnthropic
+}
+
+func (anthropicAPI) match(req *http.Request) (string, bool) {
+	if strings.HasSuffix(strings.TrimSuffix(req.URL.Path, "/"), anthropicMessagesEndpoint) {
+		return anthropicMessagesEndpoint, true
+	}
+	return "", false
+}
+
+func (anthropicAPI) knownHost(u *url.URL) bool {
+	return u.Hostname() == "api.anthropic.com"
+}
+
+func (anthropicAPI) parseRequest(req *http.Request, endpoint string, body []byte) (llmCall, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return llmCall{}, fmt.Errorf("invalid Anthropic request: %w", err)
+	}
+
+	input, err := ChatInputFromAnthropic(body)
+	if err != nil {
+		return llmCall{}, err
+	}
+
+	call := llmCall{
+		name:    "Anthropic-message",
+		obsType: ObservationTypeGeneration,
+		params:  generationParamsFromJSON(fields, anthropicRequestFields, anthropicParamRenames),
+		input:   input,
+	}
+	_ = json.Unmarshal(fields["model"], &call.model)
+
+	return call, nil
+}
+
+// anthropicUsage is the usage object of the Messages API
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// details converts the usage into Langfuse usage details. Anthropic reports
+// cached input tokens separately from input_tokens, so they add to the total.
+func (u *anthropicUsage) details() map[string]int {
+	if u == nil {
+		return nil
+	}
+	details := map[string]int{
+		"input":  u.InputTokens,
+		"output": u.OutputTokens,
+		"total":  u.InputTokens + u.OutputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+	}
+	if u.CacheCreationInputTokens > 0 {
+		details["cache_creation_input_tokens"] = u.CacheCreationInputTokens
+	}
+	if u.CacheReadInputTokens > 0 {
+		details["cache_read_input_tokens"] = u.CacheReadInputTokens
+	}
+	return details
+}
+
+func (anthropicAPI) parseResponse(endpoint string, body []byte) (llmResult, error) {
+	var resp struct {
+		Model      string          `json:"model"`
+		StopReason string          `json:"stop_reason"`
+		Usage      *anthropicUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return llmResult{}, fmt.Errorf("invalid Anthropic response: %w", err)
+	}
+
+	message, err := ChatMessageFromAnthropic(body)
+	if err != nil {
+		return llmResult{}, err
+	}
+
+	result := llmResult{
+		model:  resp.Model,
+		output: message,
+		usage:  resp.Usage.details(),
+	}
+	if resp.StopReason != "" {
+		result.metadata = map[string]string{"stop_reason": resp.StopReason}
+	}
+	return result, nil
+}
+
+func (anthropicAPI) newStream(endpoint string, call llmCall) llmStream {
+	return &anthropicStream{blocks: make(map[int]*anthropicStreamBlock)}
+}
+
+// anthropicStreamBlock is a content block assembled from stream events
+type anthropicStreamBlock struct {
+	block     anthropicContentBlock
+	text      strings.Builder
+	inputJSON strings.Builder
+}
+
+// anthropicStream accumulates Messages API stream events
+type anthropicStream struct {
+	model      string
+	role       string
+	blocks     map[int]*anthropicStreamBlock
+	stopReason string
+	usage      anthropicUsage
+	hasUsage   bool
+}
+
+func (s *anthropicStream) event(eventType string, data []byte) bool {
+	var event struct {
+		Type    string `json:"type"`
+		Index   int    `json:"index"`
+		Message struct {
+			Model string          `json:"model"`
+			Role  string          `json:"role"`
+			Usage *anthropicUsage `json:"usage"`
+		} `json:"message"`
+		ContentBlock anthropicContentBlock `json:"content_block"`
+		Delta        struct {
+			Type        string `json:"type"`
+			Text        string `json:"text"`
+			PartialJSON string `json:"partial_json"`
+			StopReason  string `json:"stop_reason"`
+		} `json:"delta"`
+		Usage *anthropicUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return false
+	}
+
+	switch event.Type {
+	case "message_start":
+		s.model = event.Message.Model
+		s.role = event.Message.Role
+		if event.Message.Usage != nil {
+			s.usage = *event.Message.Usage
+			s.hasUsage = true
+		}
+	case "content_block_start":
+		block := &anthropicStreamBlock{block: event.ContentBlock}
+		block.text.WriteString(event.ContentBlock.Text)
+		s.blocks[event.Index] = block
+		return event.ContentBlock.Text != ""
+	case "content_block_delta":
+		block, ok := s.blocks[event.Index]
+		if !ok {
+			block = &anthropicStreamBlock{}
+			s.blocks[event.Index] = block
+		}
+		switch event.Delta.Type {
+		case "text_delta":
+			block.text.WriteString(event.Delta.Text)
+			return true
+		case "input_json_delta":
+			block.inputJSON.WriteString(event.Delta.PartialJSON)
+			return true
+		case "thinking_delta":
+			return true
+		}
+	case "message_delta":
+		if event.Delta.StopReason != "" {
+			s.stopReason = event.Delta.StopReason
+		}
+		// message_delta carries cumulative output tokens
+		if event.Usage != nil {
+			s.usage.OutputTokens = event.Usage.OutputTokens
+			s.hasUsage = true
+		}
+	}
+	return false
+}
+
+func (s *anthropicStream) result() llmResult {
+	result := llmResult{model: s.model}
+	if s.hasUsage {
+		result.usage = s.usage.details()
+	}
+	if s.stopReason != "" {
+		result.metadata = map[string]string{"stop_reason": s.stopReason}
+	}
+
+	indexes := make([]int, 0, len(s.blocks))
+	for index := range s.blocks {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	blocks := make([]anthropicContentBlock, 0, len(indexes))
+	for _, index := range indexes {
+		b := s.blocks[index]
+		block := b.block
+		block.Text = b.text.String()
+		if b.inputJSON.Len() > 0 {
+			block.Input = json.RawMessage(b.inputJSON.String())
+		}
+		blocks = append(blocks, block)
+	}
+
+	role := s.role
+	if role == "" {
+		role = ChatRoleAssistant
+	}
+	message := ChatMessage{Role: role}
+	if messages, err := anthropicMessages(role, blocks); err == nil && len(messages) > 0 {
+		message = messages[len(messages)-1]
+	}
+	result.output = message
+	return result
+}
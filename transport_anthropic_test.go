@@ -0,0 +1,124 @@
+package langfuse
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicMessage(t *testing.T) {
+	reqBody := `{"model":"claude-sonnet-4-5","max_tokens":1024,"stop_sequences":["END"],"system":"Be brief","messages":[{"role":"user","content":"hi"}]}`
+	respBody := `{"model":"claude-sonnet-4-5-20250929","role":"assistant","content":[{"type":"text","text":"hello"}],"stop_reason":"end_turn",
+		"usage":{"input_tokens":10,"output_tokens":5,"cache_read_input_tokens":20}}`
+
+	_, _, exporter := recordLLMCall(t, "https://api.anthropic.com/v1/messages", reqBody, fakeLLM(http.StatusOK, "application/json", respBody, nil))
+
+	span := findSpan(t, exporter, "Anthropic-message")
+	want := map[string]string{
+		"langfuse.observation.model.name":           "claude-sonnet-4-5-20250929",
+		"langfuse.observation.model.parameters":     `{"max_tokens":1024,"stop":["END"]}`,
+		"langfuse.observation.input":                `{"messages":[{"role":"system","content":"Be brief"},{"role":"user","content":"hi"}]}`,
+		"langfuse.observation.output":               `{"role":"assistant","content":"hello"}`,
+		"langfuse.observation.usage_details":        `{"cache_read_input_tokens":20,"input":10,"output":5,"total":35}`,
+		"langfuse.observation.metadata.provider":    "anthropic",
+		"langfuse.observation.metadata.stop_reason": "end_turn",
+	}
+	for key, value := range want {
+		if got := stringAttr(span, key); got != value {
+			t.Errorf("%s = %s, want %s", key, got, value)
+		}
+	}
+}
+
+func TestAnthropicUsageDetails(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage anthropicUsage
+		want  map[string]int
+	}{
+		{
+			name:  "uncached",
+			usage: anthropicUsage{InputTokens: 10, OutputTokens: 5},
+			want:  map[string]int{"input": 10, "output": 5, "total": 15},
+		},
+		{
+			name:  "cache write and read",
+			usage: anthropicUsage{InputTokens: 10, OutputTokens: 5, CacheCreationInputTokens: 100, CacheReadInputTokens: 200},
+			want:  map[string]int{"input": 10, "output": 5, "total": 315, "cache_creation_input_tokens": 100, "cache_read_input_tokens": 200},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.usage.details(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnthropicStream(t *testing.T) {
+	events := []struct {
+		eventType string
+		data      string
+		generated bool
+	}{
+		{"message_start", `{"type":"message_start","message":{"model":"claude-sonnet-4-5","role":"assistant","usage":{"input_tokens":10,"output_tokens":1}}}`, false},
+		{"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`, false},
+		{"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Check"}}`, true},
+		{"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"ing"}}`, true},
+		{"content_block_start", `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`, false},
+		{"content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`, true},
+		{"content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}`, true},
+		{"message_delta", `{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":12}}`, false},
+		{"message_stop", `{"type":"message_stop"}`, false},
+	}
+
+	stream := anthropicAPI{}.newStream(anthropicMessagesEndpoint, llmCall{})
+	for _, e := range events {
+		if got := stream.event(e.eventType, []byte(e.data)); got != e.generated {
+			t.Errorf("%s: generated = %v, want %v", e.data, got, e.generated)
+		}
+	}
+
+	result := stream.result()
+	want := ChatMessage{
+		Role:      ChatRoleAssistant,
+		Content:   "Checking",
+		ToolCalls: []ToolCall{NewToolCall("toolu_1", "get_weather", `{"city":"Paris"}`)},
+	}
+	if !reflect.DeepEqual(result.output, want) {
+		t.Errorf("output = %+v, want %+v", result.output, want)
+	}
+	if want := map[string]int{"input": 10, "output": 12, "total": 22}; !reflect.DeepEqual(result.usage, want) {
+		t.Errorf("usage = %v, want %v", result.usage, want)
+	}
+	if result.model != "claude-sonnet-4-5" || result.metadata["stop_reason"] != "tool_use" {
+		t.Errorf("model %q, metadata %v", result.model, result.metadata)
+	}
+}
+
+func TestAnthropicStreamThroughRoundTripper(t *testing.T) {
+	var events []string
+	for _, data := range []string{
+		`{"type":"message_start","message":{"model":"claude-sonnet-4-5","role":"assistant","usage":{"input_tokens":3,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":2}}`,
+	} {
+		var event struct{ Type string }
+		_ = json.Unmarshal([]byte(data), &event)
+		events = append(events, "event: "+event.Type+"\ndata: "+data+"\n\n")
+	}
+	_, _, exporter := recordLLMCall(t, "https://api.anthropic.com/v1/messages",
+		`{"model":"claude-sonnet-4-5","messages":[],"stream":true}`, fakeLLM(http.StatusOK, "text/event-stream", strings.Join(events, ""), nil))
+
+	span := findSpan(t, exporter, "Anthropic-message")
+	if got := stringAttr(span, "langfuse.observation.output"); got != `{"role":"assistant","content":"Hi"}` {
+		t.Errorf("output = %s", got)
+	}
+	if got := stringAttr(span, "langfuse.observation.usage_details"); got != `{"input":3,"output":2,"total":5}` {
+		t.Errorf("usage = %s", got)
+	}
+}
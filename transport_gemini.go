@@ -0,0 +1,219 @@
+package langfuse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Gemini and Vertex AI methods recognized by RoundTripper
+const (
+	geminiGenerateContent       = "generateContent"
+	geminiStreamGenerateContent = "streamGenerateContent"
+)
+
+// geminiParamRenames maps generationConfig fields to GenerationParams fields
+var geminiParamRenames = generationParamRenames{
+	"topP":             "top_p",
+	"topK":             "top_k",
+	"maxOutputTokens":  "max_tokens",
+	"stopSequences":    "stop",
+	"candidateCount":   "n",
+	"presencePenalty":  "presence_penalty",
+	"frequencyPenalty": "frequency_penalty",
+}
+
+// geminiAPI parses the generateContent API of Gemini and Vertex AI
+type geminiAPI struct{}
+
+func (geminiAPI) provider() Provider {
+	return ProviderGemini
+}
+
+func (geminiAPI) match(req *http.Request) (string, bool) {
+	for _, method := range []string{geminiGenerateContent, geminiStreamGenerateContent} {
+		if strings.HasSuffix(req.URL.Path, ":"+method) {
+			return method, true
+		}
+	}
+	return "", false
+}
+
+func (geminiAPI) knownHost(u *url.URL) bool {
+	host := u.Hostname()
+	// Vertex AI serves regional endpoints such as us-central1-aiplatform.googleapis.com
+	return host == "generativelanguage.googleapis.com" ||
+		host == "aiplatform.googleapis.com" || strings.HasSuffix(host, "-aiplatform.googleapis.com")
+}
+
+func (geminiAPI) parseRequest(req *http.Request, endpoint string, body []byte) (llmCall, error) {
+	var fields struct {
+		GenerationConfig map[string]json.RawMessage `json:"generationConfig"`
+		ToolConfig       json.RawMessage            `json:"toolConfig"`
+		SafetySettings   json.RawMessage            `json:"safetySettings"`
+		CachedContent    string                     `json:"cachedContent"`
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return llmCall{}, fmt.Errorf("invalid Gemini request: %w", err)
+	}
+
+	input, err := ChatInputFromGemini(body)
+	if err != nil {
+		return llmCall{}, err
+	}
+
+	call := llmCall{
+		name:    "Gemini-generate-content",
+		obsType: ObservationTypeGeneration,
+		model:   geminiModel(req.URL.Path),
+		params:  generationParamsFromJSON(fields.GenerationConfig, nil, geminiParamRenames),
+		input:   input,
+	}
+	if len(fields.ToolConfig) > 0 {
+		call.params.ToolChoice = fields.ToolConfig
+	}
+	if len(fields.SafetySettings) > 0 {
+		if call.params.Other == nil {
+			call.params.Other = make(map[string]interface{})
+		}
+		call.params.Other["safetySettings"] = fields.SafetySettings
+	}
+	if fields.CachedContent != "" {
+		call.metadata = map[string]string{"cached_content": fields.CachedContent}
+	}
+
+	return call, nil
+}
+
+// geminiModel extracts the model from a request path such as
+// /v1beta/models/gemini-2.5-flash:generateContent or
+// /v1/projects/p/locations/l/publishers/google/models/gemini-2.5-flash:generateContent
+func geminiModel(path string) string {
+	i := strings.LastIndex(path, "/models/")
+	if i < 0 {
+		return ""
+	}
+	model := path[i+len("/models/"):]
+	if j := strings.IndexByte(model, ':'); j >= 0 {
+		model = model[:j]
+	}
+	return model
+}
+
+// geminiUsage is the usageMetadata object of generateContent responses
+type geminiUsage struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	TotalTokenCount         int `json:"totalTokenCount"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	ToolUsePromptTokenCount int `json:"toolUsePromptTokenCount"`
+}
+
+// details converts the usage into Langfuse usage details, using the same
+// keys as for OpenAI. Cached tokens are part of the prompt count, while tool
+// use and thoughts tokens are reported next to the prompt and candidates
+// counts, so only the cached tokens come out of the prompt count.
+func (u *geminiUsage) details() map[string]int {
+	if u == nil {
+		return nil
+	}
+	return NewUsageDetails(u.PromptTokenCount+u.ToolUsePromptTokenCount, u.CandidatesTokenCount+u.ThoughtsTokenCount, u.TotalTokenCount, map[string]int{
+		"input_cached_tokens":     u.CachedContentTokenCount,
+		"input_tool_use_tokens":   u.ToolUsePromptTokenCount,
+		"output_reasoning_tokens": u.ThoughtsTokenCount,
+	})
+}
+
+func (geminiAPI) parseResponse(endpoint string, body []byte) (llmResult, error) {
+	// Without alt=sse, streamGenerateContent returns a JSON array of chunks
+	if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") {
+		var chunks []json.RawMessage
+		if err := json.Unmarshal(body, &chunks); err != nil {
+			return llmResult{}, fmt.Errorf("invalid Gemini response: %w", err)
+		}
+		stream := &geminiStream{}
+		for _, chunk := range chunks {
+			stream.event("", chunk)
+		}
+		return stream.result(), nil
+	}
+
+	var resp geminiResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return llmResult{}, fmt.Errorf("invalid Gemini response: %w", err)
+	}
+
+	result := llmResult{model: resp.ModelVersion, usage: resp.UsageMetadata.details()}
+	if message, err := ChatMessageFromGemini(body); err == nil {
+		result.output = message
+	}
+	if len(resp.Candidates) > 0 && resp.Candidates[0].FinishReason != "" {
+		result.metadata = map[string]string{"finish_reason": resp.Candidates[0].FinishReason}
+	}
+	return result, nil
+}
+
+// geminiResponse is a generateContent response or streamed chunk
+type geminiResponse struct {
+	ModelVersion string `json:"modelVersion"`
+	Candidates   []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata *geminiUsage `json:"usageMetadata"`
+}
+
+func (geminiAPI) newStream(endpoint string, call llmCall) llmStream {
+	return &geminiStream{}
+}
+
+// geminiStream accumulates streamed generateContent chunks
+type geminiStream struct {
+	model        string
+	parts        []geminiPart
+	finishReason string
+	usage        *geminiUsage
+}
+
+func (s *geminiStream) event(eventType string, data []byte) bool {
+	var chunk geminiResponse
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return false
+	}
+
+	if chunk.ModelVersion != "" {
+		s.model = chunk.ModelVersion
+	}
+	// Each chunk carries the cumulative usage so far
+	if chunk.UsageMetadata != nil {
+		s.usage = chunk.UsageMetadata
+	}
+
+	// Only the first candidate is recorded
+	if len(chunk.Candidates) == 0 {
+		return false
+	}
+	candidate := chunk.Candidates[0]
+	if candidate.FinishReason != "" {
+		s.finishReason = candidate.FinishReason
+	}
+	s.parts = append(s.parts, candidate.Content.Parts...)
+	return len(candidate.Content.Parts) > 0
+}
+
+func (s *geminiStream) result() llmResult {
+	result := llmResult{model: s.model, usage: s.usage.details()}
+	if s.finishReason != "" {
+		result.metadata = map[string]string{"finish_reason": s.finishReason}
+	}
+
+	message := ChatMessage{Role: ChatRoleAssistant}
+	if messages := geminiMessages(geminiContent{Role: "model", Parts: s.parts}); len(messages) > 0 {
+		message = messages[len(messages)-1]
+	}
+	result.output = message
+	return result
+}
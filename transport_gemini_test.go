@@ -0,0 +1,171 @@
+package langfuse
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestGeminiGenerateContent(t *testing.T) {
+	reqBody := `{"systemInstruction":{"parts":[{"text":"Be brief"}]},"contents":[{"role":"user","parts":[{"text":"hi"}]}],
+		"generationConfig":{"temperature":0.2,"maxOutputTokens":100,"thinkingConfig":{"thinkingBudget":0}},"cachedContent":"cachedContents/abc"}`
+	respBody := `{"modelVersion":"gemini-2.5-flash","candidates":[{"content":{"role":"model","parts":[{"text":"hello"}]},"finishReason":"STOP"}],
+		"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"totalTokenCount":15}}`
+
+	_, _, exporter := recordLLMCall(t, "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:generateContent",
+		reqBody, fakeLLM(http.StatusOK, "application/json", respBody, nil))
+
+	span := findSpan(t, exporter, "Gemini-generate-content")
+	want := map[string]string{
+		"langfuse.observation.model.name":              "gemini-2.5-flash",
+		"langfuse.observation.model.parameters":        `{"max_tokens":100,"temperature":0.2,"thinkingConfig":{"thinkingBudget":0}}`,
+		"langfuse.observation.input":                   `{"messages":[{"role":"system","content":"Be brief"},{"role":"user","content":"hi"}]}`,
+		"langfuse.observation.output":                  `{"role":"assistant","content":"hello"}`,
+		"langfuse.observation.usage_details":           `{"input":10,"output":5,"total":15}`,
+		"langfuse.observation.metadata.endpoint":       geminiGenerateContent,
+		"langfuse.observation.metadata.finish_reason":  "STOP",
+		"langfuse.observation.metadata.cached_content": "cachedContents/abc",
+	}
+	for key, value := range want {
+		if got := stringAttr(span, key); got != value {
+			t.Errorf("%s = %s, want %s", key, got, value)
+		}
+	}
+}
+
+func TestGeminiModel(t *testing.T) {
+	tests := []struct {
+		path  string
+		model string
+	}{
+		{path: "/v1beta/models/gemini-2.5-flash:generateContent", model: "gemini-2.5-flash"},
+		{path: "/v1/projects/p/locations/us-central1/publishers/google/models/gemini-2.5-pro:streamGenerateContent", model: "gemini-2.5-pro"},
+		{path: "/v1/tunedModels/x:generateContent", model: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := geminiModel(tt.path); got != tt.model {
+				t.Errorf("got %q, want %q", got, tt.model)
+			}
+		})
+	}
+}
+
+func TestGeminiUsageDetails(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage string
+		want  map[string]int
+	}{
+		{
+			name:  "plain",
+			usage: `{"promptTokenCount":10,"candidatesTokenCount":5,"totalTokenCount":15}`,
+			want:  map[string]int{"input": 10, "output": 5, "total": 15},
+		},
+		{
+			name:  "cached prompt",
+			usage: `{"promptTokenCount":100,"candidatesTokenCount":5,"totalTokenCount":105,"cachedContentTokenCount":80}`,
+			want:  map[string]int{"input": 20, "output": 5, "total": 105, "input_cached_tokens": 80},
+		},
+		{
+			name:  "thoughts and tool use",
+			usage: `{"promptTokenCount":10,"toolUsePromptTokenCount":7,"candidatesTokenCount":5,"thoughtsTokenCount":30,"totalTokenCount":52}`,
+			want:  map[string]int{"input": 10, "output": 5, "total": 52, "input_tool_use_tokens": 7, "output_reasoning_tokens": 30},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var usage geminiUsage
+			if err := json.Unmarshal([]byte(tt.usage), &usage); err != nil {
+				t.Fatal(err)
+			}
+			got := usage.details()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			sum := 0
+			for key, count := range got {
+				if key != "total" {
+					sum += count
+				}
+			}
+			if sum != got["total"] {
+				t.Errorf("usage types sum to %d, total is %d", sum, got["total"])
+			}
+		})
+	}
+}
+
+func TestGeminiStream(t *testing.T) {
+	chunks := []string{
+		`{"modelVersion":"gemini-2.5-flash","candidates":[{"content":{"role":"model","parts":[{"text":"Hel","thought":false}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]}}],"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":1,"totalTokenCount":4}}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]},"finishReason":"STOP"}],
+			"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":2,"totalTokenCount":5}}`,
+	}
+	want := ChatMessage{
+		Role:      ChatRoleAssistant,
+		Content:   "Hello",
+		ToolCalls: []ToolCall{NewToolCall("get_weather", "get_weather", `{"city":"Paris"}`)},
+	}
+
+	t.Run("sse", func(t *testing.T) {
+		stream := geminiAPI{}.newStream(geminiStreamGenerateContent, llmCall{})
+		for _, chunk := range chunks {
+			if !stream.event("", []byte(chunk)) {
+				t.Errorf("chunk %s reported no content", chunk)
+			}
+		}
+		result := stream.result()
+		if !reflect.DeepEqual(result.output, want) {
+			t.Errorf("output = %+v, want %+v", result.output, want)
+		}
+		if got := result.usage; got["total"] != 5 || got["output"] != 2 {
+			t.Errorf("usage = %v, want the last cumulative usage", got)
+		}
+	})
+
+	t.Run("json array", func(t *testing.T) {
+		body, _ := json.Marshal([]json.RawMessage{json.RawMessage(chunks[0]), json.RawMessage(chunks[1]), json.RawMessage(chunks[2])})
+		result, err := geminiAPI{}.parseResponse(geminiStreamGenerateContent, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result.output, want) {
+			t.Errorf("output = %+v, want %+v", result.output, want)
+		}
+		if result.model != "gemini-2.5-flash" || result.metadata["finish_reason"] != "STOP" {
+			t.Errorf("model %q, metadata %v", result.model, result.metadata)
+		}
+	})
+}
+
+func TestChatFromGemini(t *testing.T) {
+	input, err := ChatInputFromGemini([]byte(`{
+		"contents": [
+			{"role": "user", "parts": [{"text": "What is this?"}, {"inlineData": {"mimeType": "image/png", "data": "cG5n"}}]},
+			{"role": "model", "parts": [{"functionCall": {"id": "c1", "name": "lookup", "args": {}}}]},
+			{"role": "user", "parts": [{"functionResponse": {"id": "c1", "name": "lookup", "response": {"result": "cat"}}}]}
+		],
+		"tools": [{"functionDeclarations": [{"name": "lookup", "description": "Look up"}]}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ChatMessage{
+		{Role: ChatRoleUser, Parts: []ContentPart{TextPart("What is this?"), ImagePart("data:image/png;base64,cG5n")}},
+		{Role: ChatRoleAssistant, ToolCalls: []ToolCall{NewToolCall("c1", "lookup", "{}")}},
+		{Role: ChatRoleTool, Name: "lookup", Content: `{"result": "cat"}`, ToolCallID: "c1"},
+	}
+	if !reflect.DeepEqual(input.Messages, want) {
+		t.Errorf("messages:\n got %+v\nwant %+v", input.Messages, want)
+	}
+	if len(input.Tools) != 1 || input.Tools[0].Function.Name != "lookup" {
+		t.Errorf("tools = %+v", input.Tools)
+	}
+
+	if _, err := ChatMessageFromGemini([]byte(`{"candidates": []}`)); err == nil {
+		t.Error("expected an error for a response without candidates")
+	}
+}
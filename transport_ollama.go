@@ -0,0 +1,297 @@
+package langfuse
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ollama endpoints recognized by RoundTripper
+const (
+	ollamaChat     = "/api/chat"
+	ollamaGenerate = "/api/generate"
+	ollamaEmbed    = "/api/embed"
+)
+
+// ollamaParamRenames maps Ollama options to GenerationParams fields
+var ollamaParamRenames = generationParamRenames{
+	"num_predict": "max_tokens",
+	"format":      "response_format",
+}
+
+// ollamaAPI parses the Ollama API
+type ollamaAPI struct{}
+
+func (ollamaAPI) provider() Provider {
+	return ProviderOllama
+}
+
+func (ollamaAPI) match(req *http.Request) (string, bool) {
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	for _, endpoint := range []string{ollamaChat, ollamaGenerate, ollamaEmbed} {
+		if strings.HasSuffix(path, endpoint) {
+			return endpoint, true
+		}
+	}
+	return "", false
+}
+
+func (ollamaAPI) knownHost(u *url.URL) bool {
+	return u.Port() == "11434" || u.Hostname() == "ollama.com"
+}
+
+// ollamaMessage is a chat message of the Ollama API
+type ollamaMessage struct {
+	Role      string   `json:"role"`
+	Content   string   `json:"content"`
+	Thinking  string   `json:"thinking"`
+	Images    []string `json:"images"`
+	ToolName  string   `json:"tool_name"`
+	ToolCalls []struct {
+		Function struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		} `json:"function"`
+	} `json:"tool_calls"`
+}
+
+// chatMessage converts the message into a chat message
+func (m ollamaMessage) chatMessage() ChatMessage {
+	msg := ChatMessage{Role: m.Role, Content: m.Content}
+	if m.Role == ChatRoleTool {
+		msg.Name = m.ToolName
+	}
+	if len(m.Images) > 0 {
+		msg.Parts = append(msg.Parts, TextPart(m.Content))
+		for _, image := range m.Images {
+			msg.Parts = append(msg.Parts, ImagePart(ollamaImageURL(image)))
+		}
+	}
+	for _, tc := range m.ToolCalls {
+		msg.ToolCalls = append(msg.ToolCalls, NewToolCall("", tc.Function.Name, string(tc.Function.Arguments)))
+	}
+	return msg
+}
+
+// ollamaImageURL converts a base64 image without media type into a data URI
+func ollamaImageURL(image string) string {
+	contentType := "image/png"
+	if data, err := base64.StdEncoding.DecodeString(image); err == nil {
+		contentType = http.DetectContentType(data)
+	}
+	return "data:" + contentType + ";base64," + image
+}
+
+func (ollamaAPI) parseRequest(req *http.Request, endpoint string, body []byte) (llmCall, error) {
+	var request struct {
+		Model    string                     `json:"model"`
+		Messages []ollamaMessage            `json:"messages"`
+		Tools    []ToolDefinition           `json:"tools"`
+		Prompt   string                     `json:"prompt"`
+		System   string                     `json:"system"`
+		Images   []string                   `json:"images"`
+		Input    json.RawMessage            `json:"input"`
+		Options  map[string]json.RawMessage `json:"options"`
+		Format   json.RawMessage            `json:"format"`
+		Think    json.RawMessage            `json:"think"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return llmCall{}, fmt.Errorf("invalid Ollama request: %w", err)
+	}
+
+	// Model options and the output format are recorded as parameters
+	fields := request.Options
+	if fields == nil {
+		fields = make(map[string]json.RawMessage)
+	}
+	if len(request.Format) > 0 {
+		fields["format"] = request.Format
+	}
+	if len(request.Think) > 0 {
+		fields["think"] = request.Think
+	}
+
+	call := llmCall{
+		obsType: ObservationTypeGeneration,
+		model:   request.Model,
+		params:  generationParamsFromJSON(fields, nil, ollamaParamRenames),
+	}
+
+	switch endpoint {
+	case ollamaChat:
+		call.name = "Ollama-chat"
+		input := ChatInput{Tools: request.Tools}
+		for _, m := range request.Messages {
+			input.Messages = append(input.Messages, m.chatMessage())
+		}
+		call.input = input
+	case ollamaGenerate:
+		call.name = "Ollama-generate"
+		var input ChatInput
+		if request.System != "" {
+			input.Messages = append(input.Messages, ChatMessage{Role: ChatRoleSystem, Content: request.System})
+		}
+		prompt := ollamaMessage{Role: ChatRoleUser, Content: request.Prompt, Images: request.Images}
+		input.Messages = append(input.Messages, prompt.chatMessage())
+		call.input = input
+	case ollamaEmbed:
+		call.name = "Ollama-embedding"
+		call.obsType = ObservationTypeEmbedding
+		call.input = rawJSON(request.Input)
+	}
+
+	return call, nil
+}
+
+// ollamaResponse is an Ollama response or streamed chunk
+type ollamaResponse struct {
+	Model      string            `json:"model"`
+	Message    ollamaMessage     `json:"message"`
+	Response   string            `json:"response"`
+	Embeddings []json.RawMessage `json:"embeddings"`
+	Done       bool              `json:"done"`
+	DoneReason string            `json:"done_reason"`
+
+	// Durations are in nanoseconds
+	TotalDuration      int64 `json:"total_duration"`
+	LoadDuration       int64 `json:"load_duration"`
+	PromptEvalCount    int   `json:"prompt_eval_count"`
+	PromptEvalDuration int64 `json:"prompt_eval_duration"`
+	EvalCount          int   `json:"eval_count"`
+	EvalDuration       int64 `json:"eval_duration"`
+}
+
+// usage converts the token counts into Langfuse usage details
+func (r *ollamaResponse) usage() map[string]int {
+	if r.PromptEvalCount == 0 && r.EvalCount == 0 {
+		return nil
+	}
+	return map[string]int{
+		"input":  r.PromptEvalCount,
+		"output": r.EvalCount,
+		"total":  r.PromptEvalCount + r.EvalCount,
+	}
+}
+
+// metadata derives latency metrics from the reported durations
+func (r *ollamaResponse) metadata() map[string]string {
+	metadata := make(map[string]string)
+	if r.DoneReason != "" {
+		metadata["done_reason"] = r.DoneReason
+	}
+	durations := map[string]int64{
+		"total_time":       r.TotalDuration,
+		"load_time":        r.LoadDuration,
+		"prompt_eval_time": r.PromptEvalDuration,
+		"eval_time":        r.EvalDuration,
+	}
+	for key, ns := range durations {
+		if ns > 0 {
+			metadata[key] = time.Duration(ns).String()
+		}
+	}
+	if r.PromptEvalCount > 0 && r.PromptEvalDuration > 0 {
+		metadata["prompt_tokens_per_second"] = tokensPerSecond(r.PromptEvalCount, r.PromptEvalDuration)
+	}
+	if r.EvalCount > 0 && r.EvalDuration > 0 {
+		metadata["tokens_per_second"] = tokensPerSecond(r.EvalCount, r.EvalDuration)
+	}
+	return metadata
+}
+
+func tokensPerSecond(tokens int, ns int64) string {
+	return strconv.FormatFloat(float64(tokens)/time.Duration(ns).Seconds(), 'f', 2, 64)
+}
+
+func (ollamaAPI) parseResponse(endpoint string, body []byte) (llmResult, error) {
+	// Requests without "stream": false are streamed even if the server does not
+	// label the response as NDJSON
+	stream := &ollamaStream{endpoint: endpoint}
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if !json.Valid([]byte(line)) {
+			return llmResult{}, fmt.Errorf("invalid Ollama response")
+		}
+		stream.event("", []byte(line))
+	}
+	return stream.result(), nil
+}
+
+func (ollamaAPI) newStream(endpoint string, call llmCall) llmStream {
+	return &ollamaStream{endpoint: endpoint}
+}
+
+// ollamaStream accumulates streamed NDJSON chunks. The final chunk carries
+// the token counts and durations.
+type ollamaStream struct {
+	endpoint string
+	content  strings.Builder
+	message  ollamaMessage
+	final    ollamaResponse
+}
+
+func (s *ollamaStream) event(eventType string, data []byte) bool {
+	var chunk ollamaResponse
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return false
+	}
+
+	if chunk.Model != "" {
+		s.final.Model = chunk.Model
+	}
+	if chunk.Message.Role != "" {
+		s.message.Role = chunk.Message.Role
+	}
+	s.message.ToolCalls = append(s.message.ToolCalls, chunk.Message.ToolCalls...)
+	if len(chunk.Embeddings) > 0 {
+		s.final.Embeddings = chunk.Embeddings
+	}
+	if chunk.Done || chunk.PromptEvalCount > 0 {
+		model, embeddings := s.final.Model, s.final.Embeddings
+		s.final = chunk
+		s.final.Model, s.final.Embeddings = model, embeddings
+	}
+
+	text := chunk.Message.Content + chunk.Response
+	s.content.WriteString(text)
+	return text != "" || chunk.Message.Thinking != "" || len(chunk.Message.ToolCalls) > 0
+}
+
+func (s *ollamaStream) result() llmResult {
+	result := llmResult{
+		model:    s.final.Model,
+		usage:    s.final.usage(),
+		metadata: s.final.metadata(),
+	}
+
+	switch s.endpoint {
+	case ollamaChat:
+		message := s.message
+		if message.Role == "" {
+			message.Role = ChatRoleAssistant
+		}
+		message.Content = s.content.String()
+		result.output = message.chatMessage()
+	case ollamaGenerate:
+		result.output = s.content.String()
+	case ollamaEmbed:
+		// Vectors are not recorded, only their count and dimensions
+		output := map[string]int{"embeddings": len(s.final.Embeddings)}
+		if len(s.final.Embeddings) > 0 {
+			var vector []float64
+			if err := json.Unmarshal(s.final.Embeddings[0], &vector); err == nil {
+				output["dimensions"] = len(vector)
+			}
+		}
+		result.output = output
+	}
+
+	return result
+}
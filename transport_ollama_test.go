@@ -0,0 +1,152 @@
+package langfuse
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOllamaChat(t *testing.T) {
+	reqBody := `{"model":"llama3.2","messages":[{"role":"user","content":"hi"}],"options":{"temperature":0.2,"num_predict":64,"num_ctx":4096},"format":"json"}`
+	respBody := `{"model":"llama3.2","message":{"role":"assistant","content":"{}"},"done":true,"done_reason":"stop",` +
+		`"total_duration":2000000000,"prompt_eval_count":10,"prompt_eval_duration":500000000,"eval_count":20,"eval_duration":1000000000}`
+
+	_, _, exporter := recordLLMCall(t, "http://localhost:11434/api/chat", reqBody, fakeLLM(http.StatusOK, "application/json", respBody, nil))
+
+	span := findSpan(t, exporter, "Ollama-chat")
+	want := map[string]string{
+		"langfuse.observation.model.name":                        "llama3.2",
+		"langfuse.observation.model.parameters":                  `{"max_tokens":64,"num_ctx":4096,"response_format":"json","temperature":0.2}`,
+		"langfuse.observation.input":                             `{"messages":[{"role":"user","content":"hi"}]}`,
+		"langfuse.observation.output":                            `{"role":"assistant","content":"{}"}`,
+		"langfuse.observation.usage_details":                     `{"input":10,"output":20,"total":30}`,
+		"langfuse.observation.metadata.provider":                 "ollama",
+		"langfuse.observation.metadata.done_reason":              "stop",
+		"langfuse.observation.metadata.total_time":               "2s",
+		"langfuse.observation.metadata.tokens_per_second":        "20.00",
+		"langfuse.observation.metadata.prompt_tokens_per_second": "20.00",
+	}
+	for key, value := range want {
+		if got := stringAttr(span, key); got != value {
+			t.Errorf("%s = %s, want %s", key, got, value)
+		}
+	}
+}
+
+func TestOllamaParseRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		body     string
+		callName string
+		input    interface{}
+	}{
+		{
+			name:     "generate with images",
+			endpoint: ollamaGenerate,
+			body:     `{"model":"llava","system":"Be brief","prompt":"What is this?","images":["iVBORw0KGgo="]}`,
+			callName: "Ollama-generate",
+			input: ChatInput{Messages: []ChatMessage{
+				{Role: ChatRoleSystem, Content: "Be brief"},
+				{Role: ChatRoleUser, Content: "What is this?", Parts: []ContentPart{TextPart("What is this?"), ImagePart("data:image/png;base64,iVBORw0KGgo=")}},
+			}},
+		},
+		{
+			name:     "chat with tool result",
+			endpoint: ollamaChat,
+			body:     `{"model":"llama3.2","messages":[{"role":"tool","content":"sunny","tool_name":"get_weather"}]}`,
+			callName: "Ollama-chat",
+			input:    ChatInput{Messages: []ChatMessage{{Role: ChatRoleTool, Content: "sunny", Name: "get_weather"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "http://localhost:11434"+tt.endpoint, nil)
+			call, err := ollamaAPI{}.parseRequest(req, tt.endpoint, []byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if call.name != tt.callName {
+				t.Errorf("name = %q, want %q", call.name, tt.callName)
+			}
+			if !reflect.DeepEqual(call.input, tt.input) {
+				t.Errorf("input:\n got %+v\nwant %+v", call.input, tt.input)
+			}
+		})
+	}
+}
+
+func TestOllamaStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		chunks   []string
+		output   interface{}
+		usage    map[string]int
+	}{
+		{
+			name:     "chat",
+			endpoint: ollamaChat,
+			chunks: []string{
+				`{"model":"llama3.2","message":{"role":"assistant","content":"Hel"},"done":false}`,
+				`{"model":"llama3.2","message":{"role":"assistant","content":"lo"},"done":false}`,
+				`{"model":"llama3.2","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"get_weather","arguments":{"city":"Paris"}}}]},"done":false}`,
+				`{"model":"llama3.2","message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":3,"eval_count":4}`,
+			},
+			output: ChatMessage{Role: ChatRoleAssistant, Content: "Hello", ToolCalls: []ToolCall{NewToolCall("", "get_weather", `{"city":"Paris"}`)}},
+			usage:  map[string]int{"input": 3, "output": 4, "total": 7},
+		},
+		{
+			name:     "generate",
+			endpoint: ollamaGenerate,
+			chunks: []string{
+				`{"model":"llama3.2","response":"Hi","done":false}`,
+				`{"model":"llama3.2","response":"!","done":true,"prompt_eval_count":2,"eval_count":2}`,
+			},
+			output: "Hi!",
+			usage:  map[string]int{"input": 2, "output": 2, "total": 4},
+		},
+		{
+			name:     "embed",
+			endpoint: ollamaEmbed,
+			chunks:   []string{`{"model":"all-minilm","embeddings":[[0.1,0.2],[0.3,0.4]],"prompt_eval_count":6}`},
+			output:   map[string]int{"embeddings": 2, "dimensions": 2},
+			usage:    map[string]int{"input": 6, "output": 0, "total": 6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Unlabeled NDJSON responses are parsed in one go
+			result, err := ollamaAPI{}.parseResponse(tt.endpoint, []byte(strings.Join(tt.chunks, "\n")+"\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.output, tt.output) {
+				t.Errorf("output = %#v, want %#v", result.output, tt.output)
+			}
+			if !reflect.DeepEqual(result.usage, tt.usage) {
+				t.Errorf("usage = %v, want %v", result.usage, tt.usage)
+			}
+		})
+	}
+
+	if _, err := (ollamaAPI{}).parseResponse(ollamaChat, []byte("not json")); err == nil {
+		t.Error("expected an error for an invalid response")
+	}
+}
+
+func TestOllamaStreamThroughRoundTripper(t *testing.T) {
+	stream := `{"model":"llama3.2","response":"Hi","done":false}` + "\n" +
+		`{"model":"llama3.2","response":"","done":true,"prompt_eval_count":2,"eval_count":1}` + "\n"
+	_, _, exporter := recordLLMCall(t, "http://localhost:11434/api/generate",
+		`{"model":"llama3.2","prompt":"hi"}`, fakeLLM(http.StatusOK, "application/x-ndjson", stream, nil))
+
+	span := findSpan(t, exporter, "Ollama-generate")
+	if got := stringAttr(span, "langfuse.observation.output"); got != `"Hi"` {
+		t.Errorf("output = %s", got)
+	}
+	if got := stringAttr(span, "langfuse.observation.usage_details"); got != `{"input":2,"output":1,"total":3}` {
+		t.Errorf("usage = %s", got)
+	}
+}
@@ -0,0 +1,383 @@
+package langfuse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// OpenAI-compatible endpoints recognized by RoundTripper
+const (
+	openAIChatCompletions = "/chat/completions"
+	openAICompletions     = "/completions"
+	openAIEmbeddings      = "/embeddings"
+	openAIResponses       = "/responses"
+)
+
+// openAIRequestFields are request fields that are not model parameters
+var openAIRequestFields = []string{
+	"model", "messages", "tools", "functions", "stream", "stream_options",
+	"prompt", "input", "instructions", "user", "metadata", "store",
+	"previous_response_id", "encoding_format", "include",
+}
+
+// openAIAPI parses the OpenAI API and compatible APIs such as Azure OpenAI,
+// vLLM and LiteLLM
+type openAIAPI struct{}
+
+func (openAIAPI) provider() Provider {
+	return ProviderOpenAI
+}
+
+func (openAIAPI) match(req *http.Request) (string, bool) {
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	// Check the longest suffix first since chat completions end in /completions
+	for _, endpoint := range []string{openAIChatCompletions, openAICompletions, openAIEmbeddings, openAIResponses} {
+		if strings.HasSuffix(path, endpoint) {
+			return endpoint, true
+		}
+	}
+	return "", false
+}
+
+func (openAIAPI) knownHost(u *url.URL) bool {
+	host := u.Hostname()
+	return host == "api.openai.com" || strings.HasSuffix(host, ".openai.azure.com")
+}
+
+func (openAIAPI) parseRequest(req *http.Request, endpoint string, body []byte) (llmCall, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return llmCall{}, fmt.Errorf("invalid OpenAI request: %w", err)
+	}
+
+	call := llmCall{
+		obsType: ObservationTypeGeneration,
+		params:  generationParamsFromJSON(fields, openAIRequestFields, nil),
+	}
+	_ = json.Unmarshal(fields["model"], &call.model)
+
+	switch endpoint {
+	case openAIChatCompletions:
+		call.name = "OpenAI-chat-completion"
+		input, err := ChatInputFromOpenAI(body)
+		if err != nil {
+			return llmCall{}, err
+		}
+		call.input = input
+	case openAICompletions:
+		call.name = "OpenAI-completion"
+		call.input = rawJSON(fields["prompt"])
+	case openAIEmbeddings:
+		call.name = "OpenAI-embedding"
+		call.obsType = ObservationTypeEmbedding
+		call.input = rawJSON(fields["input"])
+	case openAIResponses:
+		call.name = "OpenAI-response"
+		input := map[string]interface{}{"input": rawJSON(fields["input"])}
+		if instructions, ok := fields["instructions"]; ok {
+			input["instructions"] = rawJSON(instructions)
+		}
+		if tools, ok := fields["tools"]; ok {
+			input["tools"] = rawJSON(tools)
+		}
+		call.input = input
+	}
+
+	return call, nil
+}
+
+// openAIUsage covers the usage objects of all OpenAI endpoints
+type openAIUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	InputTokens         int `json:"input_tokens"`
+	OutputTokens        int `json:"output_tokens"`
+	TotalTokens         int `json:"total_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+		AudioTokens  int `json:"audio_tokens"`
+	} `json:"prompt_tokens_details"`
+	CompletionTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+		AudioTokens     int `json:"audio_tokens"`
+	} `json:"completion_tokens_details"`
+	InputTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+}
+
+// details converts the usage into Langfuse usage details
+func (u *openAIUsage) details() map[string]int {
+	if u == nil {
+		return nil
+	}
+	return NewUsageDetails(u.PromptTokens+u.InputTokens, u.CompletionTokens+u.OutputTokens, u.TotalTokens, map[string]int{
+		"input_cached_tokens":     u.PromptTokensDetails.CachedTokens + u.InputTokensDetails.CachedTokens,
+		"input_audio_tokens":      u.PromptTokensDetails.AudioTokens,
+		"output_reasoning_tokens": u.CompletionTokensDetails.ReasoningTokens + u.OutputTokensDetails.ReasoningTokens,
+		"output_audio_tokens":     u.CompletionTokensDetails.AudioTokens,
+	})
+}
+
+func (openAIAPI) parseResponse(endpoint string, body []byte) (llmResult, error) {
+	if endpoint == openAIResponses {
+		return parseOpenAIResponse(body)
+	}
+
+	var resp struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Text         string          `json:"text"`
+			Message      json.RawMessage `json:"message"`
+			FinishReason string          `json:"finish_reason"`
+		} `json:"choices"`
+		Data []struct {
+			Embedding json.RawMessage `json:"embedding"`
+		} `json:"data"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return llmResult{}, fmt.Errorf("invalid OpenAI response: %w", err)
+	}
+
+	result := llmResult{model: resp.Model, usage: resp.Usage.details()}
+
+	switch endpoint {
+	case openAIChatCompletions:
+		if len(resp.Choices) > 0 {
+			var message ChatMessage
+			if err := json.Unmarshal(resp.Choices[0].Message, &message); err == nil {
+				result.output = message
+			}
+			result.metadata = map[string]string{"finish_reason": resp.Choices[0].FinishReason}
+		}
+	case openAICompletions:
+		if len(resp.Choices) > 0 {
+			result.output = resp.Choices[0].Text
+			result.metadata = map[string]string{"finish_reason": resp.Choices[0].FinishReason}
+		}
+	case openAIEmbeddings:
+		// Vectors are not recorded, only their count and dimensions
+		output := map[string]int{"embeddings": len(resp.Data)}
+		if len(resp.Data) > 0 {
+			var vector []float64
+			if err := json.Unmarshal(resp.Data[0].Embedding, &vector); err == nil {
+				output["dimensions"] = len(vector)
+			}
+		}
+		result.output = output
+	}
+
+	return result, nil
+}
+
+// parseOpenAIResponse parses a Responses API response object
+func parseOpenAIResponse(body []byte) (llmResult, error) {
+	var resp struct {
+		Model  string `json:"model"`
+		Status string `json:"status"`
+		Output []struct {
+			Type    string `json:"type"`
+			Role    string `json:"role"`
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+			CallID    string `json:"call_id"`
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+		} `json:"output"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return llmResult{}, fmt.Errorf("invalid OpenAI response: %w", err)
+	}
+
+	message := ChatMessage{Role: ChatRoleAssistant}
+	var texts []string
+	for _, item := range resp.Output {
+		switch item.Type {
+		case "message":
+			for _, part := range item.Content {
+				if part.Type == "output_text" {
+					texts = append(texts, part.Text)
+				}
+			}
+		case "function_call":
+			message.ToolCalls = append(message.ToolCalls, NewToolCall(item.CallID, item.Name, item.Arguments))
+		}
+	}
+	message.Content = strings.Join(texts, "")
+
+	result := llmResult{
+		model:  resp.Model,
+		output: message,
+		usage:  resp.Usage.details(),
+	}
+	if resp.Status != "" {
+		result.metadata = map[string]string{"status": resp.Status}
+	}
+	return result, nil
+}
+
+func (openAIAPI) newStream(endpoint string, call llmCall) llmStream {
+	return &openAIStream{endpoint: endpoint, toolCalls: make(map[int]*ToolCall)}
+}
+
+// openAIStream accumulates streamed chat completion, completion and
+// Responses API events
+type openAIStream struct {
+	endpoint     string
+	model        string
+	role         string
+	content      strings.Builder
+	toolCalls    map[int]*ToolCall
+	finishReason string
+	usage        *openAIUsage
+	completed    *llmResult
+}
+
+func (s *openAIStream) event(eventType string, data []byte) bool {
+	if s.endpoint == openAIResponses {
+		return s.responsesEvent(data)
+	}
+
+	var chunk struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Index int    `json:"index"`
+			Text  string `json:"text"`
+			Delta struct {
+				Role      string `json:"role"`
+				Content   string `json:"content"`
+				ToolCalls []struct {
+					Index    int    `json:"index"`
+					ID       string `json:"id"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"delta"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return false
+	}
+
+	if chunk.Model != "" {
+		s.model = chunk.Model
+	}
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+
+	generated := false
+	for _, choice := range chunk.Choices {
+		// Only the first choice is recorded
+		if choice.Index != 0 {
+			continue
+		}
+		if choice.Delta.Role != "" {
+			s.role = choice.Delta.Role
+		}
+		if choice.FinishReason != "" {
+			s.finishReason = choice.FinishReason
+		}
+		text := choice.Delta.Content + choice.Text
+		if text != "" {
+			s.content.WriteString(text)
+			generated = true
+		}
+		for _, tc := range choice.Delta.ToolCalls {
+			call, ok := s.toolCalls[tc.Index]
+			if !ok {
+				call = &ToolCall{Type: "function"}
+				s.toolCalls[tc.Index] = call
+			}
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			call.Function.Name += tc.Function.Name
+			call.Function.Arguments += tc.Function.Arguments
+			generated = true
+		}
+	}
+	return generated
+}
+
+// responsesEvent handles a Responses API streaming event
+func (s *openAIStream) responsesEvent(data []byte) bool {
+	var event struct {
+		Type     string          `json:"type"`
+		Delta    string          `json:"delta"`
+		Response json.RawMessage `json:"response"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return false
+	}
+
+	switch event.Type {
+	case "response.output_text.delta":
+		s.content.WriteString(event.Delta)
+		return true
+	case "response.function_call_arguments.delta":
+		return true
+	case "response.completed", "response.incomplete", "response.failed":
+		if result, err := parseOpenAIResponse(event.Response); err == nil {
+			s.completed = &result
+		}
+	}
+	return false
+}
+
+func (s *openAIStream) result() llmResult {
+	if s.completed != nil {
+		return *s.completed
+	}
+
+	result := llmResult{model: s.model, usage: s.usage.details()}
+	if s.finishReason != "" {
+		result.metadata = map[string]string{"finish_reason": s.finishReason}
+	}
+
+	if s.endpoint == openAICompletions {
+		result.output = s.content.String()
+		return result
+	}
+
+	role := s.role
+	if role == "" {
+		role = ChatRoleAssistant
+	}
+	message := ChatMessage{Role: role, Content: s.content.String()}
+
+	indexes := make([]int, 0, len(s.toolCalls))
+	for index := range s.toolCalls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		message.ToolCalls = append(message.ToolCalls, *s.toolCalls[index])
+	}
+
+	result.output = message
+	return result
+}
+
+// rawJSON returns a raw JSON value, or nil if it is empty
+func rawJSON(value json.RawMessage) interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+	return value
+}
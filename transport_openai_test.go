@@ -0,0 +1,204 @@
+package langfuse
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestOpenAIChatCompletion(t *testing.T) {
+	var received string
+	reqBody := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"temperature":0.2,"stream":false}`
+	respBody := `{"model":"gpt-4o-2024-08-06","choices":[{"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],
+		"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15,"prompt_tokens_details":{"cached_tokens":4}}}`
+
+	_, body, exporter := recordLLMCall(t, "https://api.openai.com/v1/chat/completions", reqBody, fakeLLM(http.StatusOK, "application/json", respBody, &received))
+	if received != reqBody || body != respBody {
+		t.Errorf("bodies were not passed through unchanged")
+	}
+
+	span := findSpan(t, exporter, "OpenAI-chat-completion")
+	want := map[string]string{
+		"langfuse.observation.type":                   "generation",
+		"langfuse.observation.model.name":             "gpt-4o-2024-08-06",
+		"langfuse.observation.model.parameters":       `{"temperature":0.2}`,
+		"langfuse.observation.input":                  `{"messages":[{"role":"user","content":"hi"}]}`,
+		"langfuse.observation.output":                 `{"role":"assistant","content":"hello"}`,
+		"langfuse.observation.usage_details":          `{"input":6,"input_cached_tokens":4,"output":5,"total":15}`,
+		"langfuse.observation.metadata.provider":      "openai",
+		"langfuse.observation.metadata.endpoint":      "/chat/completions",
+		"langfuse.observation.metadata.finish_reason": "stop",
+	}
+	for key, value := range want {
+		if got := stringAttr(span, key); got != value {
+			t.Errorf("%s = %s, want %s", key, got, value)
+		}
+	}
+}
+
+func TestOpenAIMatch(t *testing.T) {
+	tests := []struct {
+		path     string
+		endpoint string
+	}{
+		{path: "/v1/chat/completions", endpoint: openAIChatCompletions},
+		{path: "/openai/deployments/gpt/chat/completions/", endpoint: openAIChatCompletions},
+		{path: "/v1/completions", endpoint: openAICompletions},
+		{path: "/v1/embeddings", endpoint: openAIEmbeddings},
+		{path: "/v1/responses", endpoint: openAIResponses},
+		{path: "/v1/models"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "https://api.openai.com"+tt.path, nil)
+			endpoint, ok := openAIAPI{}.match(req)
+			if ok != (tt.endpoint != "") || endpoint != tt.endpoint {
+				t.Errorf("match = %q %v, want %q", endpoint, ok, tt.endpoint)
+			}
+		})
+	}
+}
+
+func TestOpenAIUsageDetails(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage string
+		want  map[string]int
+	}{
+		{
+			name:  "chat completions",
+			usage: `{"prompt_tokens":100,"completion_tokens":50,"total_tokens":150,"prompt_tokens_details":{"cached_tokens":30,"audio_tokens":10},"completion_tokens_details":{"reasoning_tokens":20}}`,
+			want:  map[string]int{"input": 60, "output": 30, "total": 150, "input_cached_tokens": 30, "input_audio_tokens": 10, "output_reasoning_tokens": 20},
+		},
+		{
+			name:  "responses",
+			usage: `{"input_tokens":100,"output_tokens":50,"total_tokens":150,"input_tokens_details":{"cached_tokens":30},"output_tokens_details":{"reasoning_tokens":20}}`,
+			want:  map[string]int{"input": 70, "output": 30, "total": 150, "input_cached_tokens": 30, "output_reasoning_tokens": 20},
+		},
+		{
+			name:  "embeddings",
+			usage: `{"prompt_tokens":8,"total_tokens":8}`,
+			want:  map[string]int{"input": 8, "output": 0, "total": 8},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var usage openAIUsage
+			if err := json.Unmarshal([]byte(tt.usage), &usage); err != nil {
+				t.Fatal(err)
+			}
+			if got := usage.details(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenAIParseResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		body     string
+		output   interface{}
+	}{
+		{
+			name:     "completion",
+			endpoint: openAICompletions,
+			body:     `{"choices":[{"text":"hello","finish_reason":"length"}]}`,
+			output:   "hello",
+		},
+		{
+			name:     "embeddings",
+			endpoint: openAIEmbeddings,
+			body:     `{"data":[{"embedding":[0.1,0.2,0.3]},{"embedding":[0.4,0.5,0.6]}]}`,
+			output:   map[string]int{"embeddings": 2, "dimensions": 3},
+		},
+		{
+			name:     "responses",
+			endpoint: openAIResponses,
+			body: `{"status":"completed","output":[{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Checking"}]},
+				{"type":"function_call","call_id":"call_1","name":"get_weather","arguments":"{}"}]}`,
+			output: ChatMessage{Role: ChatRoleAssistant, Content: "Checking", ToolCalls: []ToolCall{NewToolCall("call_1", "get_weather", "{}")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := openAIAPI{}.parseResponse(tt.endpoint, []byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.output, tt.output) {
+				t.Errorf("output = %#v, want %#v", result.output, tt.output)
+			}
+		})
+	}
+}
+
+func TestOpenAIStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		events   []string
+		output   ChatMessage
+		usage    map[string]int
+	}{
+		{
+			name:     "chat completion",
+			endpoint: openAIChatCompletions,
+			events: []string{
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+				`{"choices":[{"index":0,"delta":{"content":"lo"}},{"index":1,"delta":{"content":"ignored"}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"get_weather","arguments":"{\"city\""}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":":\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`,
+				`{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+			},
+			output: ChatMessage{Role: ChatRoleAssistant, Content: "Hello", ToolCalls: []ToolCall{NewToolCall("call_1", "get_weather", `{"city":"Paris"}`)}},
+			usage:  map[string]int{"input": 10, "output": 5, "total": 15},
+		},
+		{
+			name:     "responses",
+			endpoint: openAIResponses,
+			events: []string{
+				`{"type":"response.output_text.delta","delta":"Hi"}`,
+				`{"type":"response.completed","response":{"model":"gpt-4o","output":[{"type":"message","content":[{"type":"output_text","text":"Hi"}]}],"usage":{"input_tokens":3,"output_tokens":1,"total_tokens":4}}}`,
+			},
+			output: ChatMessage{Role: ChatRoleAssistant, Content: "Hi"},
+			usage:  map[string]int{"input": 3, "output": 1, "total": 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := openAIAPI{}.newStream(tt.endpoint, llmCall{})
+			for _, event := range tt.events {
+				stream.event("", []byte(event))
+			}
+			result := stream.result()
+			if !reflect.DeepEqual(result.output, tt.output) {
+				t.Errorf("output = %+v, want %+v", result.output, tt.output)
+			}
+			if !reflect.DeepEqual(result.usage, tt.usage) {
+				t.Errorf("usage = %v, want %v", result.usage, tt.usage)
+			}
+		})
+	}
+}
+
+func TestOpenAIStreamThroughRoundTripper(t *testing.T) {
+	stream := "data: {\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hi\"}}]}\n\n" +
+		"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":1,\"total_tokens\":4}}\n\n" +
+		"data: [DONE]\n\n"
+	_, body, exporter := recordLLMCall(t, "https://api.openai.com/v1/chat/completions",
+		`{"model":"gpt-4o","messages":[],"stream":true}`, fakeLLM(http.StatusOK, "text/event-stream", stream, nil))
+	if body != stream {
+		t.Error("stream was not passed through unchanged")
+	}
+
+	span := findSpan(t, exporter, "OpenAI-chat-completion")
+	if got := stringAttr(span, "langfuse.observation.output"); got != `{"role":"assistant","content":"Hi"}` {
+		t.Errorf("output = %s", got)
+	}
+	if got := stringAttr(span, "langfuse.observation.completion_start_time"); got == "" {
+		t.Error("completion start time not recorded")
+	}
+}
@@ -0,0 +1,309 @@
+package langfuse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// fakeLLM returns a base transport that answers every request with the given
+// status, content type and body, recording the request body it received
+func fakeLLM(status int, contentType, body string, received *string) http.RoundTripper {
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if received != nil {
+			data, _ := io.ReadAll(req.Body)
+			*received = string(data)
+		}
+		return &http.Response{
+			StatusCode: status,
+			Status:     http.StatusText(status),
+			Header:     http.Header{"Content-Type": []string{contentType}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+}
+
+// recordLLMCall sends a POST request through a RoundTripper within a trace,
+// consumes the response and returns the recorded spans
+func recordLLMCall(t *testing.T, url, reqBody string, base http.RoundTripper) (*http.Response, string, *tracetest.InMemoryExporter) {
+	t.Helper()
+	client, exporter := newTestClient(t, Config{})
+	trace := client.CreateTrace(context.Background(), "call")
+
+	req, err := http.NewRequestWithContext(trace.Context(), http.MethodPost, url, strings.NewReader(reqBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := NewRoundTripper(client, base).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	trace.End()
+	return resp, string(body), exporter
+}
+
+func TestRoundTripperPassesThrough(t *testing.T) {
+	var received string
+	reqBody := `{"model":"gpt-4o","messages":[]}`
+	tests := []struct {
+		name   string
+		method string
+		url    string
+	}{
+		{name: "other endpoint", method: http.MethodPost, url: "https://api.example.com/v1/things"},
+		{name: "unknown host", method: http.MethodPost, url: "https://api.example.com/v1/chat/completions"},
+		{name: "GET", method: http.MethodGet, url: "https://api.openai.com/v1/chat/completions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, exporter := newTestClient(t, Config{})
+			req, _ := http.NewRequest(tt.method, tt.url, strings.NewReader(reqBody))
+			resp, err := NewRoundTripper(client, fakeLLM(200, "application/json", "{}", &received)).RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if received != reqBody {
+				t.Errorf("base transport received %q", received)
+			}
+			if spans := exporter.GetSpans(); len(spans) != 0 {
+				t.Errorf("recorded %d spans", len(spans))
+			}
+		})
+	}
+}
+
+func TestRoundTripperWithProviders(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	rt := NewRoundTripper(client, fakeLLM(200, "application/json", "{}", nil), WithProviders(ProviderAnthropic))
+	req, _ := http.NewRequest(http.MethodPost, "https://api.openai.com/v1/chat/completions", strings.NewReader(`{"messages":[]}`))
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Errorf("recorded %d spans for a disabled provider", len(spans))
+	}
+}
+
+func TestKnownHosts(t *testing.T) {
+	tests := []struct {
+		api  llmAPI
+		url  string
+		want bool
+	}{
+		{api: openAIAPI{}, url: "https://api.openai.com/v1/chat/completions", want: true},
+		{api: openAIAPI{}, url: "https://my-resource.openai.azure.com/openai/deployments/gpt/chat/completions", want: true},
+		{api: openAIAPI{}, url: "https://api.example.com/v1/chat/completions"},
+		{api: anthropicAPI{}, url: "https://api.anthropic.com/v1/messages", want: true},
+		{api: anthropicAPI{}, url: "https://api.example.com/v1/messages"},
+		{api: geminiAPI{}, url: "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:generateContent", want: true},
+		{api: geminiAPI{}, url: "https://us-central1-aiplatform.googleapis.com/v1/projects/p/locations/us-central1/publishers/google/models/gemini-2.5-flash:generateContent", want: true},
+		{api: geminiAPI{}, url: "https://storage.googleapis.com/v1/models/m:generateContent"},
+		{api: ollamaAPI{}, url: "http://localhost:11434/api/chat", want: true},
+		{api: ollamaAPI{}, url: "https://api.example.com/api/chat"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			if got := tt.api.knownHost(u); got != tt.want {
+				t.Errorf("knownHost = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundTripperWithProvidersOnAnyHost(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	rt := NewRoundTripper(client, fakeLLM(200, "application/json", "{}", nil), WithProviders(ProviderOpenAI))
+	req, _ := http.NewRequest(http.MethodPost, "http://vllm.internal:8000/v1/chat/completions", strings.NewReader(`{"messages":[]}`))
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if spans := exporter.GetSpans(); len(spans) != 2 {
+		t.Errorf("recorded %d spans, want the generation and its trace", len(spans))
+	}
+}
+
+func TestRoundTripperErrors(t *testing.T) {
+	url := "https://api.openai.com/v1/chat/completions"
+	reqBody := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+
+	t.Run("status", func(t *testing.T) {
+		resp, body, exporter := recordLLMCall(t, url, reqBody, fakeLLM(http.StatusTooManyRequests, "application/json", `{"error":"rate limited"}`, nil))
+		if resp.StatusCode != http.StatusTooManyRequests || body != `{"error":"rate limited"}` {
+			t.Errorf("caller got %d %q", resp.StatusCode, body)
+		}
+		span := findSpan(t, exporter, "OpenAI-chat-completion")
+		if got := stringAttr(span, "langfuse.observation.level"); got != string(LogLevelError) {
+			t.Errorf("level = %q", got)
+		}
+		if got := stringAttr(span, "langfuse.observation.status_message"); !strings.Contains(got, "rate limited") {
+			t.Errorf("status message = %q", got)
+		}
+	})
+
+	t.Run("transport", func(t *testing.T) {
+		client, exporter := newTestClient(t, Config{})
+		failing := roundTripFunc(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("connection refused")
+		})
+		req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(reqBody))
+		if _, err := NewRoundTripper(client, failing).RoundTrip(req); err == nil {
+			t.Fatal("expected the transport error")
+		}
+		span := findSpan(t, exporter, "OpenAI-chat-completion")
+		if got := stringAttr(span, "langfuse.observation.status_message"); got != "connection refused" {
+			t.Errorf("status message = %q", got)
+		}
+	})
+}
+
+func TestStreamRecorderSplitsEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		sse  bool
+		body string
+		want []string
+	}{
+		{
+			name: "sse",
+			sse:  true,
+			body: "event: a\ndata: 1\n\ndata: 2\ndata: 3\n\n: comment\ndata: [DONE]\n\n",
+			want: []string{"a:1", ":2\n3"},
+		},
+		{
+			name: "sse without trailing blank line",
+			sse:  true,
+			body: "data: 1\r\n\r\ndata: 2",
+			want: []string{":1", ":2"},
+		},
+		{
+			name: "ndjson",
+			body: "{\"a\":1}\n\n{\"b\":2}",
+			want: []string{`:{"a":1}`, `:{"b":2}`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newTestClient(t, Config{})
+			stream := &eventLog{}
+			recorder := &streamRecorder{
+				body:       io.NopCloser(strings.NewReader(tt.body)),
+				sse:        tt.sse,
+				stream:     stream,
+				generation: client.CreateTrace(context.Background(), "t").CreateGeneration("g"),
+				rt:         NewRoundTripper(client, nil),
+			}
+			// Read in small chunks so events span several reads
+			buf := make([]byte, 3)
+			for {
+				if _, err := recorder.Read(buf); err != nil {
+					break
+				}
+			}
+			if got := strings.Join(stream.events, "|"); got != strings.Join(tt.want, "|") {
+				t.Errorf("events = %q, want %q", stream.events, tt.want)
+			}
+		})
+	}
+}
+
+// eventLog is an llmStream that records the events it receives
+type eventLog struct {
+	events []string
+}
+
+func (l *eventLog) event(eventType string, data []byte) bool {
+	l.events = append(l.events, eventType+":"+string(data))
+	return true
+}
+
+func (l *eventLog) result() llmResult {
+	return llmResult{}
+}
+
+func TestGenerationParamsFromJSON(t *testing.T) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(`{"model":"m","temperature":0.5,"stop":"END","maxOutputTokens":10,"top_p":"bad","logit_bias":{"1":2}}`), &fields); err != nil {
+		t.Fatal(err)
+	}
+	params := generationParamsFromJSON(fields, []string{"model"}, generationParamRenames{"maxOutputTokens": "max_tokens"})
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]json.RawMessage
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"temperature": `0.5`,
+		"stop":        `["END"]`,
+		"max_tokens":  `10`,
+		"logit_bias":  `{"1":2}`,
+	}
+	for key, value := range want {
+		if string(got[key]) != value {
+			t.Errorf("%s = %s, want %s", key, got[key], value)
+		}
+	}
+	if _, ok := got["model"]; ok {
+		t.Error("skipped field model recorded as a parameter")
+	}
+}
+
+func TestRoundTripperParamsAndCost(t *testing.T) {
+	client, exporter := newTestClient(t, Config{})
+	temperature := 0.7
+	rt := NewRoundTripper(client, fakeLLM(http.StatusOK, "application/json",
+		`{"model":"gpt-4o-2024-08-06","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`, nil),
+		WithParams(func(req *http.Request, body []byte) (GenerationParams, bool) {
+			return GenerationParams{Temperature: &temperature}, true
+		}),
+		WithCost(func(model string, usage map[string]int) (Cost, bool) {
+			if model != "gpt-4o-2024-08-06" {
+				return Cost{}, false
+			}
+			return Cost{Input: float64(usage["input"]), Output: float64(usage["output"]), Total: float64(usage["total"])}, true
+		}),
+	)
+	req, _ := http.NewRequest(http.MethodPost, "https://api.openai.com/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","temperature":0.2,"messages":[]}`))
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	span := findSpan(t, exporter, "OpenAI-chat-completion")
+	if got := stringAttr(span, "langfuse.observation.model.parameters"); got != `{"temperature":0.7}` {
+		t.Errorf("parameters = %s", got)
+	}
+	if got := stringAttr(span, "langfuse.observation.cost_details"); got != `{"total":15,"input":10,"output":5}` {
+		t.Errorf("cost = %s", got)
+	}
+}